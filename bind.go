@@ -0,0 +1,168 @@
+package rest
+
+import (
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+)
+
+// defaultMultipartMemory is the max bytes of multipart request kept in memory if Rest.MultipartMemory
+// is 0.
+const defaultMultipartMemory = 32 << 20
+
+// bindSources are tags of request struct field naming where its value comes from, in precedence order.
+var bindSources = []string{"path", "query", "header", "form"}
+
+// FileUpload is a file of multipart request, bound to request field with tag file. See Processor.
+type FileUpload struct {
+	*multipart.FileHeader
+}
+
+var (
+	fileUploadType  = reflect.TypeOf(FileUpload{})
+	fileUploadsType = reflect.TypeOf([]FileUpload(nil))
+)
+
+// binding fills field of request struct from the first source which has its value.
+type binding struct {
+	index   int
+	typ     reflect.Type
+	sources [][2]string // pairs of source and name
+}
+
+// newBindings returns bindings of fields of request type t which have source tags. params are names of
+// path parameters. It returns nil if no field has source tag.
+func newBindings(t reflect.Type, params []string, name string) ([]binding, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, nil
+	}
+	var ret []binding
+	for i, n := 0, t.NumField(); i < n; i++ {
+		field := t.Field(i)
+		b := binding{
+			index: i,
+			typ:   field.Type,
+		}
+		if key := field.Tag.Get("file"); key != "" {
+			if field.PkgPath != "" || (field.Type != fileUploadType && field.Type != fileUploadsType) {
+				return nil, fmt.Errorf("processor(%s) field %s can't be bound to file, it should be exported and of type rest.FileUpload or []rest.FileUpload", name, field.Name)
+			}
+			b.sources = append(b.sources, [2]string{"file", key})
+			ret = append(ret, b)
+			continue
+		}
+		for _, source := range bindSources {
+			key := field.Tag.Get(source)
+			if key == "" {
+				continue
+			}
+			if source == "path" && !inList(params, key) {
+				return nil, fmt.Errorf("processor(%s) field %s binds path parameter %s which isn't in path", name, field.Name, key)
+			}
+			b.sources = append(b.sources, [2]string{source, key})
+		}
+		if len(b.sources) == 0 {
+			continue
+		}
+		if field.PkgPath != "" || !isPathKind(field.Type.Kind()) {
+			return nil, fmt.Errorf("processor(%s) field %s can't be bound, it should be exported and of kind string or int", name, field.Name)
+		}
+		ret = append(ret, b)
+	}
+	return ret, nil
+}
+
+// bindsForm returns whether any of bindings comes from form or file.
+func bindsForm(bindings []binding) bool {
+	for _, b := range bindings {
+		for _, source := range b.sources {
+			if source[0] == "form" || source[0] == "file" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isForm returns whether request r has a body of html form, multipart or url encoded.
+func isForm(r *http.Request) bool {
+	mime, _ := parseHeaderField(r, "Content-Type")
+	return mime == "multipart/form-data" || mime == "application/x-www-form-urlencoded"
+}
+
+// parseForm parses form body of request r. Parts of multipart body beyond memory bytes are stored in
+// temporary files, which caller should remove with r.MultipartForm.RemoveAll.
+func parseForm(r *http.Request, memory int64) error {
+	if mime, _ := parseHeaderField(r, "Content-Type"); mime != "multipart/form-data" {
+		return r.ParseForm()
+	}
+	if memory <= 0 {
+		memory = defaultMultipartMemory
+	}
+	return r.ParseMultipartForm(memory)
+}
+
+// bind fills fields of request struct v from request of ctx. Bound fields unmarshalled from body are
+// reset first, so body can't forge them.
+func bind(ctx *context, v reflect.Value, bindings []binding) error {
+	query := ctx.request.URL.Query()
+	for _, b := range bindings {
+		v.Field(b.index).Set(reflect.Zero(b.typ))
+		for _, source := range b.sources {
+			if source[0] == "file" {
+				bindFile(ctx.request, v.Field(b.index), source[1])
+				break
+			}
+			var value string
+			var ok bool
+			switch source[0] {
+			case "path":
+				value, ok = ctx.vars[source[1]]
+			case "query":
+				if values := query[source[1]]; len(values) > 0 {
+					value, ok = values[0], true
+				}
+			case "header":
+				if values := ctx.request.Header.Values(source[1]); len(values) > 0 {
+					value, ok = values[0], true
+				}
+			case "form":
+				if values := ctx.request.PostForm[source[1]]; len(values) > 0 {
+					value, ok = values[0], true
+				}
+			}
+			if !ok {
+				continue
+			}
+			arg, err := pathArg(value, b.typ)
+			if err != nil {
+				return fmt.Errorf("invalid %s %s: %s", source[0], source[1], err)
+			}
+			v.Field(b.index).Set(arg)
+			break
+		}
+	}
+	return nil
+}
+
+// bindFile fills field of type FileUpload with the first file of key in multipart form of r, or field of
+// type []FileUpload with all files of key.
+func bindFile(r *http.Request, field reflect.Value, key string) {
+	if r.MultipartForm == nil {
+		return
+	}
+	headers := r.MultipartForm.File[key]
+	if len(headers) == 0 {
+		return
+	}
+	if field.Type() == fileUploadType {
+		field.Set(reflect.ValueOf(FileUpload{headers[0]}))
+		return
+	}
+	files := make([]FileUpload, len(headers))
+	for i, h := range headers {
+		files[i] = FileUpload{h}
+	}
+	field.Set(reflect.ValueOf(files))
+}
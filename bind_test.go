@@ -0,0 +1,227 @@
+package rest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+type BindArg struct {
+	User   int    `path:"id"`
+	Page   int    `query:"page"`
+	Token  string `header:"X-Token"`
+	Sort   string `query:"sort" header:"X-Sort"`
+	Filter string `json:"filter"`
+}
+
+type UploadArg struct {
+	Album  string       `form:"album"`
+	Count  int          `form:"count" query:"count"`
+	Cover  FileUpload   `file:"cover"`
+	Photos []FileUpload `file:"photo"`
+}
+
+type TestBind struct {
+	Service
+
+	List   Processor `method:"GET" path:"/user/:id/posts"`
+	Post   Processor `method:"POST" path:"/user/:id/posts"`
+	Upload Processor `method:"POST" path:"/upload"`
+}
+
+func (r TestBind) HandleList(arg BindArg) BindArg {
+	return arg
+}
+
+func (r TestBind) HandlePost(arg BindArg) BindArg {
+	return arg
+}
+
+func (r TestBind) HandleUpload(arg UploadArg) []string {
+	ret := []string{arg.Album, strconv.Itoa(arg.Count)}
+	files := arg.Photos
+	if arg.Cover.FileHeader != nil {
+		files = append([]FileUpload{arg.Cover}, files...)
+	}
+	for _, f := range files {
+		file, err := f.Open()
+		if err != nil {
+			return []string{err.Error()}
+		}
+		b, err := ioutil.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return []string{err.Error()}
+		}
+		ret = append(ret, f.Filename+":"+string(b))
+	}
+	return ret
+}
+
+func TestBindRequest(t *testing.T) {
+	type Test struct {
+		method  string
+		url     string
+		headers http.Header
+		body    string
+
+		code     int
+		response string
+	}
+	var tests = []Test{
+		{"GET", "http://domain/user/1/posts?page=2", http.Header{"X-Token": {"t"}}, "", http.StatusOK, `{"User":1,"Page":2,"Token":"t","Sort":"","filter":""}`},
+		{"GET", "http://domain/user/1/posts?sort=date", http.Header{"X-Sort": {"title"}}, "", http.StatusOK, `{"User":1,"Page":0,"Token":"","Sort":"date","filter":""}`},
+		{"GET", "http://domain/user/1/posts", http.Header{"X-Sort": {"title"}}, "", http.StatusOK, `{"User":1,"Page":0,"Token":"","Sort":"title","filter":""}`},
+		{"POST", "http://domain/user/1/posts?page=3", nil, `{"filter":"go","User":9,"Page":1}`, http.StatusOK, `{"User":1,"Page":3,"Token":"","Sort":"","filter":"go"}`},
+		{"POST", "http://domain/user/1/posts", nil, `{"Page":1}`, http.StatusOK, `{"User":1,"Page":0,"Token":"","Sort":"","filter":""}`},
+		{"GET", "http://domain/user/x/posts", nil, "", http.StatusBadRequest, `{"code":-1,"message":"invalid path id: strconv.ParseInt: parsing \"x\": invalid syntax"}`},
+		{"GET", "http://domain/user/1/posts?page=x", nil, "", http.StatusBadRequest, `{"code":-1,"message":"invalid query page: strconv.ParseInt: parsing \"x\": invalid syntax"}`},
+	}
+	rest, err := New(new(TestBind))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest(test.method, test.url, bytes.NewBufferString(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range test.headers {
+			req.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Body.String(), test.response+"\n", "test %d", i)
+	}
+}
+
+func TestNewBindings(t *testing.T) {
+	type Missing struct {
+		ID int `path:"user"`
+	}
+	type Unexported struct {
+		page int `query:"page"`
+	}
+	type Slice struct {
+		Tags []string `query:"tag"`
+	}
+	type Files struct {
+		Name  string       `form:"name"`
+		Cover FileUpload   `file:"cover"`
+		Pages []FileUpload `file:"page"`
+	}
+	type BadFile struct {
+		Cover string `file:"cover"`
+	}
+	type Test struct {
+		t reflect.Type
+
+		bindings int
+		err      string
+	}
+	var tests = []Test{
+		{reflect.TypeOf(""), 0, ""},
+		{reflect.TypeOf(HelloArg{}), 0, ""},
+		{reflect.TypeOf(BindArg{}), 4, ""},
+		{reflect.TypeOf(Missing{}), 0, "processor(Node) field ID binds path parameter user which isn't in path"},
+		{reflect.TypeOf(Unexported{}), 0, "processor(Node) field page can't be bound, it should be exported and of kind string or int"},
+		{reflect.TypeOf(Slice{}), 0, "processor(Node) field Tags can't be bound, it should be exported and of kind string or int"},
+		{reflect.TypeOf(Files{}), 3, ""},
+		{reflect.TypeOf(BadFile{}), 0, "processor(Node) field Cover can't be bound to file, it should be exported and of type rest.FileUpload or []rest.FileUpload"},
+	}
+	for i, test := range tests {
+		bindings, err := newBindings(test.t, []string{"id"}, "Node")
+		if test.err != "" {
+			equal(t, fmt.Sprintf("%v", err), test.err, "test %d", i)
+			continue
+		}
+		equal(t, err, nil, "test %d", i)
+		equal(t, len(bindings), test.bindings, "test %d", i)
+	}
+}
+
+func TestBindUpload(t *testing.T) {
+	type Test struct {
+		fields map[string]string
+		files  [][2]string // pairs of key and file name, with content of file name
+		memory int64
+
+		code     int
+		response string
+	}
+	var tests = []Test{
+		{map[string]string{"album": "trip", "count": "2"}, [][2]string{{"photo", "a.jpg"}, {"photo", "b.jpg"}}, 0, http.StatusOK, `["trip","2","a.jpg:a.jpg","b.jpg:b.jpg"]`},
+		{map[string]string{"album": "trip"}, [][2]string{{"cover", "c.jpg"}, {"photo", "a.jpg"}}, 1, http.StatusOK, `["trip","0","c.jpg:c.jpg","a.jpg:a.jpg"]`},
+		{nil, nil, 0, http.StatusOK, `["","0"]`},
+		{map[string]string{"count": "x"}, nil, 0, http.StatusBadRequest, `{"code":-1,"message":"invalid form count: strconv.ParseInt: parsing \"x\": invalid syntax"}`},
+	}
+	rest, err := New(new(TestBind))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	for i, test := range tests {
+		rest.MultipartMemory = test.memory
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		for k, v := range test.fields {
+			mw.WriteField(k, v)
+		}
+		for _, f := range test.files {
+			w, err := mw.CreateFormFile(f[0], f[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write([]byte(f[1]))
+		}
+		mw.Close()
+		req, err := http.NewRequest("POST", "http://domain/upload", &body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Body.String(), test.response+"\n", "test %d", i)
+	}
+}
+
+func TestBindForm(t *testing.T) {
+	type Test struct {
+		contentType string
+		body        string
+
+		code     int
+		response string
+	}
+	var tests = []Test{
+		{"application/x-www-form-urlencoded", "album=trip&count=3", http.StatusOK, `["trip","3"]`},
+		{"multipart/form-data; boundary=x", "--x\r\nbroken", http.StatusBadRequest, ""},
+		{"multipart/form-data", "", http.StatusBadRequest, `{"code":-1,"message":"parse form failed: no multipart boundary param in Content-Type"}`},
+	}
+	rest, err := New(new(TestBind))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("POST", "http://domain/upload", bytes.NewBufferString(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", test.contentType)
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		// message of malformed multipart varies with go version.
+		if test.response != "" {
+			equal(t, w.Body.String(), test.response+"\n", "test %d", i)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package rest
+
+import (
+	"bytes"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultCacheSize is the max number of cached responses if Rest.CacheSize is 0.
+const defaultCacheSize = 1024
+
+// cacheKey identifies a cached response. Besides path and query, responses vary with negotiated mime,
+// charset and compression.
+type cacheKey struct {
+	// node is the node replying, so nodes of the same path on different hosts don't share entries.
+	node     *processorNode
+	path     string
+	query    string
+	mime     string
+	charset  string
+	encoding string
+}
+
+type cacheEntry struct {
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// responseCache caches responses of processors with tag cache. Zero value is an empty cache.
+type responseCache struct {
+	locker  sync.Mutex
+	entries map[cacheKey]*cacheEntry
+}
+
+func (c *responseCache) get(key cacheKey) (*cacheEntry, bool) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e, true
+}
+
+// put caches e with key. If cache has size entries, expired entries are removed, then the one expiring
+// first if still full.
+func (c *responseCache) put(key cacheKey, e *cacheEntry, size int) {
+	if size <= 0 {
+		size = defaultCacheSize
+	}
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[cacheKey]*cacheEntry)
+	}
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= size {
+		now := time.Now()
+		var first cacheKey
+		var firstExpires time.Time
+		for k, v := range c.entries {
+			if now.After(v.expires) {
+				delete(c.entries, k)
+				continue
+			}
+			if firstExpires.IsZero() || v.expires.Before(firstExpires) {
+				first, firstExpires = k, v.expires
+			}
+		}
+		if len(c.entries) >= size {
+			delete(c.entries, first)
+		}
+	}
+	c.entries[key] = e
+}
+
+// invalidate removes entries whose path matches pattern. Empty pattern removes all entries.
+func (c *responseCache) invalidate(pattern string) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	for k := range c.entries {
+		if pattern == "" {
+			delete(c.entries, k)
+			continue
+		}
+		if ok, _ := path.Match(pattern, k.path); ok {
+			delete(c.entries, k)
+		}
+	}
+}
+
+/*
+InvalidateCache removes cached responses whose request path, including service prefix, matches pattern
+with the syntax of path.Match, like "/prefix/user/*" matching "/prefix/user/1" but not
+"/prefix/user/1/posts". Responses of all queries of a path are removed together. Empty pattern removes
+all cached responses.
+
+Handler changing data served by cached routes should call it, otherwise clients may get stale
+responses until they expire. See Processor's cache tag.
+*/
+func (r *Rest) InvalidateCache(pattern string) {
+	r.cache.invalidate(pattern)
+}
+
+// cacheWriter records status and body written to response, to be cached.
+type cacheWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *cacheWriter) WriteHeader(code int) {
+	if w.status == 0 && code >= 200 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *cacheWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+// cacheable returns whether response of request r can be cached by processor n. Request with
+// credentials, or response transformed by Rest.ResponseTransform, may be of its own user, so it
+// bypasses the cache.
+func (n *processorNode) cacheable(ctx *context) bool {
+	return n.cache > 0 && ctx.cache != nil && ctx.request.Method == http.MethodGet && ctx.request.ContentLength == 0 &&
+		ctx.request.Header.Get("Authorization") == "" && ctx.request.Header.Get("Cookie") == "" && ctx.transform == nil
+}
+
+// storable returns whether response with header can be shared by other requests. Response setting
+// cookie, marked private or no-store by Cache-Control, or varying with headers other than the ones
+// negotiating mime, charset and compression isn't.
+func storable(header http.Header) bool {
+	if len(header["Set-Cookie"]) > 0 {
+		return false
+	}
+	for _, v := range header["Cache-Control"] {
+		for _, d := range strings.Split(v, ",") {
+			d = strings.ToLower(strings.TrimSpace(d))
+			if i := strings.Index(d, "="); i >= 0 {
+				d = strings.TrimSpace(d[:i])
+			}
+			if d == "private" || d == "no-store" {
+				return false
+			}
+		}
+	}
+	for _, v := range header["Vary"] {
+		for _, h := range strings.Split(v, ",") {
+			switch http.CanonicalHeaderKey(strings.TrimSpace(h)) {
+			case "", "Accept", "Accept-Charset", "Accept-Encoding":
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// handleCached replies cached response of request if exists. Otherwise it calls handler, and caches
+// the response if it's 200 OK and storable.
+func (n *processorNode) handleCached(instance reflect.Value, ctx *context) {
+	key := cacheKey{
+		node:    n,
+		path:    ctx.request.URL.Path,
+		query:   ctx.request.URL.RawQuery,
+		mime:    ctx.mime,
+		charset: ctx.charset,
+	}
+	if ctx.compresser != nil {
+		key.encoding = ctx.compresser.Name()
+	}
+	if e, ok := ctx.cache.get(key); ok {
+		header := ctx.Header()
+		for k, v := range e.header {
+			header[k] = v
+		}
+		ctx.WriteHeader(e.status)
+		ctx.responseWriter.Write(e.body)
+		return
+	}
+
+	w := &cacheWriter{ResponseWriter: ctx.responseWriter}
+	ctx.responseWriter = w
+	n.process(instance, ctx)
+	ctx.responseWriter = w.ResponseWriter
+	if ctx.written != 0 {
+		// status set by Service.SetStatus is written under cacheWriter.
+		w.status = ctx.written
+	}
+	if ctx.isError || ctx.err != nil || (w.status != 0 && w.status != http.StatusOK) {
+		return
+	}
+	if !storable(ctx.Header()) {
+		return
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	header := make(http.Header)
+	for k, v := range ctx.Header() {
+		header[k] = append([]string(nil), v...)
+	}
+	ctx.cache.put(key, &cacheEntry{
+		status:  w.status,
+		header:  header,
+		body:    w.body.Bytes(),
+		expires: time.Now().Add(n.cache),
+	}, ctx.cacheSize)
+}
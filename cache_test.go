@@ -0,0 +1,226 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type TestCache struct {
+	Service
+
+	Item Processor `method:"GET" path:"/item/:id" args:"id" cache:"1m"`
+
+	calls map[string]int
+}
+
+func (r TestCache) HandleItem(id string) (string, error) {
+	r.calls[id]++
+	if id == "missing" {
+		return "", fmt.Errorf("%s not found", id)
+	}
+	return fmt.Sprintf("%s %s %d", id, r.Request().URL.RawQuery, r.calls[id]), nil
+}
+
+func TestRestCache(t *testing.T) {
+	type Test struct {
+		url        string
+		invalidate string
+
+		code int
+		body string
+	}
+	var tests = []Test{
+		{"http://domain/item/1", "", http.StatusOK, "\"1  1\"\n"},
+		{"http://domain/item/1", "", http.StatusOK, "\"1  1\"\n"},
+		{"http://domain/item/1?a=b", "", http.StatusOK, "\"1 a=b 2\"\n"},
+		{"http://domain/item/2", "", http.StatusOK, "\"2  1\"\n"},
+		{"http://domain/item/1", "/item/*", http.StatusOK, "\"1  3\"\n"},
+		{"http://domain/item/2", "", http.StatusOK, "\"2  2\"\n"},
+		{"http://domain/item/1", "", http.StatusOK, "\"1  3\"\n"},
+		{"http://domain/item/missing", "", http.StatusInternalServerError, "{\"code\":-1,\"message\":\"missing not found\"}\n"},
+		{"http://domain/item/missing", "", http.StatusInternalServerError, "{\"code\":-1,\"message\":\"missing not found\"}\n"},
+	}
+	instance := &TestCache{
+		calls: make(map[string]int),
+	}
+	rest, err := New(instance)
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	for i, test := range tests {
+		if test.invalidate != "" {
+			rest.InvalidateCache(test.invalidate)
+		}
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+		equal(t, w.Header().Get("Content-Type"), "application/json; charset=utf-8", "test %d", i)
+	}
+	equal(t, instance.calls["missing"], 2)
+}
+
+type TestCacheBypass struct {
+	Service
+
+	Item Processor `method:"GET" path:"/item" cache:"1m"`
+
+	calls map[string]int
+}
+
+func (r TestCacheBypass) HandleItem() int {
+	query := r.Request().URL.RawQuery
+	switch query {
+	case "cookie":
+		r.Header().Set("Set-Cookie", "session=1")
+	case "private":
+		r.Header().Set("Cache-Control", "max-age=60, Private")
+	case "no-store":
+		r.Header().Set("Cache-Control", "no-store")
+	case "vary":
+		r.Header().Set("Vary", "Accept-Encoding, Accept-Language")
+	case "vary-accept":
+		r.Header().Set("Vary", "accept")
+	}
+	r.calls[query]++
+	return r.calls[query]
+}
+
+func TestRestCacheBypass(t *testing.T) {
+	type Test struct {
+		query  string
+		header string
+		value  string
+
+		body string
+	}
+	var tests = []Test{
+		{"plain", "", "", "1\n"},
+		{"auth", "Authorization", "Bearer token", "2\n"},
+		{"session", "Cookie", "session=1", "2\n"},
+		{"cookie", "", "", "2\n"},
+		{"private", "", "", "2\n"},
+		{"no-store", "", "", "2\n"},
+		{"vary", "", "", "2\n"},
+		{"vary-accept", "", "", "1\n"},
+	}
+	instance := &TestCacheBypass{
+		calls: make(map[string]int),
+	}
+	rest, err := New(instance)
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	for i, test := range tests {
+		var w *httptest.ResponseRecorder
+		for j := 0; j < 2; j++ {
+			req, err := http.NewRequest("GET", "http://domain/item?"+test.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.header != "" {
+				req.Header.Set(test.header, test.value)
+			}
+			w = httptest.NewRecorder()
+			rest.ServeHTTP(w, req)
+			equal(t, w.Code, http.StatusOK, "test %d", i)
+		}
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+}
+
+func TestRestCacheTransform(t *testing.T) {
+	instance := &TestCacheBypass{
+		calls: make(map[string]int),
+	}
+	rest, err := New(instance)
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	rest.ResponseTransform = func(v interface{}, s Service) interface{} {
+		return fmt.Sprintf("%s %v", s.Request().Header.Get("X-Role"), v)
+	}
+	for i, role := range []string{"admin", "guest"} {
+		req, err := http.NewRequest("GET", "http://domain/item", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Role", role)
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, http.StatusOK, "test %d", i)
+		equal(t, w.Body.String(), fmt.Sprintf("\"%s %d\"\n", role, i+1), "test %d", i)
+	}
+}
+
+type TestCacheHost struct {
+	Service
+
+	Admin  Processor `method:"GET" path:"/node" host:"admin.*" cache:"1m"`
+	Public Processor `method:"GET" path:"/node" cache:"1m"`
+}
+
+func (r TestCacheHost) HandleAdmin() string {
+	return "admin secret"
+}
+
+func (r TestCacheHost) HandlePublic() string {
+	return "public"
+}
+
+func TestRestCacheHost(t *testing.T) {
+	type Test struct {
+		url string
+
+		body string
+	}
+	var tests = []Test{
+		{"http://admin.example.com/node", "\"admin secret\"\n"},
+		{"http://www.example.com/node", "\"public\"\n"},
+		{"http://admin.example.com/node", "\"admin secret\"\n"},
+		{"http://www.example.com/node", "\"public\"\n"},
+	}
+	rest, err := New(new(TestCacheHost))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, http.StatusOK, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+}
+
+func TestResponseCacheSize(t *testing.T) {
+	var cache responseCache
+	now := time.Now()
+	cache.put(cacheKey{path: "/a"}, &cacheEntry{expires: now.Add(time.Minute)}, 2)
+	cache.put(cacheKey{path: "/b"}, &cacheEntry{expires: now.Add(time.Second)}, 2)
+	cache.put(cacheKey{path: "/c"}, &cacheEntry{expires: now.Add(time.Hour)}, 2)
+	_, ok := cache.get(cacheKey{path: "/a"})
+	equal(t, ok, true)
+	_, ok = cache.get(cacheKey{path: "/b"})
+	equal(t, ok, false)
+	_, ok = cache.get(cacheKey{path: "/c"})
+	equal(t, ok, true)
+
+	cache.put(cacheKey{path: "/d"}, &cacheEntry{expires: now.Add(-time.Second)}, 2)
+	_, ok = cache.get(cacheKey{path: "/d"})
+	equal(t, ok, false)
+	equal(t, len(cache.entries), 1)
+
+	cache.invalidate("")
+	equal(t, len(cache.entries), 0)
+}
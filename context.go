@@ -1,11 +1,16 @@
 package rest
 
 import (
+	gocontext "context"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 type headerWriter interface {
@@ -13,6 +18,9 @@ type headerWriter interface {
 }
 
 type context struct {
+	// bytesWritten is first to be 64-bit aligned for atomic operations, since it's counted by the
+	// background writer of stream queue.
+	bytesWritten   int64
 	name           string
 	request        *http.Request
 	vars           map[string]string
@@ -23,6 +31,61 @@ type context struct {
 	charset        string
 	compresser     Compresser
 	isError        bool
+	err            error
+	category       ErrorCategory
+	status         int
+	errorStatus    func(error) int
+	baseLogger     *log.Logger
+	logger         *log.Logger
+	wrapper        func(v interface{}, s Service) interface{}
+	transform      func(v interface{}, s Service) interface{}
+	retryAfter     time.Duration
+	sniff          bool
+	errorMime      string
+	problemJSON    bool
+	start          time.Time
+	bytesRead      int64
+	written        int
+	pendingStatus  int
+	replied        bool
+	cache          *responseCache
+	cacheSize      int
+	idempotency    IdempotencyStore
+	idemScope      func(r *http.Request) string
+	formMemory     int64
+	gzipOK         bool
+	timeout        time.Duration
+	meta           map[string]string
+	captures       []string
+	multipart      *MultipartWriter
+	contentName    string
+	contentModTime time.Time
+	finishers      []func()
+	ctx            gocontext.Context
+	cancel         gocontext.CancelFunc
+}
+
+// negotiateMime returns the mime in Accept header which has a marshaller, preferring the one with
+// higher quality. It returns "" if no mime in header has a marshaller.
+func negotiateMime(accept string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		mime := strings.TrimSpace(fields[0])
+		q := 1.0
+		for _, field := range fields[1:] {
+			field = strings.TrimSpace(field)
+			if strings.HasPrefix(field, "q=") {
+				if v, err := strconv.ParseFloat(field[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if _, ok := getMarshaller(mime); ok && q > bestQ {
+			best, bestQ = mime, q
+		}
+	}
+	return best
 }
 
 func newContext(w http.ResponseWriter, r *http.Request, vars map[string]string, defaultMime, defaultCharset string) (*context, error) {
@@ -40,9 +103,9 @@ func newContext(w http.ResponseWriter, r *http.Request, vars map[string]string,
 	if requestCharset == "" {
 		requestCharset = defaultCharset
 	}
-	mime := r.Header.Get("Accept")
-	if mime == "" {
-		mime = requestMime
+	mime := requestMime
+	if accept := r.Header.Get("Accept"); accept != "" {
+		mime = negotiateMime(accept)
 	}
 	if _, ok := getMarshaller(mime); !ok {
 		mime = defaultMime
@@ -67,7 +130,11 @@ func newContext(w http.ResponseWriter, r *http.Request, vars map[string]string,
 		}
 	}
 
+	ctx, cancel := gocontext.WithCancel(r.Context())
+
 	return &context{
+		ctx:            ctx,
+		cancel:         cancel,
 		request:        r,
 		vars:           vars,
 		requestMime:    requestMime,
@@ -85,16 +152,146 @@ func (c *context) Request() *http.Request {
 	return c.request
 }
 
+// Return the context of request. It is derived from Request().Context(), and will be done
+// when the client disconnects or the request finishes. Handler doing slow work can check it
+// to abort early.
+func (c *context) Context() gocontext.Context {
+	return c.ctx
+}
+
+// SetValue stores value v with key in request context, which can be got by Value(key) or Context().Value(key).
+// It's useful for hooks to pass request-scoped resource, like database transaction, to handler.
+func (c *context) SetValue(key, v interface{}) {
+	c.ctx = gocontext.WithValue(c.ctx, key, v)
+}
+
+// Value returns the value associated with key in request context, or nil.
+func (c *context) Value(key interface{}) interface{} {
+	return c.ctx.Value(key)
+}
+
+// OnFinish registers fn to be called after the response is written, including the end of streaming,
+// like releasing a lock or removing a temporary file acquired for request. Functions are called in
+// reverse order of registration, even if handler or another function panics.
+func (c *context) OnFinish(fn func()) {
+	c.finishers = append(c.finishers, fn)
+}
+
+// finish calls functions registered by OnFinish, the last registered first. They are deferred, so one
+// panicking doesn't skip the others.
+func (c *context) finish() {
+	for _, fn := range c.finishers {
+		defer fn()
+	}
+}
+
 // Variables from url.
 func (c *context) Vars() map[string]string {
 	return c.vars
 }
 
+// Logger returns a logger whose prefix is tagged with request method, path, handler name and
+// X-Request-Id header if request has one. It's derived from Rest.Logger, or the standard logger
+// if Rest.Logger is nil.
+func (c *context) Logger() *log.Logger {
+	if c.logger != nil {
+		return c.logger
+	}
+	base := c.baseLogger
+	if base == nil {
+		base = log.New(log.Writer(), log.Prefix(), log.Flags())
+	}
+	tag := fmt.Sprintf("%s %s %s", c.request.Method, c.request.URL.Path, c.name)
+	if id := c.request.Header.Get("X-Request-Id"); id != "" {
+		tag += " [" + id + "]"
+	}
+	c.logger = log.New(base.Writer(), base.Prefix()+tag+": ", base.Flags())
+	return c.logger
+}
+
+// contentType returns the default Content-Type of response.
+func (c *context) contentType() string {
+	return mimeContentType(c.mime, c.charset)
+}
+
+// RouteMeta returns metadata of the matched route, set by its meta tag like "scope=admin;audit=true", so
+// hooks can enforce per-route policy. It's nil if route has no meta tag, and it shouldn't be modified.
+func (c *context) RouteMeta() map[string]string {
+	return c.meta
+}
+
+// Captures returns values captured from url in order, independent of their names in Vars: arguments
+// returned by the match function of Rest.HandleMatch, or values of path parameters, including the ones
+// of service prefix, in order of path. Values are decoded as Vars. It's nil if nothing is captured.
+func (c *context) Captures() []string {
+	if len(c.vars) == 0 {
+		return nil
+	}
+	ret := make([]string, 0, len(c.vars))
+	if c.captures == nil {
+		// arguments of match function are keyed by their indexes.
+		for i := 0; i < len(c.vars); i++ {
+			ret = append(ret, c.vars[strconv.Itoa(i)])
+		}
+		return ret
+	}
+	for _, name := range c.captures {
+		ret = append(ret, c.vars[name])
+	}
+	return ret
+}
+
+// ResponseMime returns the mime of response, which is negotiated with Accept header of request and
+// the produces tag of handler. The response is marshalled with the marshaller of this mime.
+func (c *context) ResponseMime() string {
+	return c.mime
+}
+
 // Write response code and header. Same as http.ResponseWriter.WriteHeader(int)
+// Only the first call takes effect, so the status set by handler isn't overwritten by framework.
 func (c *context) WriteHeader(code int) {
+	if c.Written() {
+		return
+	}
+	if code == http.StatusServiceUnavailable && c.retryAfter > 0 && c.Header().Get("Retry-After") == "" {
+		c.RetryAfter(c.retryAfter)
+	}
+	c.status = code
 	c.responseWriter.WriteHeader(code)
 }
 
+// SetStatus sets the provisional status of response, which is written when response body starts, or
+// when handler returns if there's no body. Until then, it can be changed by calling SetStatus again.
+// Service.WriteHeader, or replying error, writes status immediately instead, and the provisional one is
+// discarded. It has no effect after response started.
+func (c *context) SetStatus(code int) {
+	if c.Written() {
+		return
+	}
+	c.pendingStatus = code
+}
+
+// Written returns whether response has started, by Service.WriteHeader, or by writing header or body
+// to response in any way. After that, changing header or status doesn't take effect.
+func (c *context) Written() bool {
+	return c.Status() != 0
+}
+
+// Status returns the status written to response, or 0 if response hasn't started. Response started
+// by writing body without status has 200 OK. 1xx informational status isn't counted.
+func (c *context) Status() int {
+	if c.written != 0 {
+		return c.written
+	}
+	if c.status != 0 {
+		return c.status
+	}
+	if atomic.LoadInt64(&c.bytesWritten) > 0 {
+		return http.StatusOK
+	}
+	return 0
+}
+
 // Get the response header.
 func (c *context) Header() http.Header {
 	return c.responseWriter.Header()
@@ -107,9 +304,13 @@ func (c *context) Header() http.Header {
 //         Message string
 //     }
 //
-// And it will marshal to special mime-type when calling with Service.Error.
+// And it will marshal to special mime-type when calling with Service.Error. If Rest.ProblemJSON is set,
+// it returns Problem with the message as detail, and code is ignored.
 func (c *context) DetailError(code int, format string, args ...interface{}) error {
-	marshaller, ok := getMarshaller(c.mime)
+	if c.problemJSON {
+		return Problem{Detail: fmt.Sprintf(format, args...)}
+	}
+	_, marshaller, ok := c.errorMarshaller()
 	if !ok {
 		http.Error(c.responseWriter, "can't find marshaller for"+c.mime, http.StatusBadRequest)
 		return errors.New("can't find marshaller for" + c.mime)
@@ -120,8 +321,21 @@ func (c *context) DetailError(code int, format string, args ...interface{}) erro
 // Error replies to the request with the specified error message and HTTP code.
 // If err has export field, it will be marshalled to response.Body directly, otherwise will use err.Error().
 func (c *context) Error(code int, err error) {
+	if c.problemJSON {
+		if c.status == 0 {
+			c.Header().Set("Content-Type", ProblemMime)
+		}
+		c.WriteHeader(code)
+		c.responseWriter.Write(c.marshalProblem(code, err))
+		c.isError = true
+		c.err = err
+		return
+	}
+	mime, marshaller, ok := c.errorMarshaller()
+	if ok && mime != c.mime && c.status == 0 {
+		c.Header().Set("Content-Type", mimeContentType(mime, c.charset))
+	}
 	c.WriteHeader(code)
-	marshaller, ok := getMarshaller(c.mime)
 	if !ok {
 		http.Error(c.responseWriter, "can't find marshaller for"+c.mime, http.StatusBadRequest)
 		return
@@ -132,6 +346,51 @@ func (c *context) Error(code int, err error) {
 		marshaller.Marshal(c.responseWriter, c.name, err.Error())
 	}
 	c.isError = true
+	c.err = err
+}
+
+// categoryError replies err like Error, with category for RequestStats.
+func (c *context) categoryError(category ErrorCategory, code int, err error) {
+	c.category = category
+	c.Error(code, err)
+}
+
+// errorMarshaller returns the mime and marshaller of error response, which is Rest.ErrorMime if it has
+// a marshaller, or the negotiated mime.
+func (c *context) errorMarshaller() (string, Marshaller, bool) {
+	if c.errorMime != "" {
+		if marshaller, ok := getMarshaller(c.errorMime); ok {
+			return c.errorMime, marshaller, true
+		}
+	}
+	marshaller, ok := getMarshaller(c.mime)
+	return c.mime, marshaller, ok
+}
+
+// handlerError replies err returned by handler. Status is got from errorStatus, or 500 Internal
+// Server Error without it.
+func (c *context) handlerError(err error) {
+	status := http.StatusInternalServerError
+	if c.errorStatus != nil {
+		status = c.errorStatus(err)
+	}
+	e := err
+	if !hasExportField(err) && !c.problemJSON {
+		e = c.DetailError(-1, "%s", err)
+	}
+	c.Error(status, e)
+	c.err = err
+}
+
+// result returns the error replied by Error, or an error of status if status written is 4xx or 5xx.
+func (c *context) result() error {
+	if c.err != nil {
+		return c.err
+	}
+	if status := c.Status(); status >= 400 {
+		return fmt.Errorf("%d %s", status, http.StatusText(status))
+	}
+	return nil
 }
 
 // Redirect to the specified path.
@@ -140,6 +399,84 @@ func (c *context) RedirectTo(path string) {
 	c.WriteHeader(http.StatusTemporaryRedirect)
 }
 
+// RetryAfter sets Retry-After header to d, rounded up to seconds, telling client when to retry. It
+// should be called before writing header, like before replying 503 Service Unavailable with Error.
+func (c *context) RetryAfter(d time.Duration) {
+	c.Header().Set("Retry-After", retryAfterSeconds(d))
+}
+
+// retryAfterSeconds returns the value of Retry-After header of d, rounded up to seconds.
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64((d+time.Second-1)/time.Second), 10)
+}
+
+// EarlyHints sends 103 Early Hints with Link headers of links, like "</style.css>; rel=preload; as=style",
+// so client can preload resources while handler is working. Links are kept in header of final response.
+// It does nothing after header is written, or if request is older than HTTP/1.1 which doesn't know
+// informational responses. Wrapped http.ResponseWriter must support 1xx response, like the one of
+// http.Server since Go 1.19.
+func (c *context) EarlyHints(links []string) {
+	if len(links) == 0 || c.Written() || !c.request.ProtoAtLeast(1, 1) {
+		return
+	}
+	for _, link := range links {
+		c.Header().Add("Link", link)
+	}
+	c.responseWriter.WriteHeader(http.StatusEarlyHints)
+}
+
+// SetContentInfo sets name and modification time of io.ReadSeeker returned by handler, which is served
+// by http.ServeContent. Name decides Content-Type if handler doesn't set it, and modtime is sent as
+// Last-Modified and checked with conditional requests. Zero modtime is ignored.
+func (c *context) SetContentInfo(name string, modtime time.Time) {
+	c.contentName = name
+	c.contentModTime = modtime
+}
+
+// LastEventID returns Last-Event-ID header of request, which is the id of last event received by
+// client reconnecting to a streaming with "sse" framing. See Stream.SetIDGenerator.
+func (c *context) LastEventID() string {
+	return c.request.Header.Get("Last-Event-ID")
+}
+
+// Created replies 201 Created with Location header of the created resource. Response body returned
+// by handler is still marshalled.
+func (c *context) Created(location string) {
+	c.Header().Set("Location", location)
+	c.WriteHeader(http.StatusCreated)
+}
+
+// NoContent replies 204 No Content. Value returned by handler isn't marshalled, so response has no body.
+func (c *context) NoContent() {
+	c.replied = true
+	c.Header().Del("Content-Type")
+	c.WriteHeader(http.StatusNoContent)
+}
+
+// NotModified replies 304 Not Modified. Value returned by handler isn't marshalled, so response has
+// no body.
+func (c *context) NotModified() {
+	c.replied = true
+	c.Header().Del("Content-Type")
+	c.WriteHeader(http.StatusNotModified)
+}
+
+// WriteRaw replies body with contentType as is, like bytes already marshalled and cached elsewhere.
+// Status is 200 OK unless handler has written one. Value returned by handler isn't marshalled.
+func (c *context) WriteRaw(contentType string, body []byte) {
+	c.replied = true
+	if c.status == 0 {
+		c.Header().Set("Content-Type", contentType)
+		if c.compresser == nil {
+			c.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		}
+	}
+	if c.pendingStatus == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	c.responseWriter.Write(body)
+}
+
 func hasExportField(i interface{}) bool {
 	v := reflect.ValueOf(i)
 	v = reflect.Indirect(v)
@@ -178,3 +515,29 @@ func parseHeaderField(r *http.Request, field string) (string, map[string]string)
 	}
 	return ret, pair
 }
+
+// acceptedValues returns values listed in accept-like header, like Accept or Accept-Encoding, in lower
+// case and in order. Value with q=0 isn't accepted, so it isn't returned.
+func acceptedValues(header string) []string {
+	var ret []string
+	for _, item := range strings.Split(header, ",") {
+		params := strings.Split(item, ";")
+		value := strings.ToLower(strings.TrimSpace(params[0]))
+		if value == "" {
+			continue
+		}
+		accepted := true
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && kv[0] == "q" {
+				if q, err := strconv.ParseFloat(kv[1], 64); err == nil && q == 0 {
+					accepted = false
+				}
+			}
+		}
+		if accepted {
+			ret = append(ret, value)
+		}
+	}
+	return ret
+}
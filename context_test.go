@@ -1,9 +1,18 @@
 package rest
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewContext(t *testing.T) {
@@ -32,6 +41,8 @@ func TestNewContext(t *testing.T) {
 		{nil, "application/json", "utf-8", true, "application/json", "utf-8", nil, nil},
 		{map[string]string{"Accept": "application/unknown", "Accept-Charset": "utf-8"}, "application/json", "utf-8", true, "application/json", "utf-8", nil, nil},
 		{map[string]string{"Accept": "application/unknown", "Accept-Charset": "utf-8"}, "application/unknow", "utf-8", false, "", "", nil, nil},
+		{map[string]string{"Accept": "text/html, application/json;q=0.9, */*;q=0.8"}, "application/json", "utf-8", true, "application/json", "utf-8", nil, nil},
+		{map[string]string{"Accept": "application/json;q=0"}, "application/json", "utf-8", true, "application/json", "utf-8", nil, nil},
 
 		{map[string]string{"Accept-Encoding": "gzip"}, "application/json", "utf-8", true, "application/json", "utf-8", gzip, nil},
 		{map[string]string{"Accept-Encoding": "deflate"}, "application/json", "utf-8", true, "application/json", "utf-8", flate, nil},
@@ -120,6 +131,526 @@ func TestHasExportField(t *testing.T) {
 	}
 }
 
+type TestWriteHeader struct {
+	Service
+
+	Created Processor `method:"GET" path:"/result"`
+	Failed  Processor `method:"GET" path:"/error"`
+}
+
+func (r TestWriteHeader) HandleCreated() Result {
+	r.WriteHeader(http.StatusCreated)
+	return Result{Status: http.StatusAccepted, Body: "ok"}
+}
+
+func (r TestWriteHeader) HandleFailed() string {
+	r.WriteHeader(http.StatusOK)
+	r.Error(http.StatusNotFound, r.DetailError(-1, "not found"))
+	return ""
+}
+
+func TestContextWriteHeaderOnce(t *testing.T) {
+	type Test struct {
+		path string
+
+		code int
+	}
+	var tests = []Test{
+		{"/result", http.StatusCreated},
+		{"/error", http.StatusOK},
+	}
+	rest, err := New(new(TestWriteHeader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := bytes.NewBuffer(nil)
+	server := httptest.NewUnstartedServer(rest)
+	server.Config.ErrorLog = log.New(logs, "", 0)
+	server.Start()
+	defer server.Close()
+
+	for i, test := range tests {
+		resp, err := http.Get(server.URL + test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		equal(t, resp.StatusCode, test.code, "test %d", i)
+	}
+	equal(t, strings.Contains(logs.String(), "superfluous"), false, "log: %s", logs.String())
+}
+
+type TestCreated struct {
+	Service
+
+	Put Processor `method:"PUT" path:"/item/:id"`
+}
+
+func (r TestCreated) HandlePut(id string, name string) string {
+	r.Created("/item/" + id)
+	return name
+}
+
+func TestContextCreated(t *testing.T) {
+	rest, err := New(new(TestCreated))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("PUT", "http://domain/item/1", bytes.NewBufferString(`"rest"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	rest.ServeHTTP(w, req)
+	equal(t, w.Code, http.StatusCreated)
+	equal(t, w.Header().Get("Location"), "/item/1")
+	equal(t, w.Body.String(), "\"rest\"\n")
+}
+
+type TestNoBody struct {
+	Service
+
+	Item Processor `method:"GET" path:"/item/:id" args:"id"`
+}
+
+func (r TestNoBody) HandleItem(id string) map[string]string {
+	switch id {
+	case "none":
+		r.NoContent()
+	case "same":
+		r.NotModified()
+	}
+	return map[string]string{"id": id}
+}
+
+func TestContextNoBody(t *testing.T) {
+	type Test struct {
+		url string
+
+		code int
+		body string
+	}
+	var tests = []Test{
+		{"http://domain/item/1", http.StatusOK, "{\"id\":\"1\"}\n"},
+		{"http://domain/item/none", http.StatusNoContent, ""},
+		{"http://domain/item/same", http.StatusNotModified, ""},
+	}
+	rest, err := New(new(TestNoBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+		if test.body == "" {
+			equal(t, w.Header().Get("Content-Type"), "", "test %d", i)
+			equal(t, w.Header().Get("Content-Length"), "", "test %d", i)
+		}
+	}
+}
+
+type TestWriteRaw struct {
+	Service
+
+	Item Processor `method:"GET" path:"/item/:id" args:"id"`
+}
+
+func (r TestWriteRaw) HandleItem(id string) map[string]string {
+	if id == "cached" {
+		r.WriteRaw("application/vnd.item+json", []byte(`{"id":"cached"}`))
+	}
+	return map[string]string{"id": id}
+}
+
+func TestContextWriteRaw(t *testing.T) {
+	type Test struct {
+		url string
+
+		contentType string
+		body        string
+	}
+	var tests = []Test{
+		{"http://domain/item/1", "application/json; charset=utf-8", "{\"id\":\"1\"}\n"},
+		{"http://domain/item/cached", "application/vnd.item+json", "{\"id\":\"cached\"}"},
+	}
+	rest, err := New(new(TestWriteRaw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, http.StatusOK, "test %d", i)
+		equal(t, w.Header().Get("Content-Type"), test.contentType, "test %d", i)
+		equal(t, w.Header().Get("Content-Length"), strconv.Itoa(len(test.body)), "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+}
+
+type TestWritten struct {
+	Service
+
+	Accept Processor `method:"GET" path:"/accept"`
+	Raw    Processor `method:"GET" path:"/raw"`
+	Value  Processor `method:"GET" path:"/value"`
+
+	states chan []int
+}
+
+func (r TestWritten) state() []int {
+	written := 0
+	if r.Written() {
+		written = 1
+	}
+	return []int{written, r.Status()}
+}
+
+func (r TestWritten) HandleAccept() {
+	before := r.state()
+	r.WriteHeader(http.StatusAccepted)
+	r.WriteHeader(http.StatusConflict)
+	r.states <- append(before, r.state()...)
+}
+
+func (r TestWritten) HandleRaw() {
+	before := r.state()
+	r.WriteRaw("text/plain", []byte("raw"))
+	r.states <- append(before, r.state()...)
+}
+
+func (r TestWritten) HandleValue() string {
+	return "value"
+}
+
+func (r TestWritten) AfterRequest(s Service, err error) {
+	if s.Request().URL.Path == "/value" {
+		r.states <- []int{0, 0, 1, s.Status()}
+	}
+}
+
+func TestContextWritten(t *testing.T) {
+	type Test struct {
+		url string
+
+		code   int
+		states []int
+	}
+	var tests = []Test{
+		{"http://domain/accept", http.StatusAccepted, []int{0, 0, 1, http.StatusAccepted}},
+		{"http://domain/raw", http.StatusOK, []int{0, 0, 1, http.StatusOK}},
+		{"http://domain/value", http.StatusOK, []int{0, 0, 1, http.StatusOK}},
+	}
+	instance := &TestWritten{
+		states: make(chan []int, 1),
+	}
+	rest, err := New(instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, <-instance.states, test.states, "test %d", i)
+	}
+}
+
+type TestSetStatus struct {
+	Service
+
+	Body   Processor `method:"GET" path:"/body"`
+	NoBody Processor `method:"GET" path:"/nobody"`
+	Commit Processor `method:"GET" path:"/commit"`
+	Fail   Processor `method:"GET" path:"/fail"`
+}
+
+func (r TestSetStatus) HandleBody() string {
+	r.SetStatus(http.StatusAccepted)
+	r.SetStatus(http.StatusCreated)
+	return "body"
+}
+
+func (r TestSetStatus) HandleNoBody() {
+	r.SetStatus(http.StatusAccepted)
+}
+
+func (r TestSetStatus) HandleCommit() string {
+	r.SetStatus(http.StatusAccepted)
+	r.WriteHeader(http.StatusConflict)
+	r.SetStatus(http.StatusCreated)
+	return "commit"
+}
+
+func (r TestSetStatus) HandleFail() (string, error) {
+	r.SetStatus(http.StatusCreated)
+	return "", errors.New("fail")
+}
+
+func TestContextSetStatus(t *testing.T) {
+	type Test struct {
+		url string
+
+		code int
+		body string
+	}
+	var tests = []Test{
+		{"http://domain/body", http.StatusCreated, "\"body\"\n"},
+		{"http://domain/nobody", http.StatusAccepted, ""},
+		{"http://domain/commit", http.StatusConflict, "\"commit\"\n"},
+		{"http://domain/fail", http.StatusInternalServerError, "{\"code\":-1,\"message\":\"fail\"}\n"},
+	}
+	rest, err := New(new(TestSetStatus))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+}
+
+type TestResponseMime struct {
+	Service
+
+	Default Processor `method:"GET" path:"/default"`
+	Fake    Processor `method:"GET" path:"/fake" produces:"text/x-fake"`
+}
+
+func (r TestResponseMime) HandleDefault() string {
+	return r.ResponseMime()
+}
+
+func (r TestResponseMime) HandleFake() string {
+	return r.ResponseMime()
+}
+
+func TestContextResponseMime(t *testing.T) {
+	type Test struct {
+		path   string
+		accept string
+
+		body string
+	}
+	var tests = []Test{
+		{"/default", "", "\"application/json\"\n"},
+		{"/default", "text/x-fake", "<text/x-fake>"},
+		{"/fake", "application/json", "<text/x-fake>"},
+	}
+	RegisterMarshaller("text/x-fake", FakeMarshaller{})
+	defer delete(marshallers, "text/x-fake")
+	rest, err := New(new(TestResponseMime))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", "http://domain"+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept", test.accept)
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+}
+
+type TestLogger struct {
+	Service
+
+	Node Processor `method:"GET" path:"/node/:id"`
+}
+
+func (r TestLogger) HandleNode() {
+	r.Logger().Print("hello")
+}
+
+func TestContextLogger(t *testing.T) {
+	type Test struct {
+		requestID string
+
+		log string
+	}
+	var tests = []Test{
+		{"", "rest GET /node/1 Node: hello\n"},
+		{"abc", "rest GET /node/1 Node [abc]: hello\n"},
+	}
+	rest, err := New(new(TestLogger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := bytes.NewBuffer(nil)
+	rest.Logger = log.New(logs, "rest ", 0)
+	for i, test := range tests {
+		logs.Reset()
+		req, err := http.NewRequest("GET", "http://domain/node/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.requestID != "" {
+			req.Header.Set("X-Request-Id", test.requestID)
+		}
+		rest.ServeHTTP(httptest.NewRecorder(), req)
+		equal(t, logs.String(), test.log, "test %d", i)
+	}
+}
+
+type TestRetryAfter struct {
+	Service
+
+	Busy   Processor `method:"GET" path:"/busy"`
+	Custom Processor `method:"GET" path:"/custom"`
+}
+
+func (r TestRetryAfter) HandleBusy() {
+	r.Error(http.StatusServiceUnavailable, r.DetailError(-1, "busy"))
+}
+
+func (r TestRetryAfter) HandleCustom() {
+	r.RetryAfter(1500 * time.Millisecond)
+	r.Error(http.StatusServiceUnavailable, r.DetailError(-1, "busy"))
+}
+
+func TestContextRetryAfter(t *testing.T) {
+	type Test struct {
+		retryAfter time.Duration
+		path       string
+
+		header string
+	}
+	var tests = []Test{
+		{0, "/busy", ""},
+		{time.Minute, "/busy", "60"},
+		{0, "/custom", "2"},
+		{time.Minute, "/custom", "2"},
+	}
+	rest, err := New(new(TestRetryAfter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		rest.RetryAfter = test.retryAfter
+		req, err := http.NewRequest("GET", "http://domain"+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, http.StatusServiceUnavailable, "test %d", i)
+		equal(t, w.Header().Get("Retry-After"), test.header, "test %d", i)
+	}
+}
+
+func TestContextLastEventID(t *testing.T) {
+	req, err := http.NewRequest("GET", "http://domain/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, err := newContext(httptest.NewRecorder(), req, nil, "application/json", "utf-8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, ctx.LastEventID(), "")
+	req.Header.Set("Last-Event-ID", "42")
+	equal(t, ctx.LastEventID(), "42")
+}
+
+type TestEarlyHints struct {
+	Service
+
+	Page Processor `method:"GET" path:"/page"`
+	Late Processor `method:"GET" path:"/late"`
+}
+
+func (r TestEarlyHints) HandlePage() string {
+	r.EarlyHints([]string{"</style.css>; rel=preload; as=style"})
+	return "page"
+}
+
+func (r TestEarlyHints) HandleLate() {
+	r.SetStatus(http.StatusAccepted)
+	r.WriteRaw("text/plain", []byte("late"))
+	r.EarlyHints([]string{"</style.css>; rel=preload; as=style"})
+}
+
+func TestContextEarlyHints(t *testing.T) {
+	rest, err := New(new(TestEarlyHints))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(rest)
+	defer server.Close()
+
+	var hints []int
+	var links []string
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			hints = append(hints, code)
+			links = append(links, header["Link"]...)
+			return nil
+		},
+	}
+	req, err := http.NewRequest("GET", server.URL+"/page", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	equal(t, resp.StatusCode, http.StatusOK)
+	equal(t, hints, []int{http.StatusEarlyHints})
+	equal(t, links, []string{"</style.css>; rel=preload; as=style"})
+}
+
+// codeRecorder records every status code written, including informational ones.
+type codeRecorder struct {
+	*httptest.ResponseRecorder
+	codes []int
+}
+
+func (w *codeRecorder) WriteHeader(code int) {
+	w.codes = append(w.codes, code)
+	w.ResponseRecorder.WriteHeader(code)
+}
+
+func TestContextEarlyHintsWritten(t *testing.T) {
+	rest, err := New(new(TestEarlyHints))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("GET", "http://domain/late", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &codeRecorder{ResponseRecorder: httptest.NewRecorder()}
+	rest.ServeHTTP(w, req)
+	equal(t, w.codes, []int{http.StatusAccepted})
+	equal(t, w.Body.String(), "late")
+	equal(t, w.Header().Get("Link"), "")
+}
+
 func equalMap(a, b map[string]string) bool {
 	if len(a) != len(b) {
 		return false
@@ -131,3 +662,59 @@ func equalMap(a, b map[string]string) bool {
 	}
 	return true
 }
+
+type TestOnFinish struct {
+	Service
+
+	Node  Processor `method:"GET" path:"/node"`
+	Panic Processor `method:"GET" path:"/panic"`
+
+	events *[]string
+}
+
+func (r TestOnFinish) HandleNode() string {
+	r.OnFinish(func() { *r.events = append(*r.events, "first") })
+	r.OnFinish(func() { *r.events = append(*r.events, "second") })
+	*r.events = append(*r.events, "handle")
+	return "node"
+}
+
+func (r TestOnFinish) HandlePanic() string {
+	r.OnFinish(func() { *r.events = append(*r.events, "first") })
+	panic("fail")
+}
+
+func TestContextOnFinish(t *testing.T) {
+	type Test struct {
+		url string
+
+		body   string
+		panic  bool
+		events []string
+	}
+	var tests = []Test{
+		{"http://domain/node", "\"node\"\n", false, []string{"handle", "second", "first"}},
+		{"http://domain/panic", "", true, []string{"first"}},
+	}
+	var events []string
+	rest, err := New(&TestOnFinish{events: &events})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		events = nil
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		func() {
+			defer func() {
+				equal(t, recover() != nil, test.panic, "test %d", i)
+			}()
+			rest.ServeHTTP(w, req)
+		}()
+		equal(t, w.Body.String(), test.body, "test %d", i)
+		equal(t, events, test.events, "test %d", i)
+	}
+}
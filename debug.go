@@ -0,0 +1,29 @@
+package rest
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// EnableRouteDebug registers a GET endpoint at path under service prefix, which responses the json
+// list of Rest.Routes(). It's disabled by default, and the endpoint itself isn't listed in routes.
+func EnableRouteDebug(r *Rest, path string) error {
+	return r.addRoute(&route{
+		method:  "GET",
+		path:    pathToFormatter(r.Prefix(), path),
+		handler: &debugNode{r},
+	}, false)
+}
+
+type debugNode struct {
+	rest *Rest
+}
+
+func (n *debugNode) name() string {
+	return "RouteDebug"
+}
+
+func (n *debugNode) handle(instance reflect.Value, ctx *context) {
+	ctx.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(ctx.responseWriter).Encode(n.rest.Routes())
+}
@@ -0,0 +1,58 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type TestRouteKind struct {
+	Service `prefix:"/prefix"`
+
+	CreateHello Processor `method:"POST" path:"/hello"`
+	GetHello    Processor `method:"GET" path:"/hello/:to" func:"HandleHello"`
+	Watch       Streaming `method:"GET" path:"/hello/:to/streaming"`
+	Events      Streaming `method:"GET" path:"/hello/:to/events" framing:"sse" queue:"10" policy:"drop-oldest"`
+}
+
+func (r TestRouteKind) HandleCreateHello()    {}
+func (r TestRouteKind) HandleHello()          {}
+func (r TestRouteKind) HandleWatch(s Stream)  {}
+func (r TestRouteKind) HandleEvents(s Stream) {}
+
+func TestEnableRouteDebug(t *testing.T) {
+	rest, err := New(&TestRouteKind{})
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	routes := rest.Routes()
+	equal(t, routes, []RouteInfo{
+		{"POST", "/prefix/hello", "HandleCreateHello", "application/json", "processor", nil},
+		{"GET", "/prefix/hello/:to", "HandleHello", "application/json", "processor", nil},
+		{"GET", "/prefix/hello/:to/streaming", "HandleWatch", "application/json", "streaming", &StreamingInfo{"raw", 0, ""}},
+		{"GET", "/prefix/hello/:to/events", "HandleEvents", "application/json", "streaming", &StreamingInfo{"sse", 10, "drop-oldest"}},
+	})
+
+	req, err := http.NewRequest("GET", "http://domain/prefix/_routes", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	rest.ServeHTTP(w, req)
+	equal(t, w.Code, http.StatusNotFound)
+
+	err = EnableRouteDebug(rest, "/_routes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err = http.NewRequest("GET", "http://domain/prefix/_routes", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	rest.ServeHTTP(w, req)
+	equal(t, w.Code, http.StatusOK)
+	equal(t, w.Header().Get("Content-Type"), "application/json; charset=utf-8")
+	equal(t, w.Body.String(), `[{"method":"POST","path":"/prefix/hello","func":"HandleCreateHello","mime":"application/json","kind":"processor"},{"method":"GET","path":"/prefix/hello/:to","func":"HandleHello","mime":"application/json","kind":"processor"},{"method":"GET","path":"/prefix/hello/:to/streaming","func":"HandleWatch","mime":"application/json","kind":"streaming","streaming":{"framing":"raw"}},{"method":"GET","path":"/prefix/hello/:to/events","func":"HandleEvents","mime":"application/json","kind":"streaming","streaming":{"framing":"sse","queue":10,"policy":"drop-oldest"}}]`+"\n")
+	equal(t, len(rest.Routes()), 4)
+}
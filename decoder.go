@@ -0,0 +1,96 @@
+package rest
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"reflect"
+)
+
+/*
+StreamDecoder decodes json request body element by element, without reading whole body into memory.
+If processor's request parameter type is *rest.StreamDecoder, request body isn't unmarshalled, but
+passed to handler through StreamDecoder:
+
+	func (r Service) HandleImport(d *rest.StreamDecoder) {
+		for d.More() {
+			var item Item
+			if err := d.Decode(&item); err != nil {
+				r.Error(http.StatusBadRequest, r.DetailError(-1, "%s", err))
+				return
+			}
+			...
+		}
+	}
+
+If body is a json array, elements of array are decoded in order. Otherwise body is decoded as a sequence
+of json values, like newline delimited json.
+*/
+type StreamDecoder struct {
+	reader  *bufio.Reader
+	decoder *json.Decoder
+	inArray bool
+	started bool
+	err     error
+}
+
+var streamDecoderType = reflect.TypeOf((*StreamDecoder)(nil))
+
+func newStreamDecoder(r io.Reader) *StreamDecoder {
+	reader := bufio.NewReader(r)
+	decoder := json.NewDecoder(reader)
+	decoder.UseNumber()
+	return &StreamDecoder{
+		reader:  reader,
+		decoder: decoder,
+	}
+}
+
+func (d *StreamDecoder) start() {
+	d.started = true
+	for {
+		b, err := d.reader.Peek(1)
+		if err != nil {
+			if err != io.EOF {
+				d.err = err
+			}
+			return
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			d.reader.ReadByte()
+			continue
+		case '[':
+			d.inArray = true
+			_, d.err = d.decoder.Token()
+		}
+		return
+	}
+}
+
+// More reports whether there is another element to decode.
+func (d *StreamDecoder) More() bool {
+	if !d.started {
+		d.start()
+	}
+	if d.err != nil {
+		return false
+	}
+	return d.decoder.More()
+}
+
+// Decode decodes next element to v.
+func (d *StreamDecoder) Decode(v interface{}) error {
+	if !d.started {
+		d.start()
+	}
+	if d.err != nil {
+		return d.err
+	}
+	return d.decoder.Decode(v)
+}
+
+// Err returns the error met when reading the beginning of body.
+func (d *StreamDecoder) Err() error {
+	return d.err
+}
@@ -0,0 +1,76 @@
+package rest
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestStreamDecoder(t *testing.T) {
+	type Test struct {
+		body string
+
+		items []int
+		ok    bool
+	}
+	var tests = []Test{
+		{``, nil, true},
+		{`[]`, nil, true},
+		{` [1, 2 ,3]`, []int{1, 2, 3}, true},
+		{"1\n2\n3\n", []int{1, 2, 3}, true},
+		{`[1, "a"]`, []int{1}, false},
+	}
+	for i, test := range tests {
+		d := newStreamDecoder(bytes.NewBufferString(test.body))
+		var items []int
+		var err error
+		for d.More() {
+			var item int
+			if err = d.Decode(&item); err != nil {
+				break
+			}
+			items = append(items, item)
+		}
+		equal(t, items, test.items, "test %d", i)
+		equal(t, err == nil, test.ok, "test %d error: %s", i, err)
+	}
+}
+
+type FakeDecoder struct {
+	sum *int
+}
+
+func (f FakeDecoder) Sum(d *StreamDecoder) {
+	for d.More() {
+		var i int
+		if err := d.Decode(&i); err != nil {
+			return
+		}
+		*f.sum += i
+	}
+}
+
+func TestProcessorStreamDecoder(t *testing.T) {
+	s := FakeDecoder{new(int)}
+	instance := reflect.ValueOf(s)
+	f, _ := instance.Type().MethodByName("Sum")
+	node := processorNode{findex: f.Index}
+	equal(t, node.initArgs(f.Type, 1, "/"), nil)
+	equal(t, node.requestType, streamDecoderType)
+
+	req, err := http.NewRequest("POST", "http://fake.domain", bytes.NewBufferString("[1,2,3,4]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	ctx, err := newContext(w, req, nil, "application/json", "utf-8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	node.handle(instance, ctx)
+	equal(t, w.Code, http.StatusOK)
+	equal(t, fmt.Sprint(*s.sum), "10")
+}
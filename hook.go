@@ -0,0 +1,93 @@
+package rest
+
+import (
+	"net/http"
+	"reflect"
+)
+
+/*
+BeforeRequester is implemented by service which wants to run something before every handler, like
+opening a database transaction. If BeforeRequest returns error, request is aborted: if BeforeRequest
+doesn't reply error with Service.Error, it replies 500 Internal Server Error with the error.
+*/
+type BeforeRequester interface {
+	BeforeRequest(s Service) error
+}
+
+/*
+AfterRequester is implemented by service which wants to run something after every handler, like
+committing or rolling back a database transaction. It isn't called if BeforeRequest returns error.
+
+Argument err is the error replied by handler with Service.Error, or an error of status if handler wrote
+4xx or 5xx status with Service.WriteHeader, otherwise it's nil. A transaction can be used like:
+
+	func (r MyService) BeforeRequest(s rest.Service) error {
+		tx, err := r.db.Begin()
+		if err != nil {
+			return err
+		}
+		s.SetValue(txKey, tx)
+		return nil
+	}
+
+	func (r MyService) AfterRequest(s rest.Service, err error) {
+		tx := s.Value(txKey).(*sql.Tx)
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		tx.Commit()
+	}
+
+For streaming, AfterRequest is called after handler returns and the connection is closed.
+
+Service.Stats reports bytes read from request, bytes written to response, duration of request and
+the category of error, which can be recorded as metrics in AfterRequest:
+
+	func (r MyService) AfterRequest(s rest.Service, err error) {
+		stats := s.Stats()
+		requestBytes.Add(stats.BytesRead)
+		responseBytes.Add(stats.BytesWritten)
+		latency.Observe(stats.Duration.Seconds())
+		if err != nil {
+			errorCount.WithLabelValues(string(stats.ErrorCategory)).Inc()
+		}
+	}
+*/
+type AfterRequester interface {
+	AfterRequest(s Service, err error)
+}
+
+// hookInstance returns the instance which may implement hooks. Pointer is preferred, so hooks with
+// pointer receiver work.
+func hookInstance(instance reflect.Value) interface{} {
+	if !instance.IsValid() {
+		return nil
+	}
+	if instance.CanAddr() {
+		return instance.Addr().Interface()
+	}
+	return instance.Interface()
+}
+
+// beforeRequest calls BeforeRequest hook if exists, and returns whether request should continue.
+func beforeRequest(i interface{}, ctx *context) bool {
+	hook, ok := i.(BeforeRequester)
+	if !ok {
+		return true
+	}
+	err := hook.BeforeRequest(Service{ctx})
+	if err == nil {
+		return true
+	}
+	if !ctx.isError {
+		ctx.Error(http.StatusInternalServerError, err)
+	}
+	return false
+}
+
+func afterRequest(i interface{}, ctx *context) {
+	if hook, ok := i.(AfterRequester); ok {
+		hook.AfterRequest(Service{ctx}, ctx.result())
+	}
+}
@@ -0,0 +1,164 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type TestHook struct {
+	Service
+
+	Node Processor `method:"GET" path:"/node"`
+
+	calls []string
+}
+
+type hookKey struct{}
+
+func (r *TestHook) BeforeRequest(s Service) error {
+	r.calls = append(r.calls, "before")
+	s.SetValue(hookKey{}, "tx")
+	switch s.Request().URL.Query().Get("abort") {
+	case "error":
+		return errors.New("abort")
+	case "status":
+		s.Error(http.StatusUnauthorized, s.DetailError(1, "need auth"))
+		return errors.New("abort")
+	}
+	return nil
+}
+
+func (r *TestHook) AfterRequest(s Service, err error) {
+	if err != nil {
+		r.calls = append(r.calls, "rollback "+s.Value(hookKey{}).(string)+": "+err.Error())
+		return
+	}
+	r.calls = append(r.calls, "commit "+s.Value(hookKey{}).(string))
+}
+
+func (r TestHook) HandleNode() string {
+	switch r.Request().URL.Query().Get("fail") {
+	case "error":
+		r.Error(http.StatusConflict, errors.New("conflict"))
+	case "status":
+		r.WriteHeader(http.StatusNotFound)
+	}
+	return r.Context().Value(hookKey{}).(string)
+}
+
+func TestRestHook(t *testing.T) {
+	type Test struct {
+		url string
+
+		code  int
+		body  string
+		calls []string
+	}
+	var tests = []Test{
+		{"http://domain/node", http.StatusOK, "\"tx\"\n", []string{"before", "commit tx"}},
+		{"http://domain/node?fail=error", http.StatusConflict, "\"conflict\"\n", []string{"before", "rollback tx: conflict"}},
+		{"http://domain/node?fail=status", http.StatusNotFound, "\"tx\"\n", []string{"before", "rollback tx: 404 Not Found"}},
+		{"http://domain/node?abort=error", http.StatusInternalServerError, "\"abort\"\n", []string{"before"}},
+		{"http://domain/node?abort=status", http.StatusUnauthorized, "{\"code\":1,\"message\":\"need auth\"}\n", []string{"before"}},
+	}
+	instance := new(TestHook)
+	rest, err := New(instance)
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	for i, test := range tests {
+		instance.calls = nil
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+		equal(t, instance.calls, test.calls, "test %d", i)
+	}
+}
+
+type TestRouteMeta struct {
+	Service
+
+	Admin  Processor `method:"GET" path:"/admin" meta:"scope=admin; audit"`
+	Public Processor `method:"GET" path:"/public"`
+}
+
+func (r TestRouteMeta) BeforeRequest(s Service) error {
+	scope, ok := s.RouteMeta()["scope"]
+	if ok && s.Request().Header.Get("X-Scope") != scope {
+		s.Error(http.StatusForbidden, errors.New("scope "+scope+" required"))
+		return errors.New("forbidden")
+	}
+	return nil
+}
+
+func (r TestRouteMeta) HandleAdmin() map[string]string {
+	return r.RouteMeta()
+}
+
+func (r TestRouteMeta) HandlePublic() bool {
+	return r.RouteMeta() == nil
+}
+
+func TestRouteMetaHook(t *testing.T) {
+	type Test struct {
+		path  string
+		scope string
+
+		code int
+		body string
+	}
+	var tests = []Test{
+		{"/admin", "admin", http.StatusOK, "{\"audit\":\"\",\"scope\":\"admin\"}\n"},
+		{"/admin", "", http.StatusForbidden, "\"scope admin required\"\n"},
+		{"/public", "", http.StatusOK, "true\n"},
+	}
+	rest, err := New(new(TestRouteMeta))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", "http://domain"+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Scope", test.scope)
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+}
+
+func TestParseMeta(t *testing.T) {
+	type Test struct {
+		meta string
+
+		ret map[string]string
+		err string
+	}
+	var tests = []Test{
+		{"", nil, ""},
+		{"scope=admin;audit=true", map[string]string{"scope": "admin", "audit": "true"}, ""},
+		{" scope = admin ; ; flag ;", map[string]string{"scope": "admin", "flag": ""}, ""},
+		{"a=x=y", map[string]string{"a": "x=y"}, ""},
+		{"=admin", nil, "pair \"=admin\" has empty key"},
+		{"a=1;a=2", nil, "duplicate key a"},
+	}
+	for i, test := range tests {
+		ret, err := parseMeta(test.meta)
+		if test.err != "" {
+			equal(t, fmt.Sprintf("%v", err), test.err, "test %d", i)
+			continue
+		}
+		equal(t, err, nil, "test %d", i)
+		equal(t, ret, test.ret, "test %d", i)
+	}
+}
@@ -0,0 +1,205 @@
+package rest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// IdempotentResponse is the response of a request with Idempotency-Key, replayed to requests repeating
+// the key.
+type IdempotentResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+/*
+IdempotencyStore stores responses of requests with Idempotency-Key. See Idempotency.
+
+It should be safe for concurrent use. Reserve should check and reserve key atomically, otherwise two
+requests with same key may both run handler. Reservation in a store shared by several servers, like
+redis, should expire in time longer than the slowest handler, so a crashed server won't block the key
+forever. Saved response should be kept as long as clients may retry, like 24 hours, then it can be
+removed, and the key can be used again.
+*/
+type IdempotencyStore interface {
+	// Reserve reserves key for the request about to run handler, and returns ok true. If key has saved
+	// response, it returns the response and ok false. If key is reserved by another request in flight,
+	// it returns nil and ok false.
+	Reserve(key string) (resp *IdempotentResponse, ok bool, err error)
+	// Save saves the response of key reserved before, which also ends the reservation.
+	Save(key string, resp *IdempotentResponse) error
+	// Release ends the reservation of key without saving response, so the request can be retried.
+	Release(key string) error
+}
+
+/*
+Idempotency returns an Option setting Rest.IdempotencyStore, which makes POST and PATCH requests with
+Idempotency-Key header idempotent, like payments which mustn't be charged twice. The first request of a
+key runs handler and its response is saved in store. Repeated requests with the same key get the saved
+response, with header Idempotent-Replayed: true, instead of running handler again. While the first
+request is in flight, repeated ones get 409 Conflict.
+
+Keys are scoped by method, handler, request path and caller, see Rest.IdempotencyScope, so same key sent
+to different resources or by different callers doesn't conflict. Request body isn't compared, so client
+should use a new key for a different request. Responses of 5xx status aren't saved, so the request can
+be retried. Set-Cookie isn't saved, so a replayed response never carries the cookie of the first one.
+Response isn't compressed, so it can be replayed to any client. It only works with processors not
+returning channel.
+*/
+func Idempotency(store IdempotencyStore) Option {
+	return func(r *Rest) error {
+		r.IdempotencyStore = store
+		return nil
+	}
+}
+
+// idempotencyKey returns the key of ctx in idempotency store, if request should be idempotent.
+func (n *processorNode) idempotencyKey(ctx *context) (string, bool) {
+	if ctx.idempotency == nil || n.channel {
+		return "", false
+	}
+	if m := ctx.request.Method; m != http.MethodPost && m != http.MethodPatch {
+		return "", false
+	}
+	key := ctx.request.Header.Get("Idempotency-Key")
+	if key == "" {
+		return "", false
+	}
+	return fmt.Sprintf("%s %s %s %q %q", ctx.request.Method, ctx.name, ctx.request.URL.EscapedPath(), ctx.idempotencyScope(), key), true
+}
+
+// idempotencyScope returns the caller of request scoping idempotency keys. Without Rest.IdempotencyScope,
+// it's the hash of Authorization header, so the credential isn't kept in store.
+func (c *context) idempotencyScope() string {
+	if c.idemScope != nil {
+		return c.idemScope(c.request)
+	}
+	auth := c.request.Header.Get("Authorization")
+	if auth == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(auth))
+	return hex.EncodeToString(sum[:])
+}
+
+// handleIdempotent replays saved response of key if exists. Otherwise it calls handler, and saves the
+// response unless it's 5xx.
+func (n *processorNode) handleIdempotent(instance reflect.Value, ctx *context, key string) {
+	store := ctx.idempotency
+	resp, ok, err := store.Reserve(key)
+	if err != nil {
+		ctx.categoryError(CategoryServer, http.StatusInternalServerError, ctx.DetailError(-1, "reserve idempotency key failed: %s", err))
+		return
+	}
+	if !ok {
+		if resp == nil {
+			ctx.categoryError(CategoryConflict, http.StatusConflict, ctx.DetailError(-1, "request with same idempotency key is in progress"))
+			return
+		}
+		header := ctx.Header()
+		for k, v := range resp.Header {
+			header[k] = v
+		}
+		header.Set("Idempotent-Replayed", "true")
+		ctx.WriteHeader(resp.Status)
+		ctx.responseWriter.Write(resp.Body)
+		return
+	}
+
+	saved := false
+	defer func() {
+		if !saved {
+			store.Release(key)
+		}
+	}()
+	ctx.compresser = nil
+	w := &cacheWriter{ResponseWriter: ctx.responseWriter}
+	ctx.responseWriter = w
+	n.process(instance, ctx)
+	ctx.responseWriter = w.ResponseWriter
+	if ctx.written != 0 {
+		w.status = ctx.written
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.status >= 500 {
+		return
+	}
+	header := make(http.Header)
+	for k, v := range ctx.Header() {
+		if k == "Set-Cookie" {
+			continue
+		}
+		header[k] = append([]string(nil), v...)
+	}
+	saved = store.Save(key, &IdempotentResponse{
+		Status: w.status,
+		Header: header,
+		Body:   w.body.Bytes(),
+	}) == nil
+}
+
+// memoryIdempotencyStore keeps reservations and responses in memory.
+type memoryIdempotencyStore struct {
+	ttl     time.Duration
+	locker  sync.Mutex
+	entries map[string]*idempotencyEntry
+}
+
+// idempotencyEntry is a reservation if resp is nil, otherwise a saved response.
+type idempotencyEntry struct {
+	resp    *IdempotentResponse
+	expires time.Time
+}
+
+// NewMemoryIdempotencyStore returns an IdempotencyStore keeping responses in memory for ttl, which
+// only works with a single server. Reservation expires in ttl too.
+func NewMemoryIdempotencyStore(ttl time.Duration) IdempotencyStore {
+	return &memoryIdempotencyStore{
+		ttl:     ttl,
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+func (s *memoryIdempotencyStore) Reserve(key string) (*IdempotentResponse, bool, error) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	now := time.Now()
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		return e.resp, false, nil
+	}
+	s.entries[key] = &idempotencyEntry{expires: now.Add(s.ttl)}
+	return nil, true, nil
+}
+
+func (s *memoryIdempotencyStore) Save(key string, resp *IdempotentResponse) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	now := time.Now()
+	for k, e := range s.entries {
+		if now.After(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+	s.entries[key] = &idempotencyEntry{
+		resp:    resp,
+		expires: now.Add(s.ttl),
+	}
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(key string) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	if e, ok := s.entries[key]; ok && e.resp == nil {
+		delete(s.entries, key)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotency(t *testing.T) {
+	type Test struct {
+		method string
+		url    string
+		key    string
+		auth   string
+
+		code     int
+		body     string
+		replayed string
+		cookie   string
+	}
+	var tests = []Test{
+		{"POST", "http://domain/pay", "a", "", http.StatusCreated, "1\n", "", ""},
+		{"POST", "http://domain/pay", "a", "", http.StatusCreated, "1\n", "true", ""},
+		{"POST", "http://domain/pay", "b", "", http.StatusCreated, "2\n", "", ""},
+		{"POST", "http://domain/pay", "", "", http.StatusCreated, "3\n", "", ""},
+		{"PUT", "http://domain/pay", "a", "", http.StatusCreated, "4\n", "", ""},
+		{"POST", "http://domain/pay", "a", "Bearer alice", http.StatusCreated, "5\n", "", ""},
+		{"POST", "http://domain/pay", "a", "Bearer bob", http.StatusCreated, "6\n", "", ""},
+		{"POST", "http://domain/pay", "a", "Bearer alice", http.StatusCreated, "5\n", "true", ""},
+		{"POST", "http://domain/refund", "a", "", http.StatusOK, "\"refund\"\n", "", ""},
+		{"POST", "http://domain/fail", "a", "", http.StatusInternalServerError, "{\"code\":-1,\"message\":\"fail 1\"}\n", "", ""},
+		{"POST", "http://domain/fail", "a", "", http.StatusInternalServerError, "{\"code\":-1,\"message\":\"fail 2\"}\n", "", ""},
+		{"POST", "http://domain/order/1", "a", "", http.StatusOK, "\"order 1 1\"\n", "", "session=1"},
+		{"POST", "http://domain/order/2", "a", "", http.StatusOK, "\"order 2 2\"\n", "", "session=2"},
+		{"POST", "http://domain/order/1", "a", "", http.StatusOK, "\"order 1 1\"\n", "true", ""},
+	}
+	rest := NewRouter("/")
+	if err := Idempotency(NewMemoryIdempotencyStore(time.Minute))(rest); err != nil {
+		t.Fatal(err)
+	}
+	pays, fails := 0, 0
+	pay := func(s Service) int {
+		pays++
+		s.WriteHeader(http.StatusCreated)
+		return pays
+	}
+	if err := rest.POST("/pay", pay); err != nil {
+		t.Fatal(err)
+	}
+	if err := rest.PUT("/pay", pay); err != nil {
+		t.Fatal(err)
+	}
+	if err := rest.POST("/refund", func(s Service) string { return "refund" }); err != nil {
+		t.Fatal(err)
+	}
+	err := rest.POST("/fail", func(s Service) (string, error) {
+		fails++
+		return "", fmt.Errorf("fail %d", fails)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders := 0
+	err = rest.POST("/order/:id", func(s Service, id string) string {
+		orders++
+		s.Header().Set("Set-Cookie", fmt.Sprintf("session=%d", orders))
+		return fmt.Sprintf("order %s %d", id, orders)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest(test.method, test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.key != "" {
+			req.Header.Set("Idempotency-Key", test.key)
+		}
+		if test.auth != "" {
+			req.Header.Set("Authorization", test.auth)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+		equal(t, w.Header().Get("Idempotent-Replayed"), test.replayed, "test %d", i)
+		equal(t, w.Header().Get("Set-Cookie"), test.cookie, "test %d", i)
+	}
+}
+
+func TestIdempotencyInFlight(t *testing.T) {
+	rest := NewRouter("/")
+	rest.IdempotencyStore = NewMemoryIdempotencyStore(time.Minute)
+	started, done := make(chan bool), make(chan bool)
+	err := rest.POST("/pay", func(s Service) string {
+		started <- true
+		<-done
+		return "paid"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve := func() *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", "http://domain/pay", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Idempotency-Key", "a")
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		return w
+	}
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() {
+		first <- serve()
+	}()
+	<-started
+	w := serve()
+	equal(t, w.Code, http.StatusConflict)
+	close(done)
+	w = <-first
+	equal(t, w.Code, http.StatusOK)
+	equal(t, w.Body.String(), "\"paid\"\n")
+	w = serve()
+	equal(t, w.Code, http.StatusOK)
+	equal(t, w.Body.String(), "\"paid\"\n")
+	equal(t, w.Header().Get("Idempotent-Replayed"), "true")
+}
+
+// busyIdempotencyStore reports every key is reserved by another request in flight.
+type busyIdempotencyStore struct{}
+
+func (busyIdempotencyStore) Reserve(key string) (*IdempotentResponse, bool, error) {
+	return nil, false, nil
+}
+
+func (busyIdempotencyStore) Save(key string, resp *IdempotentResponse) error {
+	return nil
+}
+
+func (busyIdempotencyStore) Release(key string) error {
+	return nil
+}
+
+func TestIdempotencyConflictCategory(t *testing.T) {
+	instance := &TestErrorCategory{
+		stats: make(chan RequestStats, 1),
+	}
+	rest, err := New(instance, Idempotency(busyIdempotencyStore{}))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	req, err := http.NewRequest("POST", "http://domain/echo", strings.NewReader("\"hello\""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Idempotency-Key", "a")
+	w := httptest.NewRecorder()
+	rest.ServeHTTP(w, req)
+	equal(t, w.Code, http.StatusConflict)
+	stats := <-instance.stats
+	equal(t, stats.ErrorCategory, CategoryConflict)
+}
+
+func TestIdempotencyScope(t *testing.T) {
+	type Test struct {
+		user string
+		auth string
+
+		body     string
+		replayed string
+	}
+	var tests = []Test{
+		{"alice", "token 1", "1\n", ""},
+		{"alice", "token 2", "1\n", "true"},
+		{"bob", "token 1", "2\n", ""},
+	}
+	rest := NewRouter("/")
+	rest.IdempotencyStore = NewMemoryIdempotencyStore(time.Minute)
+	rest.IdempotencyScope = func(r *http.Request) string {
+		return r.Header.Get("X-User")
+	}
+	pays := 0
+	if err := rest.POST("/pay", func(s Service) int { pays++; return pays }); err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("POST", "http://domain/pay", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Idempotency-Key", "a")
+		req.Header.Set("X-User", test.user)
+		req.Header.Set("Authorization", test.auth)
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+		equal(t, w.Header().Get("Idempotent-Replayed"), test.replayed, "test %d", i)
+	}
+}
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	store := NewMemoryIdempotencyStore(time.Millisecond * 50)
+	resp, ok, err := store.Reserve("a")
+	equal(t, resp == nil, true)
+	equal(t, ok, true)
+	equal(t, err, nil)
+	_, ok, _ = store.Reserve("a")
+	equal(t, ok, false)
+	store.Release("a")
+	_, ok, _ = store.Reserve("a")
+	equal(t, ok, true)
+	store.Save("a", &IdempotentResponse{Status: http.StatusOK, Body: []byte("ok")})
+	resp, ok, _ = store.Reserve("a")
+	equal(t, ok, false)
+	equal(t, string(resp.Body), "ok")
+	store.Release("a")
+	resp, ok, _ = store.Reserve("a")
+	equal(t, ok, false)
+	equal(t, resp != nil, true)
+
+	time.Sleep(time.Millisecond * 60)
+	_, ok, _ = store.Reserve("a")
+	equal(t, ok, true)
+}
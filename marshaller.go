@@ -12,6 +12,13 @@ type Marshaller interface {
 	Error(code int, message string) error
 }
 
+// BinaryMarshaller may be implemented by Marshaller to tell whether it marshals binary data, like
+// protobuf or msgpack. Content-Type of binary mime has no charset parameter. Marshaller not
+// implementing it is treated as text.
+type BinaryMarshaller interface {
+	Binary() bool
+}
+
 // Register a marshaller with corresponding mime.
 func RegisterMarshaller(mime string, marshaller Marshaller) {
 	marshallers[mime] = marshaller
@@ -30,23 +37,123 @@ func getMarshaller(mime string) (Marshaller, bool) {
 	return ret, ok
 }
 
+// mimeContentType returns Content-Type of mime with charset, unless mime has a binary marshaller or
+// charset is empty.
+func mimeContentType(mime, charset string) string {
+	if m, ok := getMarshaller(mime); ok {
+		if b, ok := m.(BinaryMarshaller); ok && b.Binary() {
+			return mime
+		}
+	}
+	if charset == "" {
+		return mime
+	}
+	return fmt.Sprintf("%s; charset=%s", mime, charset)
+}
+
 // The marshaller using json.
-type JsonMarshaller struct{}
+//
+// If DisallowUnknownFields is true, unmarshalling a request which has a field not defined in
+// target struct will fail, and the error names the unknown field.
+//
+// MaxDepth limits nesting depth of objects and arrays in request, so deeply nested request can't
+// exhaust the decoder. Request exceeding it fails, which is replied with 400 Bad Request. 0 means 64,
+// and negative means no limit.
+type JsonMarshaller struct {
+	DisallowUnknownFields bool
+	MaxDepth              int
+}
+
+const defaultMaxDepth = 64
 
 func (j JsonMarshaller) Marshal(w io.Writer, name string, v interface{}) error {
 	encoder := json.NewEncoder(w)
 	return encoder.Encode(v)
 }
 
+// Unmarshal decodes v from r with json.Decoder, which reads r directly without copying the body to a
+// separate buffer first, but still buffers the whole top-level json value before decoding it. Wrap the
+// request body with http.MaxBytesReader to bound the memory.
 func (j JsonMarshaller) Unmarshal(r io.Reader, v interface{}) error {
+	max := j.MaxDepth
+	if max == 0 {
+		max = defaultMaxDepth
+	}
+	if max > 0 {
+		r = &depthReader{reader: r, max: max}
+	}
 	decoder := json.NewDecoder(r)
 	decoder.UseNumber()
-	return decoder.Decode(v)
+	if j.DisallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	err := decoder.Decode(v)
+	if e, ok := err.(*json.UnmarshalTypeError); ok && e.Field != "" {
+		return FieldError{
+			Field:  e.Field,
+			Offset: e.Offset,
+			Expect: e.Type.String(),
+			Got:    e.Value,
+		}
+	}
+	return err
+}
+
+// depthReader fails reading json when nesting depth of objects and arrays exceeds max. It scans bytes
+// while they are read, so json isn't parsed twice.
+type depthReader struct {
+	reader   io.Reader
+	max      int
+	depth    int
+	inString bool
+	escaped  bool
+}
+
+func (r *depthReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	for _, c := range p[:n] {
+		switch {
+		case r.escaped:
+			r.escaped = false
+		case r.inString:
+			switch c {
+			case '\\':
+				r.escaped = true
+			case '"':
+				r.inString = false
+			}
+		case c == '"':
+			r.inString = true
+		case c == '{' || c == '[':
+			r.depth++
+			if r.depth > r.max {
+				return 0, fmt.Errorf("json nesting depth exceeds %d", r.max)
+			}
+		case c == '}' || c == ']':
+			r.depth--
+		}
+	}
+	return n, err
+}
+
+// FieldError is returned by JsonMarshaller.Unmarshal when a field of request has a wrong type.
+// Field is the dotted path of the field in request, like "user.name". The error body replied
+// to client carries the field too.
+type FieldError struct {
+	Field  string
+	Offset int64
+	Expect string
+	Got    string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("field %s expects %s but got %s at offset %d", e.Field, e.Expect, e.Got, e.Offset)
 }
 
 type jsonError struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
+	Field   string `json:"field,omitempty"`
 }
 
 func (e jsonError) Error() string {
@@ -54,5 +161,5 @@ func (e jsonError) Error() string {
 }
 
 func (j JsonMarshaller) Error(code int, message string) error {
-	return jsonError{code, message}
+	return jsonError{Code: code, Message: message}
 }
@@ -0,0 +1,173 @@
+package rest
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestJsonMarshallerUnmarshal(t *testing.T) {
+	type Arg struct {
+		To   string `json:"to"`
+		Post string `json:"post"`
+	}
+	type Test struct {
+		strict bool
+		body   string
+
+		ok  bool
+		arg Arg
+		err string
+	}
+	var tests = []Test{
+		{false, `{"to":"rest","post":"hello"}`, true, Arg{"rest", "hello"}, ""},
+		{false, `{"to":"rest","pots":"hello"}`, true, Arg{"rest", ""}, ""},
+		{true, `{"to":"rest","post":"hello"}`, true, Arg{"rest", "hello"}, ""},
+		{true, `{"to":"rest","pots":"hello"}`, false, Arg{}, `json: unknown field "pots"`},
+	}
+	for i, test := range tests {
+		marshaller := JsonMarshaller{DisallowUnknownFields: test.strict}
+		var arg Arg
+		err := marshaller.Unmarshal(bytes.NewBufferString(test.body), &arg)
+		equal(t, err == nil, test.ok, fmt.Sprintf("test %d error: %s", i, err))
+		if err != nil {
+			equal(t, err.Error(), test.err, "test %d", i)
+			continue
+		}
+		equal(t, arg, test.arg, "test %d", i)
+	}
+}
+
+func TestJsonMarshallerFieldError(t *testing.T) {
+	type Inner struct {
+		Name string `json:"name"`
+	}
+	type Arg struct {
+		User Inner `json:"user"`
+	}
+	type Test struct {
+		body string
+
+		field string
+		ok    bool
+	}
+	var tests = []Test{
+		{`{"user":{"name":"rest"}}`, "", true},
+		{`{"user":{"name":1}}`, "user.name", false},
+		{`{"user":"rest"}`, "user", false},
+		{`"rest"`, "", false},
+	}
+	for i, test := range tests {
+		var arg Arg
+		err := JsonMarshaller{}.Unmarshal(bytes.NewBufferString(test.body), &arg)
+		equal(t, err == nil, test.ok, "test %d error: %s", i, err)
+		fe, _ := err.(FieldError)
+		equal(t, fe.Field, test.field, "test %d", i)
+	}
+}
+
+func TestJsonMarshallerMaxDepth(t *testing.T) {
+	type Test struct {
+		max  int
+		body string
+
+		err string
+	}
+	var tests = []Test{
+		{0, strings.Repeat("[", 64) + strings.Repeat("]", 64), ""},
+		{0, strings.Repeat("[", 65) + strings.Repeat("]", 65), "json nesting depth exceeds 64"},
+		{2, `{"a":[1]}`, ""},
+		{2, `{"a":[{}]}`, "json nesting depth exceeds 2"},
+		{2, `{"a":"[[[{{{"}`, ""},
+		{2, `{"a":"\\\"[[["}`, ""},
+		{-1, strings.Repeat("[", 100) + strings.Repeat("]", 100), ""},
+	}
+	for i, test := range tests {
+		var arg interface{}
+		err := JsonMarshaller{MaxDepth: test.max}.Unmarshal(bytes.NewBufferString(test.body), &arg)
+		if test.err == "" {
+			equal(t, err, nil, "test %d", i)
+			continue
+		}
+		if err == nil {
+			t.Errorf("test %d should fail", i)
+			continue
+		}
+		equal(t, err.Error(), test.err, "test %d", i)
+	}
+}
+
+func TestJsonMarshallerUnmarshalAllocs(t *testing.T) {
+	body := `{"name":"` + strings.Repeat("a", 100*1024) + `"}`
+	allocs := testing.AllocsPerRun(10, func() {
+		var arg struct {
+			Name string `json:"name"`
+		}
+		JsonMarshaller{}.Unmarshal(bytes.NewBufferString(body), &arg)
+	})
+	if allocs > 50 {
+		t.Errorf("unmarshal 100KB body allocs %v times, should be no more than 50", allocs)
+	}
+}
+
+func BenchmarkJsonMarshallerUnmarshal(b *testing.B) {
+	body := "[" + strings.Repeat("12345,", 100*1024/6) + "1]"
+	b.ReportAllocs()
+	b.SetBytes(int64(len(body)))
+	for i := 0; i < b.N; i++ {
+		var arg []int
+		err := JsonMarshaller{}.Unmarshal(bytes.NewBufferString(body), &arg)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+type FakeBinaryMarshaller struct {
+	FakeMarshaller
+}
+
+func (m FakeBinaryMarshaller) Binary() bool {
+	return true
+}
+
+func TestMimeContentType(t *testing.T) {
+	type Test struct {
+		mime    string
+		charset string
+
+		contentType string
+	}
+	var tests = []Test{
+		{"application/json", "utf-8", "application/json; charset=utf-8"},
+		{"application/json", "", "application/json"},
+		{"text/x-fake", "utf-8", "text/x-fake; charset=utf-8"},
+		{"application/x-fake-binary", "utf-8", "application/x-fake-binary"},
+		{"application/x-unknown", "utf-8", "application/x-unknown; charset=utf-8"},
+	}
+	RegisterMarshaller("text/x-fake", FakeMarshaller{})
+	defer delete(marshallers, "text/x-fake")
+	RegisterMarshaller("application/x-fake-binary", FakeBinaryMarshaller{})
+	defer delete(marshallers, "application/x-fake-binary")
+	for i, test := range tests {
+		equal(t, mimeContentType(test.mime, test.charset), test.contentType, "test %d", i)
+	}
+
+	rest, err := New(new(TestErrorStatus))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("GET", "http://domain/node/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/x-fake-binary")
+	w := httptest.NewRecorder()
+	rest.ServeHTTP(w, req)
+	equal(t, w.Code, http.StatusOK)
+	equal(t, w.Header().Get("Content-Type"), "application/x-fake-binary")
+	equal(t, w.Body.String(), "<1>")
+}
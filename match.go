@@ -0,0 +1,58 @@
+package rest
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// MatchFunc matches request r by custom rules, like a header with path. If r matches, it returns ok
+// true and arguments captured from r.
+type MatchFunc func(r *http.Request) (args []string, ok bool)
+
+type matcher struct {
+	match MatchFunc
+	route *route
+}
+
+/*
+HandleMatch registers function fn as a processor of requests matched by match, for routing which
+method and path can't express. It should be called before serving.
+
+Match functions are tried in registered order, before routes of method and path. Arguments returned by
+match are in Service.Vars(), keyed by their indexes like "0", "1", and in Service.Captures() as they
+are. Function fn is same as the one of HandleFunc, without path parameters.
+*/
+func (r *Rest) HandleMatch(match MatchFunc, fn interface{}) error {
+	node, err := funcNode(fn, "", "match function")
+	if err != nil {
+		return err
+	}
+	rt, err := newRoute("", "", node.name_, node, "")
+	if err != nil {
+		return err
+	}
+	rt.funcName = node.name_
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.matchers = append(r.matchers, matcher{match, rt})
+	return nil
+}
+
+// matchRoute returns the route of the first match function which matches req, with its arguments.
+func (r *Rest) matchRoute(req *http.Request) (*route, map[string]string) {
+	r.mu.RLock()
+	matchers := r.matchers
+	r.mu.RUnlock()
+	for _, m := range matchers {
+		args, ok := m.match(req)
+		if !ok {
+			continue
+		}
+		vars := make(map[string]string, len(args))
+		for i, arg := range args {
+			vars[strconv.Itoa(i)] = arg
+		}
+		return m.route, vars
+	}
+	return nil, nil
+}
@@ -0,0 +1,110 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRestHandleMatch(t *testing.T) {
+	type Test struct {
+		url     string
+		version string
+
+		code int
+		body string
+	}
+	var tests = []Test{
+		{"http://domain/prefix/node/123", "", http.StatusOK, ""},
+		{"http://domain/prefix/node/123", "v2", http.StatusOK, "\"v2 /prefix/node/123\"\n"},
+		{"http://domain/other", "v2", http.StatusOK, "\"v2 /other\"\n"},
+		{"http://domain/other", "", http.StatusNotFound, ""},
+	}
+	rest, err := New(new(TestPost))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	err = rest.HandleMatch(func(r *http.Request) ([]string, bool) {
+		version := r.Header.Get("X-Version")
+		if !strings.HasPrefix(version, "v") {
+			return nil, false
+		}
+		return []string{version, r.URL.Path}, true
+	}, func(s Service) string {
+		return s.Vars()["0"] + " " + s.Vars()["1"]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, rest.HandleMatch(nil, "not function") != nil, true)
+
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.version != "" {
+			req.Header.Set("X-Version", test.version)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+}
+
+func TestServiceCaptures(t *testing.T) {
+	type Test struct {
+		url     string
+		version string
+
+		body string
+	}
+	var tests = []Test{
+		{"http://domain/t/acme/node/123/a%20b/c", "", "[\"acme\",\"123\",\"a b/c\"]\n"},
+		{"http://domain/t/acme/plain", "", "[\"acme\"]\n"},
+		{"http://domain/other", "v2", "[\"v2\",\"/other\"]\n"},
+		{"http://domain/other", "v", "null\n"},
+	}
+	rest := NewRouter("/t/:tenant")
+	err := rest.GET("/node/:id/*rest", func(s Service, id, rest string) []string {
+		return s.Captures()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rest.GET("/plain", func(s Service) []string {
+		return s.Captures()
+	}); err != nil {
+		t.Fatal(err)
+	}
+	err = rest.HandleMatch(func(r *http.Request) ([]string, bool) {
+		switch version := r.Header.Get("X-Version"); version {
+		case "":
+			return nil, false
+		case "v":
+			return nil, true
+		default:
+			return []string{version, r.URL.Path}, true
+		}
+	}, func(s Service) []string {
+		return s.Captures()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.version != "" {
+			req.Header.Set("X-Version", test.version)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, http.StatusOK, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+}
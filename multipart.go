@@ -0,0 +1,111 @@
+package rest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+)
+
+// ErrMultipartStarted is returned by Service.Multipart if response status is already written.
+var ErrMultipartStarted = errors.New("response status is written before multipart")
+
+// MultipartWriter writes parts of a multipart response, created by Service.Multipart.
+type MultipartWriter struct {
+	ctx    *context
+	writer *multipart.Writer
+	closed bool
+}
+
+/*
+Multipart replies a multipart response of subtype, like "mixed" or "related", whose Content-Type is
+"multipart/<subtype>; boundary=...". It lets handler send several parts with their own headers, like
+metadata in json followed by a binary blob, instead of base64 in json:
+
+	func (r MyService) HandleExport() {
+		mw, err := r.Multipart("mixed")
+		if err != nil {
+			return
+		}
+		mw.MarshalPart(r.meta())
+		part, _ := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"image/png"}})
+		part.Write(r.image())
+		mw.Close()
+	}
+
+Status is 200 OK unless handler sets one with Service.SetStatus. If response has started, like status or
+body is written, Content-Type can't carry the boundary, so it returns ErrMultipartStarted. Value returned by handler isn't marshalled.
+Handler should call Close after the last part to write the closing boundary, otherwise it's written after
+handler returns.
+*/
+func (c *context) Multipart(subtype string) (*MultipartWriter, error) {
+	if c.Written() {
+		return nil, ErrMultipartStarted
+	}
+	c.replied = true
+	w := multipart.NewWriter(c.responseWriter)
+	c.Header().Set("Content-Type", "multipart/"+subtype+"; boundary="+w.Boundary())
+	c.Header().Del("Content-Length")
+	if c.pendingStatus == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	ret := &MultipartWriter{
+		ctx:    c,
+		writer: w,
+	}
+	c.multipart = ret
+	return ret, nil
+}
+
+// Boundary returns the boundary separating parts.
+func (w *MultipartWriter) Boundary() string {
+	return w.writer.Boundary()
+}
+
+// CreatePart starts a new part with header, and returns the writer of its body. Previous part is
+// ended, so its writer shouldn't be used any more.
+func (w *MultipartWriter) CreatePart(header textproto.MIMEHeader) (io.Writer, error) {
+	if w.closed {
+		return nil, errors.New("multipart response is closed")
+	}
+	return w.writer.CreatePart(header)
+}
+
+// MarshalPart writes v as a new part, marshalled with the mime of response negotiated by Accept header,
+// like the value returned by handler.
+func (w *MultipartWriter) MarshalPart(v interface{}) error {
+	marshaller, ok := getMarshaller(w.ctx.mime)
+	if !ok {
+		return errors.New("can't find marshaller for" + w.ctx.mime)
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := marshaller.Marshal(buf, w.ctx.name, v); err != nil {
+		return err
+	}
+	part, err := w.CreatePart(textproto.MIMEHeader{"Content-Type": {w.ctx.contentType()}})
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(buf.Bytes())
+	return err
+}
+
+// Flush sends parts written so far to client.
+func (w *MultipartWriter) Flush() {
+	if f := findFlusher(w.ctx.responseWriter); f != nil {
+		f.Flush()
+	}
+}
+
+// Close writes the closing boundary and flushes response. Calling it more than once does nothing.
+func (w *MultipartWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	err := w.writer.Close()
+	w.Flush()
+	return err
+}
@@ -0,0 +1,130 @@
+package rest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+)
+
+func TestMultipart(t *testing.T) {
+	type Test struct {
+		path string
+
+		code  int
+		parts [][2]string // pairs of Content-Type and body
+	}
+	var tests = []Test{
+		{"/export", http.StatusOK, [][2]string{
+			{"application/json; charset=utf-8", "{\"name\":\"a.png\"}\n"},
+			{"image/png", "\x89PNG"},
+		}},
+		{"/unclosed", http.StatusAccepted, [][2]string{
+			{"text/plain", "hello"},
+		}},
+	}
+	rest := NewRouter("/")
+	err := rest.GET("/export", func(s Service) string {
+		mw, err := s.Multipart("mixed")
+		if err != nil {
+			t.Error(err)
+		}
+		if err := mw.MarshalPart(map[string]string{"name": "a.png"}); err != nil {
+			t.Error(err)
+		}
+		part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"image/png"}})
+		if err != nil {
+			t.Error(err)
+		}
+		part.Write([]byte("\x89PNG"))
+		if err := mw.Close(); err != nil {
+			t.Error(err)
+		}
+		if _, err := mw.CreatePart(nil); err == nil {
+			t.Error("create part after close should fail")
+		}
+		return "ignored"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rest.GET("/unclosed", func(s Service) {
+		s.SetStatus(http.StatusAccepted)
+		mw, err := s.Multipart("related")
+		if err != nil {
+			t.Error(err)
+		}
+		part, _ := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain"}})
+		part.Write([]byte("hello"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rest.GET("/written", func(s Service) string {
+		s.WriteHeader(http.StatusOK)
+		_, err := s.Multipart("mixed")
+		return fmt.Sprintf("%v", err)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("GET", "http://domain/written", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	rest.ServeHTTP(w, req)
+	equal(t, w.Body.String(), "\"response status is written before multipart\"\n")
+	var rawErr error
+	err = rest.GET("/raw", func(s Service) {
+		s.SetStatus(http.StatusAccepted)
+		s.WriteRaw("text/plain", []byte("hi"))
+		_, rawErr = s.Multipart("mixed")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err = http.NewRequest("GET", "http://domain/raw", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	rest.ServeHTTP(w, req)
+	equal(t, rawErr, ErrMultipartStarted)
+	equal(t, w.Code, http.StatusAccepted)
+	equal(t, w.Body.String(), "hi")
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", "http://domain"+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		equal(t, mediaType[:len("multipart/")], "multipart/", "test %d", i)
+		reader := multipart.NewReader(w.Body, params["boundary"])
+		var parts [][2]string
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				// closing boundary makes it io.EOF, otherwise it's unexpected EOF.
+				equal(t, err.Error(), "EOF", "test %d", i)
+				break
+			}
+			body, err := ioutil.ReadAll(part)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parts = append(parts, [2]string{part.Header.Get("Content-Type"), string(body)})
+		}
+		equal(t, parts, test.parts, "test %d", i)
+	}
+}
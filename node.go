@@ -1,16 +1,28 @@
 package rest
 
 import (
+	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httputil"
 	"reflect"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var invalidHandler = errors.New("invalid handler")
 
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+var headerType = reflect.TypeOf(http.Header(nil))
+
+// tupleType is the response type of handler returning several responses, which are marshalled as an array.
+var tupleType = reflect.TypeOf([]interface{}(nil))
+
 type pathFormatter string
 
 func pathToFormatter(prefix, path string) pathFormatter {
@@ -29,11 +41,21 @@ func pathToFormatter(prefix, path string) pathFormatter {
 	return pathFormatter(prefix + path)
 }
 
-// Generate the path of url to processor. Map args fill parameters in path.
+// changePrefix returns path f under prefix to instead of prefix from.
+func changePrefix(f pathFormatter, from, to string) pathFormatter {
+	if from == to {
+		return f
+	}
+	return pathToFormatter(to, strings.TrimPrefix(string(f), string(pathToFormatter(from, ""))))
+}
+
+// Generate the path of url to processor. Map args fill parameters in path, including the ones of
+// service prefix.
 func (f pathFormatter) PathMap(args map[string]string) string {
 	ret := string(f)
 	for k, v := range args {
 		ret = strings.Replace(ret, ":"+k, v, -1)
+		ret = strings.Replace(ret, "{"+k+"}", v, -1)
 	}
 	return ret
 }
@@ -56,6 +78,76 @@ func (f pathFormatter) Path(params ...string) string {
 	return f.PathMap(m)
 }
 
+// params returns names of parameters in path, by order.
+func (f pathFormatter) params() []string {
+	var ret []string
+	for _, s := range strings.Split(string(f), "/") {
+		if len(s) > 1 && (s[0] == ':' || s[0] == '*') {
+			ret = append(ret, s[1:])
+		}
+	}
+	return ret
+}
+
+// prefixParams returns names of parameters in service prefix of path, like tenant of "/t/{tenant}/api",
+// by order. They aren't captured by handler arguments.
+func (f pathFormatter) prefixParams() []string {
+	var ret []string
+	for _, s := range strings.Split(string(f), "/") {
+		if isPrefixParam(s) {
+			ret = append(ret, s[1:len(s)-1])
+		}
+	}
+	return ret
+}
+
+// captureNames returns names of all parameters in path, including the ones of service prefix, by order.
+func (f pathFormatter) captureNames() []string {
+	var ret []string
+	for _, s := range strings.Split(string(f), "/") {
+		switch {
+		case isPrefixParam(s):
+			ret = append(ret, s[1:len(s)-1])
+		case len(s) > 1 && (s[0] == ':' || s[0] == '*'):
+			ret = append(ret, s[1:])
+		}
+	}
+	return ret
+}
+
+func isPrefixParam(segment string) bool {
+	return len(segment) > 2 && segment[0] == '{' && segment[len(segment)-1] == '}'
+}
+
+// routerPath converts parameters of service prefix in path p, like "{tenant}", to the form of router.
+func routerPath(p string) string {
+	if !strings.Contains(p, "{") {
+		return p
+	}
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		if isPrefixParam(s) {
+			segments[i] = ":" + s[1:len(s)-1]
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// findHandler finds handler method fname of node field. It returns clear error if method is unexported
+// or has pointer receiver, which can't be called.
+func findHandler(instance reflect.Type, field, fname string) (reflect.Method, error) {
+	if f, ok := instance.MethodByName(fname); ok {
+		return f, nil
+	}
+	if c := fname[0]; 'a' <= c && c <= 'z' {
+		return reflect.Method{}, fmt.Errorf("%s's handler %s is unexported, export it as %s", field, fname, strings.ToUpper(fname[:1])+fname[1:])
+	}
+	if _, ok := reflect.PtrTo(instance).MethodByName(fname); ok {
+		return reflect.Method{}, fmt.Errorf("%s's handler %s has pointer receiver, define it with value receiver", field, fname)
+	}
+	return reflect.Method{}, fmt.Errorf("can't find handler: %s", fname)
+}
+
 type node interface {
 	init(formatter pathFormatter, instance reflect.Type, name string, tag reflect.StructTag) ([]handler, []pathFormatter, error)
 }
@@ -82,11 +174,111 @@ func (w *processorWriter) Write(p []byte) (int, error) {
 	return w.writer.Write(p)
 }
 
+// Flush flushes compressed data and the underlying response, so client gets what is written so far.
+func (w *processorWriter) Flush() {
+	if f, ok := w.writer.(interface {
+		Flush() error
+	}); ok {
+		f.Flush()
+	}
+	if f := findFlusher(w.resp); f != nil {
+		f.Flush()
+	}
+}
+
+// findFlusher returns the first http.Flusher of w and the writers it wraps, which are found by method
+// Unwrap() http.ResponseWriter like http.ResponseController does. It returns nil if there isn't one,
+// which happens when a middleware wrapper hides it.
+func findFlusher(w http.ResponseWriter) http.Flusher {
+	for w != nil {
+		if f, ok := w.(http.Flusher); ok {
+			return f
+		}
+		u, ok := w.(interface {
+			Unwrap() http.ResponseWriter
+		})
+		if !ok {
+			return nil
+		}
+		w = u.Unwrap()
+	}
+	return nil
+}
+
+// findHijacker is like findFlusher, but returns http.Hijacker.
+func findHijacker(w http.ResponseWriter) http.Hijacker {
+	for w != nil {
+		if hj, ok := w.(http.Hijacker); ok {
+			return hj
+		}
+		u, ok := w.(interface {
+			Unwrap() http.ResponseWriter
+		})
+		if !ok {
+			return nil
+		}
+		w = u.Unwrap()
+	}
+	return nil
+}
+
+// canFlush returns whether flushing w reaches client. Wrappers of this package always have method Flush,
+// so they are looked through.
+func canFlush(w http.ResponseWriter) bool {
+	for {
+		switch rw := w.(type) {
+		case *countResponseWriter:
+			w = rw.ResponseWriter
+		case *tapResponseWriter:
+			w = rw.ResponseWriter
+		case *processorWriter:
+			w = rw.resp
+		default:
+			return findFlusher(w) != nil
+		}
+	}
+}
+
+// compressResponse wraps response writer of ctx with the compresser negotiated with client, if any.
+// Returned closer isn't nil if response is compressed, and should be closed after writing response.
+func compressResponse(ctx *context) io.Closer {
+	if ctx.compresser == nil {
+		return nil
+	}
+	c, err := ctx.compresser.Writer(ctx.responseWriter)
+	if err != nil {
+		return nil
+	}
+	ctx.responseWriter.Header().Set("Content-Encoding", ctx.compresser.Name())
+	ctx.responseWriter = &processorWriter{
+		resp:   ctx.responseWriter,
+		writer: c,
+	}
+	return c
+}
+
 type processorNode struct {
 	name_        string
 	findex       int
+	fn           reflect.Value
+	args         string
+	pathNames    []string
+	pathTypes    []reflect.Type
 	requestType  reflect.Type
+	bindings     []binding
+	form         bool
 	responseType reflect.Type
+	returnHeader bool
+	returnError  bool
+	tuple        int
+	buffered     bool
+	channel      bool
+	streams      []string
+	end          string
+	framing      string
+	cache        time.Duration
+	// timeout overrides Rest.HandlerTimeout if it isn't 0, and negative one disables it.
+	timeout time.Duration
 }
 
 func (n *processorNode) name() string {
@@ -94,51 +286,571 @@ func (n *processorNode) name() string {
 }
 
 func (n *processorNode) handle(instance reflect.Value, ctx *context) {
-	if ctx.compresser != nil {
-		c, err := ctx.compresser.Writer(ctx.responseWriter)
-		if err == nil {
-			defer c.Close()
-			ctx.responseWriter.Header().Set("Content-Encoding", ctx.compresser.Name())
-			ctx.responseWriter = &processorWriter{
-				resp:   ctx.responseWriter,
-				writer: c,
-			}
+	if d := n.handlerTimeout(ctx); d > 0 {
+		n.handleTimeout(instance, ctx, d)
+		return
+	}
+	n.serve(instance, ctx)
+}
+
+// serve replies request with idempotent or cached response if possible, otherwise processes it.
+func (n *processorNode) serve(instance reflect.Value, ctx *context) {
+	if key, ok := n.idempotencyKey(ctx); ok {
+		n.handleIdempotent(instance, ctx, key)
+		return
+	}
+	if n.cacheable(ctx) {
+		n.handleCached(instance, ctx)
+		return
+	}
+	n.process(instance, ctx)
+}
+
+// process calls handler with arguments from request, and writes its return value to response.
+func (n *processorNode) process(instance reflect.Value, ctx *context) {
+	defer func() {
+		// status set by Service.SetStatus is written when body starts, or here if there's no body.
+		if ctx.pendingStatus != 0 {
+			ctx.WriteHeader(ctx.pendingStatus)
 		}
+	}()
+	if c := compressResponse(ctx); c != nil {
+		defer c.Close()
 	}
 
 	// args := []reflect.Value{instance}
 	var args []reflect.Value
-	if n.requestType != nil {
+	for i, name := range n.pathNames {
+		arg, err := pathArg(ctx.vars[name], n.pathTypes[i])
+		if err != nil {
+			ctx.categoryError(CategoryDecode, http.StatusBadRequest, ctx.DetailError(-1, "invalid parameter %s: %s", name, err))
+			return
+		}
+		args = append(args, arg)
+	}
+	if n.requestType == streamDecoderType {
+		args = append(args, reflect.ValueOf(newStreamDecoder(ctx.request.Body)))
+	} else if n.requestType != nil {
 		request := reflect.New(n.requestType)
 		marshaller, ok := getMarshaller(ctx.requestMime)
 		if !ok {
+			ctx.category = CategoryDecode
 			http.Error(ctx.responseWriter, "can't find marshaller for"+ctx.mime, http.StatusBadRequest)
 			return
 		}
-		err := marshaller.Unmarshal(ctx.request.Body, request.Interface())
+		var err error
+		if n.form && isForm(ctx.request) {
+			// form fields are bound instead of unmarshalled.
+			if err := parseForm(ctx.request, ctx.formMemory); err != nil {
+				if form := ctx.request.MultipartForm; form != nil {
+					form.RemoveAll()
+				}
+				ctx.categoryError(CategoryDecode, bodyErrorStatus(err), ctx.DetailError(-1, "parse form failed: %s", err))
+				return
+			}
+			if form := ctx.request.MultipartForm; form != nil {
+				defer form.RemoveAll()
+			}
+		} else if optional := n.optionalBody(ctx); !optional || (ctx.request.Body != nil && ctx.request.ContentLength != 0) {
+			err = marshaller.Unmarshal(ctx.request.Body, request.Interface())
+			if err == io.EOF && optional {
+				err = nil
+			}
+		}
 		if err != nil {
-			ctx.Error(http.StatusBadRequest, ctx.DetailError(-1, "marshal request to %s failed: %s", n.requestType.Name(), err))
+			e := ctx.DetailError(-1, "marshal request to %s failed: %s", n.requestType.Name(), err)
+			if fe, ok := err.(FieldError); ok {
+				if je, ok := e.(jsonError); ok {
+					je.Field = fe.Field
+					e = je
+				}
+			}
+			ctx.categoryError(CategoryDecode, bodyErrorStatus(err), e)
+			return
+		}
+		if err := bind(ctx, request.Elem(), n.bindings); err != nil {
+			ctx.categoryError(CategoryDecode, http.StatusBadRequest, ctx.DetailError(-1, "%s", err))
 			return
 		}
 		args = append(args, request.Elem())
 	}
 
-	ret := instance.Method(n.findex).Call(args)
+	ret := n.call(instance, ctx, args)
+	if ctx.multipart != nil {
+		// end multipart response which handler doesn't close.
+		ctx.multipart.Close()
+	}
 
-	if ctx.isError || len(ret) == 0 {
+	if n.returnError {
+		if err := ret[len(ret)-1]; !err.IsNil() {
+			if !ctx.isError {
+				ctx.handlerError(err.Interface().(error))
+			}
+			return
+		}
+		ret = ret[:len(ret)-1]
+	}
+	if ctx.isError || ctx.replied || len(ret) == 0 {
 		return
 	}
+	if n.returnHeader {
+		for k, values := range ret[len(ret)-1].Interface().(http.Header) {
+			ctx.Header()[k] = values
+		}
+	}
+	if n.channel {
+		if len(n.streams) == 0 {
+			n.writeChannel(ctx, ret[0], n.framing)
+			return
+		}
+		ctx.Header().Add("Vary", "Accept")
+		switch mime := acceptedStream(ctx.request, n.streams); mime {
+		case "":
+			n.writeCollected(ctx, ret[0])
+		case "text/event-stream":
+			n.writeChannel(ctx, ret[0], "sse")
+		default:
+			ctx.Header().Set("Content-Type", mime)
+			n.writeChannel(ctx, ret[0], "")
+		}
+		return
+	}
+	if ctx.ctx.Err() != nil {
+		// client has gone, don't write to a dead connection.
+		return
+	}
+	if n.tuple > 0 {
+		values := make([]interface{}, n.tuple)
+		for i := range values {
+			values[i] = ret[i].Interface()
+		}
+		n.writeResponse(ctx, 0, values)
+		return
+	}
+
+	v := ret[0].Interface()
+	status := 0
+	if result, ok := v.(Result); ok {
+		for k, values := range result.Headers {
+			ctx.Header()[k] = values
+		}
+		status, v = result.Status, result.Body
+		if v == nil {
+			if status != 0 {
+				ctx.WriteHeader(status)
+			}
+			return
+		}
+	}
+	n.writeResponse(ctx, status, v)
+}
+
+// optionalBody returns whether request of ctx may have no body, leaving request value zero. Request
+// bound from other sources may have no body, and so may DELETE request, which carries a body only
+// sometimes, like filters of bulk deletion.
+func (n *processorNode) optionalBody(ctx *context) bool {
+	return len(n.bindings) > 0 || ctx.request.Method == http.MethodDelete
+}
 
+// writeResponse marshals v to response. If status isn't 0, it's written before response body.
+// If v is an io.ReadSeeker, it's served by http.ServeContent. If v is an io.WriterTo or a render
+// function, it writes itself to response without marshalling.
+func (n *processorNode) writeResponse(ctx *context, status int, v interface{}) {
+	if r, ok := v.(io.ReadSeeker); ok && (status == 0 || status == http.StatusOK) {
+		serveContent(ctx, r)
+		return
+	}
+	if ctx.sniff {
+		if r, ok := rawBody(v); ok {
+			writeSniffed(ctx, status, r)
+			return
+		}
+	}
+	if w, ok := v.(io.WriterTo); ok {
+		if status != 0 {
+			ctx.WriteHeader(status)
+		}
+		if _, err := w.WriteTo(ctx.responseWriter); err != nil {
+			ctx.err = err
+			ctx.Logger().Printf("write response failed: %s", err)
+		}
+		return
+	}
+	if render, ok := v.(func(io.Writer) error); ok {
+		writeRendered(ctx, status, render)
+		return
+	}
+	if ctx.transform != nil {
+		v = ctx.transform(v, Service{ctx})
+	}
+	if ctx.wrapper != nil {
+		v = ctx.wrapper(v, Service{ctx})
+	}
 	marshaller, ok := getMarshaller(ctx.mime)
 	if !ok {
+		ctx.category = CategoryEncode
 		http.Error(ctx.responseWriter, "can't find marshaller for"+ctx.mime, http.StatusBadRequest)
 		return
 	}
-	err := marshaller.Marshal(ctx.responseWriter, ctx.name, ret[0].Interface())
+	// compressed length is only known after compresser closed, so don't buffer it.
+	if !n.buffered || ctx.compresser != nil {
+		if status != 0 {
+			ctx.WriteHeader(status)
+		}
+		err := marshaller.Marshal(ctx.responseWriter, ctx.name, v)
+		if err != nil {
+			ctx.categoryError(CategoryEncode, http.StatusInternalServerError, ctx.DetailError(-1, "marshal response to %s failed: %s", reflect.TypeOf(v).Name(), err))
+		}
+		return
+	}
+	buf := bytes.NewBuffer(nil)
+	err := marshaller.Marshal(buf, ctx.name, v)
 	if err != nil {
-		ctx.Error(http.StatusInternalServerError, ctx.DetailError(-1, "marshal response to %s failed: %s", ret[0].Type().Name(), err))
+		ctx.categoryError(CategoryEncode, http.StatusInternalServerError, ctx.DetailError(-1, "marshal response to %s failed: %s", reflect.TypeOf(v).Name(), err))
 		return
 	}
+	ctx.responseWriter.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	if status != 0 {
+		ctx.WriteHeader(status)
+	}
+	ctx.responseWriter.Write(buf.Bytes())
+}
+
+// writeChannel writes values received from channel ch as frames of stream with framing, until ch is
+// closed. Each frame is flushed to client immediately. If client has gone, ch is drained in background
+// so sender won't block.
+func (n *processorNode) writeChannel(ctx *context, ch reflect.Value, framing string) {
+	if ctx.ctx.Err() != nil {
+		go drain(ch)
+		return
+	}
+	stream, err := newStream(ctx, nil, n.end, framing)
+	if err != nil {
+		ctx.categoryError(CategoryEncode, http.StatusInternalServerError, ctx.DetailError(-1, "%s", err))
+		go drain(ch)
+		return
+	}
+	if !canFlush(ctx.responseWriter) {
+		ctx.Logger().Printf("response writer doesn't implement http.Flusher, which channel response needs")
+		ctx.categoryError(CategoryServer, http.StatusInternalServerError, ctx.DetailError(-1, "webserver doesn't support flushing"))
+		go drain(ch)
+		return
+	}
+	stream.transform = true
+	if framing == "sse" {
+		ctx.Header().Set("Content-Type", "text/event-stream")
+	}
+	ctx.WriteHeader(http.StatusOK)
+	if ch.IsNil() {
+		return
+	}
+	flusher := findFlusher(ctx.responseWriter)
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: ch},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.ctx.Done())},
+	}
+	for {
+		chosen, v, ok := reflect.Select(cases)
+		if chosen == 1 {
+			go drain(ch)
+			return
+		}
+		if !ok {
+			return
+		}
+		if err := stream.Write(v.Interface()); err != nil {
+			go drain(ch)
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// writeCollected receives values from channel ch until it's closed, and writes them as an array in one
+// response. If client has gone, ch is drained in background so sender won't block.
+func (n *processorNode) writeCollected(ctx *context, ch reflect.Value) {
+	values := reflect.MakeSlice(reflect.SliceOf(ch.Type().Elem()), 0, 0)
+	if !ch.IsNil() {
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: ch},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.ctx.Done())},
+		}
+		for {
+			chosen, v, ok := reflect.Select(cases)
+			if chosen == 1 {
+				go drain(ch)
+				return
+			}
+			if !ok {
+				break
+			}
+			values = reflect.Append(values, v)
+		}
+	}
+	n.writeResponse(ctx, 0, values.Interface())
+}
+
+// acceptedStream returns the first mime in Accept header of r which is in streams, or "" if there isn't
+// one.
+func acceptedStream(r *http.Request, streams []string) string {
+	for _, mime := range acceptedValues(r.Header.Get("Accept")) {
+		if inList(streams, mime) {
+			return mime
+		}
+	}
+	return ""
+}
+
+// drain receives from channel ch until it's closed.
+func drain(ch reflect.Value) {
+	if ch.IsNil() {
+		return
+	}
+	for {
+		if _, ok := ch.Recv(); !ok {
+			return
+		}
+	}
+}
+
+// serveContent writes r to response with http.ServeContent, which handles Range and conditional
+// requests with name and modtime set by Service.SetContentInfo. Compressed response is sent as a whole,
+// ignoring Range.
+func serveContent(ctx *context, r io.ReadSeeker) {
+	if ctx.Header().Get("Content-Type") == ctx.contentType() {
+		ctx.Header().Del("Content-Type")
+	}
+	req := ctx.request
+	if ctx.compresser != nil {
+		req = req.Clone(req.Context())
+		req.Header.Del("Range")
+	}
+	http.ServeContent(contentWriter{ctx}, req, ctx.contentName, ctx.contentModTime, r)
+}
+
+// contentWriter writes response through ctx, so status is recorded.
+type contentWriter struct {
+	ctx *context
+}
+
+func (w contentWriter) Header() http.Header {
+	return w.ctx.Header()
+}
+
+func (w contentWriter) WriteHeader(code int) {
+	if w.ctx.compresser != nil {
+		// length of compressed body is unknown.
+		w.ctx.Header().Del("Content-Length")
+	}
+	w.ctx.WriteHeader(code)
+}
+
+func (w contentWriter) Write(p []byte) (int, error) {
+	return w.ctx.responseWriter.Write(p)
+}
+
+// writeRendered calls render to write response body. Error of render is replied if nothing is written
+// yet, otherwise it's logged. If request context is done, like client has gone, render isn't called.
+func writeRendered(ctx *context, status int, render func(io.Writer) error) {
+	if err := ctx.ctx.Err(); err != nil {
+		ctx.err = err
+		return
+	}
+	w := &renderWriter{ctx: ctx, status: status}
+	err := render(w)
+	if err == nil {
+		if !w.started && status != 0 {
+			ctx.WriteHeader(status)
+		}
+		return
+	}
+	if !w.started {
+		ctx.handlerError(err)
+		return
+	}
+	ctx.err = err
+	ctx.Logger().Printf("render response failed after body started: %s", err)
+}
+
+// renderWriter writes status before the first byte of body, so render failing before writing
+// anything can still reply an error.
+type renderWriter struct {
+	ctx     *context
+	status  int
+	started bool
+}
+
+func (w *renderWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		if w.status != 0 {
+			w.ctx.WriteHeader(w.status)
+		}
+	}
+	return w.ctx.responseWriter.Write(p)
+}
+
+// rawBody returns the reader of v if v is []byte or io.Reader.
+func rawBody(v interface{}) (io.Reader, bool) {
+	switch b := v.(type) {
+	case []byte:
+		return bytes.NewReader(b), true
+	case io.Reader:
+		return b, true
+	}
+	return nil, false
+}
+
+// writeSniffed writes r to response. If handler doesn't change Content-Type, it's detected from the
+// beginning of r.
+func writeSniffed(ctx *context, status int, r io.Reader) {
+	reader := bufio.NewReaderSize(r, 512)
+	if ctx.Header().Get("Content-Type") == ctx.contentType() {
+		head, _ := reader.Peek(512)
+		ctx.Header().Set("Content-Type", http.DetectContentType(head))
+	}
+	if status != 0 {
+		ctx.WriteHeader(status)
+	}
+	io.Copy(ctx.responseWriter, reader)
+}
+
+// initReturns sets response type from function type ft. Function may return a response, an error, or
+// a response following by an error, and http.Header may follow response, before error. Several
+// responses are marshalled as an array in order, like a tuple.
+func (n *processorNode) initReturns(ft reflect.Type) error {
+	out := ft.NumOut()
+	if out > 0 && ft.Out(out-1) == errorType {
+		n.returnError = true
+		out--
+	}
+	if out > 1 && ft.Out(out-1) == headerType {
+		n.returnHeader = true
+		out--
+	}
+	switch out {
+	case 0:
+	case 1:
+		n.setResponseType(ft.Out(0))
+	default:
+		for i := 0; i < out; i++ {
+			switch t := ft.Out(i); {
+			case t == errorType || t == headerType:
+				return fmt.Errorf("processor(%s) return values should be responses, http.Header and error, in order.", n.name_)
+			case t.Kind() == reflect.Chan:
+				return fmt.Errorf("processor(%s) channel can't be returned with other responses.", n.name_)
+			}
+		}
+		n.responseType = tupleType
+		n.tuple = out
+	}
+	return nil
+}
+
+// setResponseType sets response type t. If t is a receivable channel, response is streamed.
+func (n *processorNode) setResponseType(t reflect.Type) {
+	n.responseType = t
+	n.channel = t.Kind() == reflect.Chan && t.ChanDir()&reflect.RecvDir != 0
+}
+
+// initArgs sets path parameter and request types from function type ft, whose parameters start from
+// offset. Leading parameters of kind string or int, as many as path parameters, capture path parameters,
+// in the order of n.args if set. The next one, if exists, is unmarshalled from request body.
+func (n *processorNode) initArgs(ft reflect.Type, offset int, formatter pathFormatter) error {
+	names, err := argNames(formatter, n.args)
+	if err != nil {
+		return fmt.Errorf("processor(%s) %s", n.name_, err)
+	}
+	in := ft.NumIn() - offset
+	// A lone parameter of processor is unmarshalled from body, unless tag args names the lone path
+	// parameter it captures. Function handlers always capture.
+	lone := in == 1 && len(names) == 1 && n.args == "" && !n.fn.IsValid()
+	if len(names) > 0 && in >= len(names) && !lone {
+		var types []reflect.Type
+		for i := range names {
+			if t := ft.In(offset + i); isPathKind(t.Kind()) {
+				types = append(types, t)
+			}
+		}
+		if len(types) == len(names) {
+			n.pathNames, n.pathTypes = names, types
+		}
+	}
+	if n.args != "" && len(n.pathTypes) == 0 {
+		return fmt.Errorf("processor(%s) leading %d input parameters should be of kind string or int to capture args %s", n.name_, len(names), n.args)
+	}
+	switch in - len(n.pathTypes) {
+	case 0:
+	case 1:
+		n.requestType = ft.In(ft.NumIn() - 1)
+		bindings, err := newBindings(n.requestType, append(formatter.prefixParams(), names...), n.name_)
+		if err != nil {
+			return err
+		}
+		n.bindings = bindings
+		n.form = bindsForm(bindings)
+	default:
+		if len(n.pathTypes) > 0 {
+			return fmt.Errorf("processer(%s) input parameters should be no more than 1 besides path parameters.", n.name_)
+		}
+		return fmt.Errorf("processer(%s) input parameters should be no more than 1.", n.name_)
+	}
+	return nil
+}
+
+// argNames returns path parameters of formatter in the order of args, like "key,id", which names the
+// path parameter each leading handler parameter captures. Without args, it's the order in path.
+func argNames(formatter pathFormatter, args string) ([]string, error) {
+	names := formatter.params()
+	if args == "" {
+		return names, nil
+	}
+	list := splitList(args)
+	if len(list) != len(names) {
+		return nil, fmt.Errorf("args %s should list each parameter of path %s once", args, formatter)
+	}
+	for i, name := range list {
+		if !inList(names, name) || inList(list[:i], name) {
+			return nil, fmt.Errorf("args %s should list each parameter of path %s once", args, formatter)
+		}
+	}
+	return list, nil
+}
+
+func isPathKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// pathArg converts path parameter s to type t, which kind is string or int.
+func pathArg(s string, t reflect.Type) (reflect.Value, error) {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(i).Convert(t), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(s, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(i).Convert(t), nil
+	}
+	return reflect.ValueOf(s).Convert(t), nil
+}
+
+// call calls the handler with args. A function handler gets Service as first argument.
+func (n *processorNode) call(instance reflect.Value, ctx *context, args []reflect.Value) []reflect.Value {
+	if n.fn.IsValid() {
+		return n.fn.Call(append([]reflect.Value{reflect.ValueOf(Service{ctx})}, args...))
+	}
+	return instance.Method(n.findex).Call(args)
 }
 
 type streamingWriter struct {
@@ -162,6 +874,8 @@ func (w *streamingWriter) WriteHeader(code int) {
 	if w.writedHeader {
 		return
 	}
+	w.Header().Del("Content-Length")
+	w.Header().Set("Transfer-Encoding", "chunked")
 	w.writer.Write([]byte(fmt.Sprintf("HTTP/1.1 %d %s\r\n", code, http.StatusText(code))))
 	w.Header().Write(w.writer)
 	w.writer.Write([]byte("\r\n"))
@@ -172,7 +886,15 @@ type streamingNode struct {
 	name_       string
 	findex      int
 	end         string
+	framing     string
+	queue       int
+	policy      string
+	wrap        bool
+	transform   bool
+	pathNames   []string
+	pathTypes   []reflect.Type
 	requestType reflect.Type
+	bindings    []binding
 }
 
 func (n *streamingNode) name() string {
@@ -180,54 +902,99 @@ func (n *streamingNode) name() string {
 }
 
 func (n *streamingNode) handle(instance reflect.Value, ctx *context) {
-	hj, ok := ctx.responseWriter.(http.Hijacker)
-	if !ok {
-		ctx.Error(http.StatusInternalServerError, ctx.DetailError(-1, "webserver doesn't support hijacking"))
+	var pathArgs []reflect.Value
+	for i, name := range n.pathNames {
+		arg, err := pathArg(ctx.vars[name], n.pathTypes[i])
+		if err != nil {
+			ctx.categoryError(CategoryDecode, http.StatusBadRequest, ctx.DetailError(-1, "invalid parameter %s: %s", name, err))
+			return
+		}
+		pathArgs = append(pathArgs, arg)
+	}
+	hj := findHijacker(ctx.responseWriter)
+	if hj == nil {
+		ctx.categoryError(CategoryServer, http.StatusInternalServerError, ctx.DetailError(-1, "webserver doesn't support hijacking"))
 		return
 	}
 	conn, _, err := hj.Hijack()
 	if err != nil {
-		ctx.Error(http.StatusInternalServerError, ctx.DetailError(-1, "%s", err))
+		ctx.categoryError(CategoryServer, http.StatusInternalServerError, ctx.DetailError(-1, "%s", err))
 		return
 	}
 	defer conn.Close()
 
+	chunked := httputil.NewChunkedWriter(conn)
+	body := &countWriter{chunked, &ctx.bytesWritten}
 	resp := &processorWriter{
 		resp:   ctx.responseWriter,
-		writer: conn,
+		writer: body,
 	}
 
+	var compresser io.WriteCloser
 	if ctx.compresser != nil {
-		c, err := ctx.compresser.Writer(conn)
+		c, err := ctx.compresser.Writer(body)
 		if err == nil {
-			defer c.Close()
+			compresser = c
 			ctx.responseWriter.Header().Set("Content-Encoding", ctx.compresser.Name())
 			resp.writer = c
 		}
 	}
 
-	ctx.responseWriter = &streamingWriter{
+	writer := &streamingWriter{
 		writer:       conn,
 		resp:         resp,
 		writedHeader: false,
 	}
+	ctx.responseWriter = writer
+	defer func() {
+		writer.WriteHeader(http.StatusOK)
+		if compresser != nil {
+			compresser.Close()
+		}
+		chunked.Close()
+		conn.Write([]byte("\r\n"))
+	}()
+
+	if n.framing == "sse" {
+		ctx.responseWriter.Header().Set("Content-Type", "text/event-stream")
+	}
 
-	stream, err := newStream(ctx, conn, n.end)
+	stream, err := newStream(ctx, conn, n.end, n.framing)
 	if err != nil {
-		ctx.Error(http.StatusBadRequest, ctx.DetailError(-1, "%s", err))
+		ctx.categoryError(CategoryEncode, http.StatusBadRequest, ctx.DetailError(-1, "%s", err))
+	}
+	stream.wrap = n.wrap
+	stream.transform = n.transform
+	if n.queue > 0 {
+		stream.queue = newStreamQueue(ctx.responseWriter, n.queue, n.policy)
+		defer stream.queue.close()
 	}
 
-	args := []reflect.Value{reflect.ValueOf(stream).Elem()}
-	if n.requestType != nil {
+	args := append(pathArgs, reflect.ValueOf(stream).Elem())
+	if n.requestType == streamDecoderType {
+		args = append(args, reflect.ValueOf(newStreamDecoder(ctx.request.Body)))
+	} else if n.requestType != nil {
 		request := reflect.New(n.requestType)
 		marshaller, ok := getMarshaller(ctx.requestMime)
 		if !ok {
+			ctx.category = CategoryDecode
 			http.Error(ctx.responseWriter, "can't find marshaller for"+ctx.mime, http.StatusBadRequest)
 			return
 		}
-		err := marshaller.Unmarshal(ctx.request.Body, request.Interface())
+		var err error
+		// request bound from other sources may have no body.
+		if len(n.bindings) == 0 || (ctx.request.Body != nil && ctx.request.ContentLength != 0) {
+			err = marshaller.Unmarshal(ctx.request.Body, request.Interface())
+			if err == io.EOF && len(n.bindings) > 0 {
+				err = nil
+			}
+		}
 		if err != nil {
-			ctx.Error(http.StatusBadRequest, ctx.DetailError(-1, fmt.Sprintf("marshal request to %s failed: %s", n.requestType.Name(), err)))
+			ctx.categoryError(CategoryDecode, bodyErrorStatus(err), ctx.DetailError(-1, fmt.Sprintf("marshal request to %s failed: %s", n.requestType.Name(), err)))
+			return
+		}
+		if err := bind(ctx, request.Elem(), n.bindings); err != nil {
+			ctx.categoryError(CategoryDecode, http.StatusBadRequest, ctx.DetailError(-1, "%s", err))
 			return
 		}
 		request = reflect.Indirect(request)
@@ -236,4 +1003,5 @@ func (n *streamingNode) handle(instance reflect.Value, ctx *context) {
 
 	ctx.responseWriter.Header().Set("Connection", "keep-alive")
 	instance.Method(n.findex).Call(args)
+	stream.Flush()
 }
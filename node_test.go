@@ -2,11 +2,15 @@ package rest
 
 import (
 	"bytes"
+	gocontext "context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestMapFormatter(t *testing.T) {
@@ -124,6 +128,379 @@ func TestProcessorNodeHandle(t *testing.T) {
 	}
 }
 
+func TestProcessorNodePathArgs(t *testing.T) {
+	type Test struct {
+		method string
+		path   pathFormatter
+		args   string
+		vars   map[string]string
+		body   string
+
+		code  int
+		input string
+	}
+	s := new(FakeProcessor)
+	instance := reflect.ValueOf(s).Elem()
+	var tests = []Test{
+		{"PathArgs", "/:id/:slug", "", map[string]string{"id": "123", "slug": "abc"}, "", http.StatusOK, "123 abc"},
+		// without args, path parameters are captured by order, not by name.
+		{"PathArgs", "/:slug/:id", "", map[string]string{"id": "abc", "slug": "123"}, "", http.StatusOK, "123 abc"},
+		{"PathArgs", "/:slug/:id", "id,slug", map[string]string{"id": "123", "slug": "abc"}, "", http.StatusOK, "123 abc"},
+		{"PathArgs", "/:id/:slug", "", map[string]string{"id": "abc", "slug": "abc"}, "", http.StatusBadRequest, ""},
+		{"PathArgs", "/:slug/:id", "id,slug", map[string]string{"id": "abc", "slug": "123"}, "", http.StatusBadRequest, ""},
+		{"PathArgsPost", "/:id", "", map[string]string{"id": "1"}, `"post"`, http.StatusOK, "1 post"},
+		{"PathArgsPost", "/:id", "id", map[string]string{"id": "1"}, `"post"`, http.StatusOK, "1 post"},
+		// a lone parameter is unmarshalled from body, unless args names the path parameter.
+		{"Normal", "/:id", "", map[string]string{"id": "1"}, `"post"`, http.StatusOK, "post"},
+		{"Normal", "/:id", "id", map[string]string{"id": "1"}, `"post"`, http.StatusOK, "1"},
+	}
+	for i, test := range tests {
+		s.last = make(map[string]string)
+		f, ok := instance.Type().MethodByName(test.method)
+		if !ok {
+			t.Fatalf("no %s", test.method)
+		}
+		node := &processorNode{findex: f.Index, args: test.args}
+		err := node.initArgs(f.Type, 1, test.path)
+		equal(t, err, nil, "test %d", i)
+		req, err := http.NewRequest("GET", "http://fake.domain", bytes.NewBufferString(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		ctx, err := newContext(w, req, test.vars, "application/json", "utf-8")
+		if err != nil {
+			t.Fatal(err)
+		}
+		node.handle(instance, ctx)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, s.last["input"], test.input, "test %d", i)
+	}
+}
+
+func TestArgNames(t *testing.T) {
+	type Test struct {
+		path pathFormatter
+		args string
+
+		names []string
+		err   string
+	}
+	var tests = []Test{
+		{"/", "", nil, ""},
+		{"/:id/:slug", "", []string{"id", "slug"}, ""},
+		{"/:id/:slug", "slug, id", []string{"slug", "id"}, ""},
+		{"/{tenant}/:id", "id", []string{"id"}, ""},
+		{"/:id/:slug", "id", nil, "args id should list each parameter of path /:id/:slug once"},
+		{"/:id/:slug", "id,id", nil, "args id,id should list each parameter of path /:id/:slug once"},
+		{"/:id/:slug", "id,key", nil, "args id,key should list each parameter of path /:id/:slug once"},
+		{"/", "id", nil, "args id should list each parameter of path / once"},
+	}
+	for i, test := range tests {
+		names, err := argNames(test.path, test.args)
+		if test.err != "" {
+			equal(t, fmt.Sprintf("%v", err), test.err, "test %d", i)
+			continue
+		}
+		equal(t, err, nil, "test %d", i)
+		equal(t, names, test.names, "test %d", i)
+	}
+}
+
+func TestProcessorNodeBuffered(t *testing.T) {
+	type Test struct {
+		buffered bool
+		encoding string
+
+		length string
+		body   string
+	}
+	s := new(FakeProcessor)
+	s.last = make(map[string]string)
+	instance := reflect.ValueOf(s).Elem()
+	ni, ok := instance.Type().MethodByName("NoInput")
+	if !ok {
+		t.Fatal("no NoInput")
+	}
+	var tests = []Test{
+		{true, "", "9", "\"output\"\n"},
+		{false, "", "", "\"output\"\n"},
+		{true, "gzip", "", ""},
+	}
+	for i, test := range tests {
+		node := processorNode{
+			findex:       ni.Index,
+			responseType: reflect.TypeOf(""),
+			buffered:     test.buffered,
+		}
+		req, err := http.NewRequest("GET", "http://fake.domain", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.encoding != "" {
+			req.Header.Set("Accept-Encoding", test.encoding)
+		}
+		w := httptest.NewRecorder()
+		ctx, err := newContext(w, req, nil, "application/json", "utf-8")
+		if err != nil {
+			t.Fatal(err)
+		}
+		node.handle(instance, ctx)
+		equal(t, w.Header().Get("Content-Length"), test.length, "test %d", i)
+		if test.body != "" {
+			equal(t, w.Body.String(), test.body, "test %d", i)
+		}
+	}
+}
+
+func TestProcessorNodeChannel(t *testing.T) {
+	type Test struct {
+		framing string
+		cancel  bool
+
+		contentType string
+		body        string
+	}
+	s := new(FakeProcessor)
+	instance := reflect.ValueOf(s).Elem()
+	ch, ok := instance.Type().MethodByName("Channel")
+	if !ok {
+		t.Fatal("no Channel")
+	}
+	var tests = []Test{
+		{"", false, "", "1\n2\n3\n"},
+		{"sse", false, "text/event-stream", "data: 1\n\ndata: 2\n\ndata: 3\n\n"},
+		{"", true, "", ""},
+	}
+	for i, test := range tests {
+		node := processorNode{
+			findex:       ch.Index,
+			responseType: reflect.TypeOf((<-chan int)(nil)),
+			channel:      true,
+			framing:      test.framing,
+		}
+		req, err := http.NewRequest("GET", "http://fake.domain", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.cancel {
+			c, cancel := gocontext.WithCancel(req.Context())
+			cancel() // client disconnects
+			req = req.WithContext(c)
+		}
+		w := httptest.NewRecorder()
+		ctx, err := newContext(w, req, nil, "application/json", "utf-8")
+		if err != nil {
+			t.Fatal(err)
+		}
+		node.handle(instance, ctx)
+		equal(t, w.Header().Get("Content-Type"), test.contentType, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+}
+
+// hiddenFlushWriter hides http.Flusher of ResponseWriter, like some middleware wrappers.
+type hiddenFlushWriter struct {
+	w http.ResponseWriter
+}
+
+func (w hiddenFlushWriter) Header() http.Header         { return w.w.Header() }
+func (w hiddenFlushWriter) Write(p []byte) (int, error) { return w.w.Write(p) }
+func (w hiddenFlushWriter) WriteHeader(code int)        { w.w.WriteHeader(code) }
+
+// unwrapFlushWriter is hiddenFlushWriter which exposes the wrapped ResponseWriter.
+type unwrapFlushWriter struct {
+	hiddenFlushWriter
+}
+
+func (w unwrapFlushWriter) Unwrap() http.ResponseWriter { return w.w }
+
+func TestProcessorNodeChannelFlusher(t *testing.T) {
+	type Test struct {
+		wrap func(http.ResponseWriter) http.ResponseWriter
+
+		code int
+		body string
+	}
+	s := new(FakeProcessor)
+	instance := reflect.ValueOf(s).Elem()
+	ch, ok := instance.Type().MethodByName("Channel")
+	if !ok {
+		t.Fatal("no Channel")
+	}
+	plain := func(w http.ResponseWriter) http.ResponseWriter { return w }
+	hidden := func(w http.ResponseWriter) http.ResponseWriter { return hiddenFlushWriter{w} }
+	unwrap := func(w http.ResponseWriter) http.ResponseWriter { return unwrapFlushWriter{hiddenFlushWriter{w}} }
+	tap := func(w http.ResponseWriter) http.ResponseWriter {
+		return &tapResponseWriter{ResponseWriter: hiddenFlushWriter{w}}
+	}
+	var tests = []Test{
+		{plain, http.StatusOK, "1\n2\n3\n"},
+		{hidden, http.StatusInternalServerError, ""},
+		{unwrap, http.StatusOK, "1\n2\n3\n"},
+		{tap, http.StatusInternalServerError, ""},
+	}
+	for i, test := range tests {
+		node := processorNode{
+			findex:       ch.Index,
+			responseType: reflect.TypeOf((<-chan int)(nil)),
+			channel:      true,
+		}
+		req, err := http.NewRequest("GET", "http://fake.domain", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		ctx, err := newContext(test.wrap(w), req, nil, "application/json", "utf-8")
+		if err != nil {
+			t.Fatal(err)
+		}
+		node.handle(instance, ctx)
+		equal(t, w.Code, test.code, "test %d", i)
+		if test.code == http.StatusOK {
+			equal(t, w.Body.String(), test.body, "test %d", i)
+			equal(t, w.Flushed, true, "test %d", i)
+		}
+	}
+}
+
+type TestChannelStream struct {
+	Service
+
+	List Processor `method:"GET" path:"/list" stream:"application/x-ndjson, text/event-stream"`
+}
+
+func (r TestChannelStream) HandleList() <-chan int {
+	ch := make(chan int, 3)
+	ch <- 1
+	ch <- 2
+	ch <- 3
+	close(ch)
+	return ch
+}
+
+func TestRestChannelStream(t *testing.T) {
+	type Test struct {
+		accept string
+
+		contentType string
+		body        string
+	}
+	var tests = []Test{
+		{"", "application/json; charset=utf-8", "[1,2,3]\n"},
+		{"application/json", "application/json; charset=utf-8", "[1,2,3]\n"},
+		{"application/x-ndjson", "application/x-ndjson", "1\n2\n3\n"},
+		{"text/event-stream", "text/event-stream", "data: 1\n\ndata: 2\n\ndata: 3\n\n"},
+		{"application/x-ndjson;q=0, application/json", "application/json; charset=utf-8", "[1,2,3]\n"},
+	}
+	rest, err := New(new(TestChannelStream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", "http://domain/list", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, http.StatusOK, "test %d", i)
+		equal(t, w.Header().Get("Content-Type"), test.contentType, "test %d", i)
+		equal(t, w.Header().Get("Vary"), "Accept", "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+}
+
+type TestServeContent struct {
+	Service `compress:"on"`
+
+	File Processor `method:"GET" path:"/file"`
+}
+
+var testModTime = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func (r TestServeContent) HandleFile() io.ReadSeeker {
+	r.SetContentInfo("hello.txt", testModTime)
+	return strings.NewReader("hello world")
+}
+
+func TestProcessorNodeServeContent(t *testing.T) {
+	type Test struct {
+		headers http.Header
+
+		code    int
+		expects http.Header
+		body    string
+	}
+	var tests = []Test{
+		{http.Header{}, http.StatusOK, http.Header{
+			"Accept-Ranges":  {"bytes"},
+			"Content-Length": {"11"},
+			"Content-Type":   {"text/plain; charset=utf-8"},
+			"Last-Modified":  {"Thu, 02 Jan 2020 03:04:05 GMT"},
+		}, "hello world"},
+		{http.Header{"Range": {"bytes=0-4"}}, http.StatusPartialContent, http.Header{
+			"Accept-Ranges":  {"bytes"},
+			"Content-Length": {"5"},
+			"Content-Range":  {"bytes 0-4/11"},
+			"Content-Type":   {"text/plain; charset=utf-8"},
+			"Last-Modified":  {"Thu, 02 Jan 2020 03:04:05 GMT"},
+		}, "hello"},
+		{http.Header{"If-Modified-Since": {"Thu, 02 Jan 2020 03:04:05 GMT"}}, http.StatusNotModified, http.Header{
+			"Last-Modified": {"Thu, 02 Jan 2020 03:04:05 GMT"},
+		}, ""},
+		{http.Header{"Range": {"bytes=0-4"}, "Accept-Encoding": {"gzip"}}, http.StatusOK, http.Header{
+			"Accept-Ranges":    {"bytes"},
+			"Content-Encoding": {"gzip"},
+			"Content-Type":     {"text/plain; charset=utf-8"},
+			"Last-Modified":    {"Thu, 02 Jan 2020 03:04:05 GMT"},
+		}, ""},
+	}
+	rest, err := New(new(TestServeContent))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", "http://domain/file", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header = test.headers
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Header(), test.expects, "test %d", i)
+		if test.body != "" {
+			equal(t, w.Body.String(), test.body, "test %d", i)
+		}
+	}
+}
+
+func TestWriteRenderedDone(t *testing.T) {
+	req, err := http.NewRequest("GET", "http://domain/render", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	ctx, err := newContext(w, req, nil, "application/json", "utf-8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.cancel()
+	rendered := false
+	writeRendered(ctx, http.StatusCreated, func(w io.Writer) error {
+		rendered = true
+		_, err := io.WriteString(w, "rendered")
+		return err
+	})
+	equal(t, rendered, false)
+	equal(t, w.Body.String(), "")
+	equal(t, ctx.err, gocontext.Canceled)
+}
+
 func TestStreamingNodeHandle(t *testing.T) {
 	type Test struct {
 		f           reflect.Method
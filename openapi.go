@@ -0,0 +1,360 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// openAPIMethods are the methods an OpenAPI path item can describe.
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// OpenAPI generates a minimal OpenAPI 3 document of service, which describes paths, methods, path
+// parameters, and request/response schemas inferred from handlers. Response of handler returning Result
+// has no schema, since its body is dynamic. Request fields bound from query and header are described as
+// parameters, and fields bound from any source aren't in request body. It describes routes of any host, see OpenAPIHost for routes
+// with host tag.
+func (r *Rest) OpenAPI() ([]byte, error) {
+	return r.OpenAPIHost("")
+}
+
+// OpenAPIHost is like OpenAPI, but describes routes serving requests of host, like "admin.example.com".
+// Routes of host patterns matching host take precedence over routes of any host with the same method
+// and path, like routing, so each document describes one route of them.
+func (r *Rest) OpenAPIHost(host string) ([]byte, error) {
+	t := r.load()
+	schemas := make(map[string]interface{})
+	paths := make(map[string]map[string]interface{})
+	// ranks of operations in paths, lower one takes precedence.
+	ranks := make(map[string]int)
+	set := func(path, method string, rank int, op map[string]interface{}) {
+		key := method + " " + path
+		if old, ok := ranks[key]; ok && old <= rank {
+			return
+		}
+		ranks[key] = rank
+		paths[path][method] = op
+	}
+	for group, routes := range t.hostRoutes(normalizeHost(host)) {
+		for _, route := range routes {
+			path, params := openAPIPath(route)
+			id := t.operationID(route)
+			op := map[string]interface{}{
+				"operationId": id,
+			}
+			if len(params) > 0 {
+				op["parameters"] = params
+			}
+			mimes := route.produces
+			if len(mimes) == 0 {
+				mimes = []string{t.defaultMime}
+			}
+			requestType, responseType := handlerTypes(route.handler)
+			if requestType != nil {
+				body, bound := requestSchema(requestType, handlerBindings(route.handler), schemas)
+				if len(bound) > 0 {
+					op["parameters"] = append(params, bound...)
+				}
+				consumes := route.consumes
+				if len(consumes) == 0 {
+					consumes = []string{t.defaultMime}
+				}
+				if body != nil {
+					op["requestBody"] = map[string]interface{}{
+						"content": openAPIContent(consumes, body),
+					}
+				}
+			}
+			response := map[string]interface{}{
+				"description": "OK",
+			}
+			if responseType != nil {
+				response["content"] = openAPIContent(mimes, typeSchema(responseType, schemas))
+			}
+			op["responses"] = map[string]interface{}{
+				"200": response,
+			}
+			if paths[path] == nil {
+				paths[path] = make(map[string]interface{})
+			}
+			if route.method != anyMethod {
+				set(path, strings.ToLower(route.method), group*2, op)
+				continue
+			}
+			// route of method "*" describes methods which don't have their own route, with operationId
+			// suffixed by method to keep it unique.
+			for _, method := range openAPIMethods {
+				m := make(map[string]interface{}, len(op))
+				for k, v := range op {
+					m[k] = v
+				}
+				m["operationId"] = id + strings.ToUpper(method[:1]) + method[1:]
+				set(path, method, group*2+1, m)
+			}
+		}
+	}
+	title := "rest"
+	if t.instance.IsValid() {
+		title = t.instance.Type().Name()
+	}
+	doc := map[string]interface{}{
+		"openapi": "3.0.0",
+		"info": map[string]interface{}{
+			"title":   title,
+			"version": "1.0",
+		},
+		"paths": paths,
+	}
+	if len(schemas) > 0 {
+		doc["components"] = map[string]interface{}{
+			"schemas": schemas,
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// operationID returns operationId of route rt. Route repeated under a prefix other than the primary
+// one is qualified by the prefix, like "GetHello_v1" under "/v1", to keep it unique.
+func (t *table) operationID(rt *route) string {
+	prefix := ""
+	for _, p := range t.prefixes {
+		if len(p) > len(prefix) && (string(rt.path) == p || strings.HasPrefix(string(rt.path), strings.TrimSuffix(p, "/")+"/")) {
+			prefix = p
+		}
+	}
+	if prefix == "" || prefix == t.prefixes[0] {
+		return rt.name
+	}
+	return rt.name + "_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, strings.Trim(prefix, "/"))
+}
+
+// describeOptions returns the description of routes matching path of OPTIONS request r, with their
+// methods, path parameters and request/response schemas. See Rest.DescribeOptions. It returns nil if no
+// route matches.
+func describeOptions(t *table, r *http.Request) ([]byte, []string, error) {
+	var methods []string
+	var matched []*route
+	for _, rt := range t.routes {
+		if rt.method == anyMethod || inList(methods, rt.method) {
+			continue
+		}
+		if found, _ := t.findMethod(r, rt.method); found != nil {
+			methods = append(methods, found.method)
+			matched = append(matched, found)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, nil, nil
+	}
+	schemas := make(map[string]interface{})
+	path, params := openAPIPath(matched[0])
+	desc := map[string]interface{}{
+		"path": path,
+	}
+	if len(params) > 0 {
+		desc["parameters"] = params
+	}
+	ops := make(map[string]interface{})
+	for _, rt := range matched {
+		op := make(map[string]interface{})
+		requestType, responseType := handlerTypes(rt.handler)
+		if requestType != nil {
+			body, bound := requestSchema(requestType, handlerBindings(rt.handler), schemas)
+			if body != nil {
+				op["request"] = body
+			}
+			if len(bound) > 0 {
+				op["parameters"] = bound
+			}
+		}
+		if responseType != nil {
+			op["response"] = typeSchema(responseType, schemas)
+		}
+		ops[rt.method] = op
+	}
+	desc["methods"] = ops
+	if len(schemas) > 0 {
+		desc["schemas"] = schemas
+	}
+	b, err := json.Marshal(desc)
+	return b, append(methods, http.MethodOptions), err
+}
+
+var resultType = reflect.TypeOf(Result{})
+
+// handlerTypes returns request and response types of handler h. Response of Result has no type, since
+// its body can be anything.
+func handlerTypes(h handler) (reflect.Type, reflect.Type) {
+	switch n := h.(type) {
+	case *processorNode:
+		if n.responseType == resultType {
+			return n.requestType, nil
+		}
+		return n.requestType, n.responseType
+	case *streamingNode:
+		return n.requestType, nil
+	}
+	return nil, nil
+}
+
+func handlerBindings(h handler) []binding {
+	switch n := h.(type) {
+	case *processorNode:
+		return n.bindings
+	case *streamingNode:
+		return n.bindings
+	}
+	return nil
+}
+
+// requestSchema returns schema of request body of type t, and parameters of fields bound from query
+// and header by bindings. Fields bound from any source aren't in body schema, which is nil if no field
+// is left.
+func requestSchema(t reflect.Type, bindings []binding, schemas map[string]interface{}) (interface{}, []interface{}) {
+	if len(bindings) == 0 {
+		return typeSchema(t, schemas), nil
+	}
+	var params []interface{}
+	bound := make(map[int]bool)
+	for _, b := range bindings {
+		bound[b.index] = true
+		for _, source := range b.sources {
+			if source[0] != "query" && source[0] != "header" {
+				continue
+			}
+			params = append(params, map[string]interface{}{
+				"name":   source[1],
+				"in":     source[0],
+				"schema": typeSchema(b.typ, schemas),
+			})
+		}
+	}
+	properties := structProperties(t, schemas, bound)
+	if len(properties) == 0 {
+		return nil, params
+	}
+	return map[string]interface{}{"type": "object", "properties": properties}, params
+}
+
+// openAPIPath converts path of route like "/hello/:to" to "/hello/{to}", and returns its parameters.
+// Schema of parameter is inferred from the type handler captures it as, or string if handler doesn't
+// capture it.
+func openAPIPath(rt *route) (string, []interface{}) {
+	var names []string
+	var types []reflect.Type
+	switch n := rt.handler.(type) {
+	case *processorNode:
+		names, types = n.pathNames, n.pathTypes
+	case *streamingNode:
+		names, types = n.pathNames, n.pathTypes
+	}
+	var params []interface{}
+	segments := strings.Split(string(rt.path), "/")
+	for i, s := range segments {
+		var name string
+		switch {
+		case isPrefixParam(s):
+			name = s[1 : len(s)-1]
+		case len(s) >= 2 && (s[0] == ':' || s[0] == '*'):
+			name = s[1:]
+		default:
+			continue
+		}
+		segments[i] = "{" + name + "}"
+		var schema interface{} = map[string]interface{}{"type": "string"}
+		for j, n := range names {
+			if n == name {
+				schema = typeSchema(types[j], nil)
+			}
+		}
+		params = append(params, map[string]interface{}{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   schema,
+		})
+	}
+	return strings.Join(segments, "/"), params
+}
+
+func openAPIContent(mimes []string, schema interface{}) map[string]interface{} {
+	ret := make(map[string]interface{})
+	for _, mime := range mimes {
+		ret[mime] = map[string]interface{}{
+			"schema": schema,
+		}
+	}
+	return ret
+}
+
+// typeSchema returns schema of type t. Named struct is put into schemas and referenced.
+func typeSchema(t reflect.Type, schemas map[string]interface{}) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), schemas)}
+	case reflect.Struct:
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		if t.Name() != "" {
+			if _, ok := schemas[t.Name()]; ok {
+				return ref
+			}
+			schemas[t.Name()] = nil // placeholder for recursive type
+		}
+		schema := map[string]interface{}{"type": "object", "properties": structProperties(t, schemas, nil)}
+		if t.Name() == "" {
+			return schema
+		}
+		schemas[t.Name()] = schema
+		return ref
+	}
+	return map[string]interface{}{}
+}
+
+// structProperties returns schemas of exported fields of struct t by their json names, except fields of
+// indexes in skip.
+func structProperties(t reflect.Type, schemas map[string]interface{}, skip map[int]bool) map[string]interface{} {
+	properties := make(map[string]interface{})
+	for i, n := 0, t.NumField(); i < n; i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || skip[i] {
+			continue
+		}
+		name := field.Name
+		if tag := field.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if i := strings.Index(tag, ","); i >= 0 {
+				tag = tag[:i]
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		properties[name] = typeSchema(field.Type, schemas)
+	}
+	return properties
+}
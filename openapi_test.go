@@ -0,0 +1,316 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestOpenAPI(t *testing.T) {
+	rest, err := New(&RestExample{})
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	b, err := rest.OpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+		Comps   struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	equal(t, doc.OpenAPI, "3.0.0")
+	equal(t, len(doc.Paths), 3)
+	equal(t, string(doc.Paths["/prefix/hello"]["post"]), `{"operationId":"CreateHello","requestBody":{"content":{"application/json":{"schema":{"$ref":"#/components/schemas/HelloArg"}}}},"responses":{"200":{"description":"OK"}}}`)
+	equal(t, string(doc.Paths["/prefix/hello/{to}"]["get"]), `{"operationId":"GetHello","parameters":[{"in":"path","name":"to","required":true,"schema":{"type":"string"}}],"responses":{"200":{"content":{"application/json":{"schema":{"$ref":"#/components/schemas/HelloArg"}}},"description":"OK"}}}`)
+	equal(t, string(doc.Comps.Schemas["HelloArg"]), `{"properties":{"post":{"type":"string"},"to":{"type":"string"}},"type":"object"}`)
+}
+
+func TestOpenAPIAnyMethod(t *testing.T) {
+	rest, err := New(new(TestAnyMethod))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	b, err := rest.OpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Paths map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	equal(t, len(doc.Paths["/proxy/{path}"]), 8)
+	equal(t, doc.Paths["/proxy/{path}"]["patch"].OperationID, "ProxyPatch")
+	equal(t, doc.Paths["/proxy/{path}"]["get"].OperationID, "ProxyGet")
+	equal(t, len(doc.Paths["/proxy/status"]), 1)
+	equal(t, doc.Paths["/proxy/status"]["get"].OperationID, "Get")
+}
+
+func TestOpenAPIPrefixes(t *testing.T) {
+	rest, err := New(new(TestPrefixes))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	b, err := rest.OpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Paths map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	equal(t, doc.Paths["/api/node/{id}"]["get"].OperationID, "Node")
+	equal(t, doc.Paths["/v1/node/{id}"]["get"].OperationID, "Node_v1")
+}
+
+func TestOpenAPIHost(t *testing.T) {
+	type Test struct {
+		host string
+
+		node  string
+		users string
+	}
+	var tests = []Test{
+		{"", "Any", ""},
+		{"www.example.com", "Any", ""},
+		{"admin.example.com", "Admin", "UsersGet"},
+		{"API.example.com:8080", "API", ""},
+	}
+	rest, err := New(new(TestHost))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	for i, test := range tests {
+		b, err := rest.OpenAPIHost(test.host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc struct {
+			Paths map[string]map[string]struct {
+				OperationID string `json:"operationId"`
+			} `json:"paths"`
+		}
+		if err := json.Unmarshal(b, &doc); err != nil {
+			t.Fatal(err)
+		}
+		equal(t, doc.Paths["/prefix/node"]["get"].OperationID, test.node, "test %d", i)
+		equal(t, doc.Paths["/prefix/users"]["get"].OperationID, test.users, "test %d", i)
+	}
+}
+
+func TestOpenAPIPathType(t *testing.T) {
+	rest := NewRouter("/")
+	if err := rest.GET("/item/:id", func(s Service, id int) string { return "" }); err != nil {
+		t.Fatal(err)
+	}
+	if err := rest.GET("/user/:name", func(s Service, name string) string { return "" }); err != nil {
+		t.Fatal(err)
+	}
+	b, err := rest.OpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Paths map[string]map[string]struct {
+			Parameters json.RawMessage `json:"parameters"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	equal(t, string(doc.Paths["/item/{id}"]["get"].Parameters), `[{"in":"path","name":"id","required":true,"schema":{"type":"integer"}}]`)
+	equal(t, string(doc.Paths["/user/{name}"]["get"].Parameters), `[{"in":"path","name":"name","required":true,"schema":{"type":"string"}}]`)
+}
+
+func TestOpenAPIBindings(t *testing.T) {
+	type Search struct {
+		Page  int    `query:"page"`
+		Token string `header:"X-Token"`
+		Name  string `json:"name"`
+	}
+	type List struct {
+		Page int `query:"page"`
+	}
+	rest := NewRouter("/")
+	if err := rest.POST("/search", func(s Service, arg Search) {}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rest.GET("/list", func(s Service, arg List) {}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := rest.OpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Paths map[string]map[string]struct {
+			Parameters  json.RawMessage `json:"parameters"`
+			RequestBody json.RawMessage `json:"requestBody"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	search := doc.Paths["/search"]["post"]
+	equal(t, string(search.Parameters), `[{"in":"query","name":"page","schema":{"type":"integer"}},{"in":"header","name":"X-Token","schema":{"type":"string"}}]`)
+	equal(t, string(search.RequestBody), `{"content":{"application/json":{"schema":{"properties":{"name":{"type":"string"}},"type":"object"}}}}`)
+	list := doc.Paths["/list"]["get"]
+	equal(t, string(list.Parameters), `[{"in":"query","name":"page","schema":{"type":"integer"}}]`)
+	equal(t, string(list.RequestBody), "")
+}
+
+func TestOpenAPIResult(t *testing.T) {
+	rest := NewRouter("/")
+	err := rest.GET("/result", func(s Service) Result {
+		return Result{Status: http.StatusCreated, Body: "created"}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := rest.OpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Paths map[string]map[string]struct {
+			Responses json.RawMessage `json:"responses"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	equal(t, string(doc.Paths["/result"]["get"].Responses), `{"200":{"description":"OK"}}`)
+}
+
+func TestTypeSchema(t *testing.T) {
+	type Node struct {
+		Name     string  `json:"name"`
+		Children []*Node `json:"children,omitempty"`
+		Skip     int     `json:"-"`
+		private  int
+	}
+	type Test struct {
+		i      interface{}
+		schema string
+	}
+	var tests = []Test{
+		{1, `{"type":"integer"}`},
+		{1.0, `{"type":"number"}`},
+		{"", `{"type":"string"}`},
+		{true, `{"type":"boolean"}`},
+		{[]byte{}, `{"format":"byte","type":"string"}`},
+		{[]string{}, `{"items":{"type":"string"},"type":"array"}`},
+		{map[string]int{}, `{"additionalProperties":{"type":"integer"},"type":"object"}`},
+		{struct{ A int }{}, `{"properties":{"A":{"type":"integer"}},"type":"object"}`},
+		{Node{}, `{"$ref":"#/components/schemas/Node"}`},
+	}
+	for i, test := range tests {
+		schemas := make(map[string]interface{})
+		b, err := json.Marshal(typeSchema(reflect.TypeOf(test.i), schemas))
+		if err != nil {
+			t.Fatal(err)
+		}
+		equal(t, string(b), test.schema, "test %d", i)
+	}
+	schemas := make(map[string]interface{})
+	typeSchema(reflect.TypeOf(Node{}), schemas)
+	b, err := json.Marshal(schemas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, string(b), `{"Node":{"properties":{"children":{"items":{"$ref":"#/components/schemas/Node"},"type":"array"},"name":{"type":"string"}},"type":"object"}}`)
+}
+
+func TestDescribeOptions(t *testing.T) {
+	type Item struct {
+		Name string `json:"name"`
+	}
+	type Test struct {
+		describe bool
+		url      string
+
+		code  int
+		allow string
+		body  string
+	}
+	var tests = []Test{
+		{true, "http://domain/item/1", http.StatusOK, "GET, PUT, OPTIONS", `{"methods":{"GET":{"response":{"$ref":"#/components/schemas/Item"}},"PUT":{"request":{"$ref":"#/components/schemas/Item"}}},"parameters":[{"in":"path","name":"id","required":true,"schema":{"type":"integer"}}],"path":"/item/{id}","schemas":{"Item":{"properties":{"name":{"type":"string"}},"type":"object"}}}`},
+		{true, "http://domain/ping", http.StatusOK, "OPTIONS", "custom"},
+		{true, "http://domain/missing", http.StatusNotFound, "", ""},
+		{false, "http://domain/item/1", http.StatusNotFound, "", ""},
+	}
+	rest := NewRouter("/")
+	if err := rest.GET("/item/:id", func(s Service, id int) Item { return Item{} }); err != nil {
+		t.Fatal(err)
+	}
+	if err := rest.PUT("/item/:id", func(s Service, id int, item Item) {}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rest.GET("/ping", func(s Service) {}); err != nil {
+		t.Fatal(err)
+	}
+	err := rest.HandleFunc("OPTIONS", "/ping", func(s Service) {
+		s.Header().Set("Allow", "OPTIONS")
+		s.WriteRaw("text/plain", []byte("custom"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		rest.DescribeOptions = test.describe
+		req, err := http.NewRequest("OPTIONS", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Header().Get("Allow"), test.allow, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+}
+
+func TestDescribeOptionsHost(t *testing.T) {
+	type Test struct {
+		url string
+
+		code  int
+		allow string
+	}
+	var tests = []Test{
+		{"http://admin.example.com/prefix/node", http.StatusOK, "GET, OPTIONS"},
+		{"http://api.example.com/prefix/node", http.StatusNotFound, ""},
+		{"http://api.example.com/prefix/other", http.StatusOK, "GET, OPTIONS"},
+		{"http://admin.example.com/prefix/other", http.StatusNotFound, ""},
+	}
+	rest, err := New(new(TestServiceHost), WithDescribeOptions())
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("OPTIONS", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Header().Get("Allow"), test.allow, "test %d", i)
+	}
+}
@@ -0,0 +1,274 @@
+package rest
+
+import (
+	gocontext "context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Option configures Rest when it's created by New or NewFiltered, after routes are built. If an option
+// returns error, creating fails with that error.
+type Option func(r *Rest) error
+
+// WithDefaultHeaders sets Rest.DefaultHeaders.
+func WithDefaultHeaders(h http.Header) Option {
+	return func(r *Rest) error {
+		r.DefaultHeaders = h
+		return nil
+	}
+}
+
+// WithMaxURLLength sets Rest.MaxURLLength. Negative n is invalid.
+func WithMaxURLLength(n int) Option {
+	return func(r *Rest) error {
+		if n < 0 {
+			return fmt.Errorf("invalid max url length: %d", n)
+		}
+		r.MaxURLLength = n
+		return nil
+	}
+}
+
+// WithMethodOverride enables Rest.MethodOverride.
+func WithMethodOverride() Option {
+	return func(r *Rest) error {
+		r.MethodOverride = true
+		return nil
+	}
+}
+
+// WithRetryAfter sets Rest.RetryAfter. Negative d is invalid.
+func WithRetryAfter(d time.Duration) Option {
+	return func(r *Rest) error {
+		if d < 0 {
+			return fmt.Errorf("invalid retry after: %s", d)
+		}
+		r.RetryAfter = d
+		return nil
+	}
+}
+
+// WithSniffContentType enables Rest.SniffContentType.
+func WithSniffContentType() Option {
+	return func(r *Rest) error {
+		r.SniffContentType = true
+		return nil
+	}
+}
+
+// WithLogger sets Rest.Logger.
+func WithLogger(l *log.Logger) Option {
+	return func(r *Rest) error {
+		r.Logger = l
+		return nil
+	}
+}
+
+// WithResponseWrapper sets Rest.ResponseWrapper.
+func WithResponseWrapper(fn func(v interface{}, s Service) interface{}) Option {
+	return func(r *Rest) error {
+		r.ResponseWrapper = fn
+		return nil
+	}
+}
+
+// WithResponseTransform sets Rest.ResponseTransform.
+func WithResponseTransform(fn func(v interface{}, s Service) interface{}) Option {
+	return func(r *Rest) error {
+		r.ResponseTransform = fn
+		return nil
+	}
+}
+
+// WithErrorMime sets Rest.ErrorMime. Mime without registered marshaller is invalid.
+func WithErrorMime(mime string) Option {
+	return func(r *Rest) error {
+		if _, ok := getMarshaller(mime); !ok {
+			return fmt.Errorf("error mime %s has no marshaller", mime)
+		}
+		r.ErrorMime = mime
+		return nil
+	}
+}
+
+// WithProblemJSON sets Rest.ProblemJSON.
+func WithProblemJSON() Option {
+	return func(r *Rest) error {
+		r.ProblemJSON = true
+		return nil
+	}
+}
+
+// WithSelectMarshaller sets Rest.SelectMarshaller.
+func WithSelectMarshaller(fn func(r *http.Request) (mime string, ok bool)) Option {
+	return func(r *Rest) error {
+		r.SelectMarshaller = fn
+		return nil
+	}
+}
+
+// WithStrictRequestParsing enables Rest.StrictRequestParsing.
+func WithStrictRequestParsing() Option {
+	return func(r *Rest) error {
+		r.StrictRequestParsing = true
+		return nil
+	}
+}
+
+// WithCacheSize sets Rest.CacheSize. Negative n is invalid.
+func WithCacheSize(n int) Option {
+	return func(r *Rest) error {
+		if n < 0 {
+			return fmt.Errorf("invalid cache size: %d", n)
+		}
+		r.CacheSize = n
+		return nil
+	}
+}
+
+// WithCleanPath enables Rest.CleanPath.
+func WithCleanPath() Option {
+	return func(r *Rest) error {
+		r.CleanPath = true
+		return nil
+	}
+}
+
+// WithRedirectCleanPath enables Rest.RedirectCleanPath.
+func WithRedirectCleanPath() Option {
+	return func(r *Rest) error {
+		r.RedirectCleanPath = true
+		return nil
+	}
+}
+
+// WithBodyReadTimeout sets Rest.BodyReadTimeout. Negative d is invalid.
+func WithBodyReadTimeout(d time.Duration) Option {
+	return func(r *Rest) error {
+		if d < 0 {
+			return fmt.Errorf("invalid body read timeout: %s", d)
+		}
+		r.BodyReadTimeout = d
+		return nil
+	}
+}
+
+// WithMinBodyReadRate sets Rest.MinBodyReadRate. Negative n is invalid.
+func WithMinBodyReadRate(n int) Option {
+	return func(r *Rest) error {
+		if n < 0 {
+			return fmt.Errorf("invalid min body read rate: %d", n)
+		}
+		r.MinBodyReadRate = n
+		return nil
+	}
+}
+
+// WithHandlerTimeout sets Rest.HandlerTimeout. Negative d is invalid.
+func WithHandlerTimeout(d time.Duration) Option {
+	return func(r *Rest) error {
+		if d < 0 {
+			return fmt.Errorf("invalid handler timeout: %s", d)
+		}
+		r.HandlerTimeout = d
+		return nil
+	}
+}
+
+// WithMultipartMemory sets Rest.MultipartMemory. Negative n is invalid.
+func WithMultipartMemory(n int64) Option {
+	return func(r *Rest) error {
+		if n < 0 {
+			return fmt.Errorf("invalid multipart memory: %d", n)
+		}
+		r.MultipartMemory = n
+		return nil
+	}
+}
+
+// WithTap sets Rest.Tap.
+func WithTap(fn func(req *http.Request, status int, dur time.Duration)) Option {
+	return func(r *Rest) error {
+		r.Tap = fn
+		return nil
+	}
+}
+
+// WithDescribeOptions enables Rest.DescribeOptions.
+func WithDescribeOptions() Option {
+	return func(r *Rest) error {
+		r.DescribeOptions = true
+		return nil
+	}
+}
+
+// WithFormatExtensions sets Rest.FormatExtensions. Extension not starting with "." is invalid.
+func WithFormatExtensions(exts map[string]string) Option {
+	return func(r *Rest) error {
+		for ext := range exts {
+			if len(ext) < 2 || ext[0] != '.' {
+				return fmt.Errorf("invalid format extension: %q", ext)
+			}
+		}
+		r.FormatExtensions = exts
+		return nil
+	}
+}
+
+// WithPreRoute sets Rest.PreRoute.
+func WithPreRoute(fn func(r *http.Request)) Option {
+	return func(r *Rest) error {
+		r.PreRoute = fn
+		return nil
+	}
+}
+
+// WithIdempotencyScope sets Rest.IdempotencyScope.
+func WithIdempotencyScope(fn func(r *http.Request) string) Option {
+	return func(r *Rest) error {
+		r.IdempotencyScope = fn
+		return nil
+	}
+}
+
+// WithBaseContext sets Rest.BaseContext.
+func WithBaseContext(fn func(r *http.Request) gocontext.Context) Option {
+	return func(r *Rest) error {
+		r.BaseContext = fn
+		return nil
+	}
+}
+
+// WithOverlapHandler sets Rest.OverlapHandler, like logging overlapping routes:
+//
+//	rest.New(s, rest.WithOverlapHandler(func(method, path1, path2 string) error {
+//		log.Printf("rest: %s %s overlaps with %s", method, path1, path2)
+//		return nil
+//	}))
+func WithOverlapHandler(fn func(method, path1, path2 string) error) Option {
+	return func(r *Rest) error {
+		r.OverlapHandler = fn
+		return nil
+	}
+}
+
+// WithFallback sets the handler of unmatched requests. See Rest.Fallback.
+func WithFallback(h http.Handler) Option {
+	return func(r *Rest) error {
+		r.Fallback(h)
+		return nil
+	}
+}
+
+// WithErrorStatus maps err to http status. See Rest.RegisterErrorStatus.
+func WithErrorStatus(err error, status int) Option {
+	return func(r *Rest) error {
+		if status < 100 || status > 999 {
+			return fmt.Errorf("invalid status of error %s: %d", err, status)
+		}
+		r.RegisterErrorStatus(err, status)
+		return nil
+	}
+}
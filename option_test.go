@@ -0,0 +1,107 @@
+package rest
+
+import (
+	gocontext "context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewOptions(t *testing.T) {
+	fallback := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	rest, err := New(new(TestErrorStatus),
+		WithDefaultHeaders(http.Header{"X-Default": {"on"}}),
+		WithMaxURLLength(100),
+		WithMethodOverride(),
+		WithRetryAfter(time.Second),
+		WithSniffContentType(),
+		WithErrorMime("application/json"),
+		WithStrictRequestParsing(),
+		WithProblemJSON(),
+		WithCacheSize(10),
+		WithBodyReadTimeout(time.Minute),
+		WithMinBodyReadRate(1024),
+		WithMultipartMemory(1024),
+		WithHandlerTimeout(time.Minute),
+		WithTap(func(req *http.Request, status int, dur time.Duration) {}),
+		WithDescribeOptions(),
+		WithPreRoute(func(r *http.Request) {}),
+		WithBaseContext(func(r *http.Request) gocontext.Context { return nil }),
+		WithOverlapHandler(func(method, path1, path2 string) error { return nil }),
+		Idempotency(NewMemoryIdempotencyStore(time.Minute)),
+		WithIdempotencyScope(func(r *http.Request) string { return "" }),
+		WithFallback(fallback),
+		WithErrorStatus(errTestNotFound, http.StatusNotFound),
+	)
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	equal(t, rest.DefaultHeaders, http.Header{"X-Default": {"on"}})
+	equal(t, rest.MaxURLLength, 100)
+	equal(t, rest.MethodOverride, true)
+	equal(t, rest.RetryAfter, time.Second)
+	equal(t, rest.SniffContentType, true)
+	equal(t, rest.ErrorMime, "application/json")
+	equal(t, rest.StrictRequestParsing, true)
+	equal(t, rest.ProblemJSON, true)
+	equal(t, rest.CacheSize, 10)
+	equal(t, rest.BodyReadTimeout, time.Minute)
+	equal(t, rest.MinBodyReadRate, 1024)
+	equal(t, rest.MultipartMemory, int64(1024))
+	equal(t, rest.HandlerTimeout, time.Minute)
+	equal(t, rest.Tap != nil, true)
+	equal(t, rest.DescribeOptions, true)
+	equal(t, rest.PreRoute != nil, true)
+	equal(t, rest.BaseContext != nil, true)
+	equal(t, rest.OverlapHandler != nil, true)
+	equal(t, rest.IdempotencyStore != nil, true)
+	equal(t, rest.IdempotencyScope != nil, true)
+
+	type Test struct {
+		url string
+
+		code int
+	}
+	var tests = []Test{
+		{"http://domain/node/missing", http.StatusNotFound},
+		{"http://domain/other", http.StatusTeapot},
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Header().Get("X-Default"), "on", "test %d", i)
+	}
+}
+
+func TestNewOptionError(t *testing.T) {
+	type Test struct {
+		opt Option
+
+		err string
+	}
+	var tests = []Test{
+		{WithMaxURLLength(-1), "invalid max url length: -1"},
+		{WithRetryAfter(-time.Second), "invalid retry after: -1s"},
+		{WithErrorMime("text/x-unknown"), "error mime text/x-unknown has no marshaller"},
+		{WithCacheSize(-1), "invalid cache size: -1"},
+		{WithBodyReadTimeout(-time.Second), "invalid body read timeout: -1s"},
+		{WithMinBodyReadRate(-1), "invalid min body read rate: -1"},
+		{WithMultipartMemory(-1), "invalid multipart memory: -1"},
+		{WithHandlerTimeout(-time.Second), "invalid handler timeout: -1s"},
+		{WithErrorStatus(errors.New("e"), 0), "invalid status of error e: 0"},
+	}
+	for i, test := range tests {
+		_, err := New(new(TestErrorStatus), test.opt)
+		equal(t, fmt.Sprintf("%v", err), test.err, "test %d", i)
+	}
+}
@@ -0,0 +1,65 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// ProblemMime is the mime of error responses if Rest.ProblemJSON is set.
+const ProblemMime = "application/problem+json"
+
+/*
+Problem is the error response of RFC 7807, replied as application/problem+json by Service.Error, or for
+error returned by handler, if Rest.ProblemJSON is set. Handler can return a Problem, or call
+Service.Error with it, to set the fields, and empty fields are filled in replying:
+
+  - Type is "about:blank";
+  - Title is the status text of Status;
+  - Instance is the path of request.
+
+Status is always the status of response. Status of Problem returned by handler becomes the status of
+response, unless the error is registered by Rest.RegisterErrorStatus. Other errors are replied as Problem
+with err.Error() as Detail.
+*/
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+func (p Problem) Error() string {
+	if p.Detail == "" {
+		return p.Title
+	}
+	return p.Detail
+}
+
+// problem converts err replied with status code to Problem.
+func (c *context) problem(code int, err error) Problem {
+	var p Problem
+	if !errors.As(err, &p) {
+		p.Detail = err.Error()
+	}
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	p.Status = code
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.Instance == "" {
+		p.Instance = c.request.URL.Path
+	}
+	return p
+}
+
+// marshalProblem returns the body of err replied with status code as Problem.
+func (c *context) marshalProblem(code int, err error) []byte {
+	var body bytes.Buffer
+	json.NewEncoder(&body).Encode(c.problem(code, err))
+	return body.Bytes()
+}
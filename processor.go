@@ -2,7 +2,9 @@ package rest
 
 import (
 	"fmt"
+	"net/http"
 	"reflect"
+	"time"
 )
 
 /*
@@ -16,15 +18,184 @@ and return 0 or 1 value for response body, like below:
  - func Hanlder() ResponseType // ignore request body, response type is ResponseType
  - func Handler(post PostType) ResponseType // marshal request to PostType, response type is ResponseType
 
+If path has parameters and the leading input parameters, as many as path parameters, are all of kind
+string or int, they capture path parameters by order, and the next one is unmarshalled from request body:
+
+ - func Handler(id UserID, post PostType) // path is "/user/:id", UserID's kind is int
+
+A lone input parameter is still unmarshalled from request body, even if path has a lone parameter, unless
+tag args names the path parameter it captures:
+
+ - func Handler(id UserID) // path is "/user/:id", tag is args:"id"
+
+Capturing by order silently swaps arguments of the same kind if path segments are reordered later, so
+tag args may name the path parameter each leading parameter captures, then the order in path doesn't
+matter. It should list each path parameter once, and New fails if leading parameters can't capture them:
+
+ - func Handler(id UserID, key string) // path is "/:key/user/:id", tag is args:"id,key"
+
+Binding fields of PostType by tag path also matches by name. Path parameter which can't convert to int
+gets 400 Bad Request.
+
+Request body of DELETE is optional, like filters of bulk deletion, so DELETE request without body
+leaves PostType zero value instead of getting 400 Bad Request.
+
+PostType may be a struct binding fields from several sources of request, by tags path, query, header
+and form naming the path parameter, query parameter, header or form field. Other fields are unmarshalled
+from request body, which may be empty:
+
+	type ListArg struct {
+		User   int    `path:"id"`
+		Page   int    `query:"page"`
+		Token  string `header:"X-Token"`
+		Filter string `json:"filter"`
+	}
+
+	func Handler(arg ListArg) ResponseType // path is "/user/:id/posts"
+
+Bound fields should be of kind string or int. They never take values from body, so client can't forge
+a path parameter or header in body. If a field has several source tags, the first one of path, query,
+header and form having the value is used. Missing value leaves field zero value, and value which can't
+convert gets 400 Bad Request.
+
+If PostType binds form fields or files, request of html form, multipart or url encoded, isn't
+unmarshalled, and its fields are bound instead. Field of type rest.FileUpload with tag file gets the
+first file of the form key, and []rest.FileUpload gets all of them, like a batch upload:
+
+	type UploadArg struct {
+		Album  string            `form:"album"`
+		Photos []rest.FileUpload `file:"photo"`
+	}
+
+	func Handler(arg UploadArg) ResponseType
+
+Multipart body beyond Rest.MultipartMemory is stored in temporary files, which are removed after handler
+returns, so handler should read files before it returns. Malformed form gets 400 Bad Request.
+
+Handle function may also return an error as the last value:
+
+ - func Handler() error // no response unless error
+ - func Handler(post PostType) (ResponseType, error) // response is ResponseType unless error
+
+If returned error isn't nil, response body is the error and status is the one registered by
+Rest.RegisterErrorStatus, or 500 Internal Server Error if not registered.
+
+If ResponseType is rest.Result, its status and headers are written to response, and its body is
+marshalled. See Result.
+
+Handle function may also return http.Header after response value, before error if any:
+
+ - func Handler() (ResponseType, http.Header)
+ - func Handler(post PostType) (ResponseType, http.Header, error)
+
+Returned headers are set to response before writing body, like pagination links or rate limit info.
+Each of them replaces the header of same name set by handler, and other headers are kept. To add values
+to a header instead, handler should call Service.Header().Add. If returned error isn't nil, returned
+headers are ignored. Headers of returned rest.Result are set after them.
+
+Handle function may return several response values, which are marshalled as an array in order, like
+a tuple for RPC clients. http.Header and error still may follow them, and the trailing error is handled
+as above, so nothing is marshalled if it isn't nil:
+
+ - func Handler() (int, string, error) // response is like [1,"one"]
+
+Values in the tuple are marshalled as they are, so rest.Result or io.Reader isn't handled specially,
+and channel isn't allowed.
+
+If handler calls Service.NoContent or Service.NotModified, the returned value isn't marshalled and
+response has no body. If handler calls Service.WriteRaw, the returned value isn't marshalled either.
+
+If response value implements io.ReadSeeker, it's served by http.ServeContent, which supports Range
+request with 206 Partial Content, and conditional request. Use Service.SetContentInfo to set its name
+and modification time. Reader which can't seek doesn't support Range.
+
+If response value implements io.WriterTo, it's written to response by WriteTo instead of being
+marshalled. Handler should set Content-Type of response itself.
+
+If response value is a func(io.Writer) error, it's called to render response body after headers are
+set and only if client is still connected, so expensive rendering is deferred until it's needed:
+
+	func (r MyService) HandleReport() func(io.Writer) error {
+		// checks which may fail...
+		return func(w io.Writer) error {
+			return r.renderReport(w)
+		}
+	}
+
+Like io.WriterTo, handler should set Content-Type of response itself. If it returns error before writing
+anything, the error is replied like the one returned by handler. After body starts, status is sent and
+can't change, so the error is only logged with Service.Logger.
+
+If ResponseType is a receivable channel, like <-chan T, response is streamed: each value received
+from the channel is marshalled as a frame following by end tag, and flushed to client immediately,
+until the channel is closed. With JsonMarshaller, each frame ends with a newline, so the response is
+NDJSON. With tag framing:"sse", frames are sent as Server-Sent Events. Handler should close the
+channel when done, and stop sending when Service.Context() is done; if client disconnects, the channel
+is drained in background so sender won't block forever. It needs ResponseWriter implementing
+http.Flusher, found through middleware wrappers with method Unwrap() http.ResponseWriter, otherwise
+request gets 500 Internal Server Error instead of hanging.
+
+With tag stream, like stream:"application/x-ndjson", the channel is streamed only to clients whose
+Accept header lists one of the mimes, with that Content-Type, and "text/event-stream" is streamed as
+Server-Sent Events. For other clients, values are collected until the channel is closed and marshalled
+as an array in one response, like a handler returning a slice. Collected values are held in memory and
+nothing is sent before the channel is closed, so handler must close it, and channel of many values
+should rather be consumed by streaming clients. Response has header Vary: Accept.
+
+With tag cache, response of GET request without body is cached in memory by path and query, and
+requests in the duration get the cached status, headers and body without calling handler. Only 200 OK
+response is cached. Cached response isn't revalidated, so it may be stale until it expires, unless
+handler changing data calls Rest.InvalidateCache. Hooks still run for cached response.
+
+Cached response is shared by all clients, so request with Authorization or Cookie header, or any request
+while Rest.ResponseTransform is set, always calls handler, and response setting cookie, with
+Cache-Control private or no-store, or with Vary naming headers other than Accept, Accept-Charset and
+Accept-Encoding, isn't cached.
+
+If PostType is *rest.StreamDecoder, request body isn't unmarshalled, and handler decodes it element
+by element. See StreamDecoder.
+
 If function's input nothing, processor will let function to handle request's body directly through
 Service.Request().
 
 Valid tag:
 
- - method: Define the method of http request.
- - path: Define the path of http request.
+ - method: Define the method of http request. "*" or "ANY" matches request of any method which isn't
+   matched by routes of its own method.
+ - path: Define the path of http request. Empty path or "/" is the root of service prefix, which
+   matches both "/prefix" and "/prefix/" unless the other one has its own route.
+   A parameter may be followed by the set of values it accepts, like "/sort/:order{asc|desc}", then
+   request with other values doesn't match the node and gets 404 Not Found.
+   A segment may be a regexp in parentheses, like "/user/:id/posts/([0-9]+)", which matches the whole
+   segment. It's an anonymous parameter named by its position among parameters of path, from 1, so
+   Service.Vars of above has keys "id" and "2", and handler parameters capture them in path order.
+ - enabled: If value is "false", the node isn't registered. See NewFiltered.
+ - host: Pattern of request host, like host:"admin.*" where "*" matches any characters, so nodes of
+   the same method and path can serve different hosts. Nodes with host are tried before the ones without
+   it, and patterns are tried in order of declaration. Empty means any host, or the host of service.
+   Request host is set by client, so don't use host to restrict access, like hiding admin nodes; check
+   credentials in handler or middleware.
+ - meta: Semicolon separated key=value pairs, like "scope=admin;audit=true", for hooks to read by
+   Service.RouteMeta, like the scope required by the route.
  - func: Define the corresponding function name.
+ - args: Comma separated path parameters captured by leading input parameters, in order. See above.
  - mime: Define the default mime of request's and response's body. It overwrite the service one.
+ - consumes: Comma separated list of request content types accepted. Other types get 415 Unsupported Media Type.
+ - accept: Comma separated whitelist of request content types, like accept:"image/png,image/jpeg" for an
+   upload. Request of other type, or without Content-Type, gets 415 Unsupported Media Type before handler
+   runs. Unlike consumes, they needn't have marshaller, since body isn't unmarshalled: handler shouldn't
+   have PostType and reads body from Service.Request().Body.
+ - produces: Comma separated list of response mimes. If negotiated mime isn't in list, the first one is used.
+ - buffer: If value is "off", response will be written directly without buffering. Otherwise response
+   is marshalled to buffer first to set Content-Length, unless it's compressed.
+ - framing: If value is "sse", values of returned channel are sent as Server-Sent Events with content
+   type text/event-stream. Otherwise they are sent as marshalled, following by end.
+ - end: Define the end of one value of returned channel.
+ - stream: Comma separated mimes of Accept header which get returned channel streamed, like
+   stream:"application/x-ndjson". Other clients get values collected as an array. See above.
+ - cache: Define how long response is cached, like "30s". Only valid with method GET. See Rest.CacheSize.
+ - timeout: Define how long handler may run, like "5s", overriding Rest.HandlerTimeout, or "off" to
+   disable it. Not valid with returning channel. See Rest.HandlerTimeout.
 */
 type Processor struct {
 	pathFormatter
@@ -35,28 +206,62 @@ func (p *Processor) init(formatter pathFormatter, instance reflect.Type, name st
 	if fname == "" {
 		fname = "Handle" + name
 	}
-	f, ok := instance.MethodByName(fname)
-	if !ok {
-		return nil, nil, fmt.Errorf("can't find handler: %s", fname)
+	f, err := findHandler(instance, name, fname)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	ft := f.Type
 	ret := &processorNode{
-		findex: f.Index,
-		name_:  name,
+		findex:   f.Index,
+		name_:    name,
+		args:     tag.Get("args"),
+		buffered: tag.Get("buffer") != "off",
+		end:      tag.Get("end"),
+		framing:  tag.Get("framing"),
 	}
-	if ft.NumIn() > 2 {
-		return nil, nil, fmt.Errorf("processer(%s) input parameters should be no more than 1.", ft.Name())
+	if err := ret.initArgs(ft, 1, formatter); err != nil {
+		return nil, nil, err
 	}
-	if ft.NumIn() == 2 {
-		ret.requestType = ft.In(1)
+
+	if err := ret.initReturns(ft); err != nil {
+		return nil, nil, err
 	}
 
-	if ft.NumOut() > 1 {
-		return nil, nil, fmt.Errorf("processor(%s) return should be no more than 1 value.", ft.Name())
+	if cache := tag.Get("cache"); cache != "" {
+		d, err := time.ParseDuration(cache)
+		if err != nil || d <= 0 {
+			return nil, nil, fmt.Errorf("processor(%s) cache should be a positive duration: %s", name, cache)
+		}
+		if tag.Get("method") != http.MethodGet || ret.channel {
+			return nil, nil, fmt.Errorf("processor(%s) cache only works with GET not returning channel", name)
+		}
+		ret.cache = d
 	}
-	if ft.NumOut() == 1 {
-		ret.responseType = ft.Out(0)
+
+	if timeout := tag.Get("timeout"); timeout != "" {
+		if ret.channel {
+			return nil, nil, fmt.Errorf("processor(%s) timeout doesn't work with returning channel", name)
+		}
+		ret.timeout = -1
+		if timeout != "off" {
+			d, err := time.ParseDuration(timeout)
+			if err != nil || d <= 0 {
+				return nil, nil, fmt.Errorf("processor(%s) timeout should be a positive duration or off: %s", name, timeout)
+			}
+			ret.timeout = d
+		}
+	}
+
+	if stream := tag.Get("stream"); stream != "" {
+		if !ret.channel {
+			return nil, nil, fmt.Errorf("processor(%s) stream only works with returning channel", name)
+		}
+		streams, err := parseAccept(stream)
+		if err != nil {
+			return nil, nil, fmt.Errorf("processor(%s) stream is invalid: %s", name, err)
+		}
+		ret.streams = streams
 	}
 
 	p.pathFormatter = formatter
@@ -2,6 +2,7 @@ package rest
 
 import (
 	"fmt"
+	"net/http"
 	"reflect"
 	"testing"
 )
@@ -42,10 +43,62 @@ func (f FakeProcessor) HandleNode() {
 	f.last["output"] = ""
 }
 
+type UserID int
+
+type Slug string
+
+func (f FakeProcessor) PathArgs(id UserID, slug Slug) string {
+	f.last["method"] = "PathArgs"
+	f.last["input"] = fmt.Sprintf("%d %s", id, slug)
+	f.last["output"] = "output"
+	return "output"
+}
+
+func (f FakeProcessor) PathArgsPost(id UserID, post string) {
+	f.last["method"] = "PathArgsPost"
+	f.last["input"] = fmt.Sprintf("%d %s", id, post)
+	f.last["output"] = ""
+}
+
 func (f FakeProcessor) ErrorInput(a, b int) {}
 
-func (f FakeProcessor) ErrorOutput() (string, string) {
-	return "", ""
+func (f FakeProcessor) ErrorOutput() (string, error, string) {
+	return "", nil, ""
+}
+
+func (f FakeProcessor) Tuple() (int, string, error) {
+	return 1, "one", nil
+}
+
+func (f FakeProcessor) ReturnError() error {
+	return nil
+}
+
+func (f FakeProcessor) ValueError(post string) (string, error) {
+	return post, nil
+}
+
+func (f FakeProcessor) ValueHeader() (string, http.Header) {
+	return "", nil
+}
+
+func (f FakeProcessor) ValueHeaderError() (string, http.Header, error) {
+	return "", nil, nil
+}
+
+func (f FakeProcessor) ErrorHeader() (string, error, http.Header) {
+	return "", nil, nil
+}
+
+func (f FakeProcessor) Channel() <-chan int {
+	ch := make(chan int)
+	go func() {
+		defer close(ch)
+		for i := 1; i <= 3; i++ {
+			ch <- i
+		}
+	}()
+	return ch
 }
 
 func TestProcessorInit(t *testing.T) {
@@ -90,14 +143,81 @@ func TestProcessorInit(t *testing.T) {
 	if !ok {
 		t.Fatal("no ErrorOutput")
 	}
+	pa, ok := instanceType.MethodByName("PathArgs")
+	if !ok {
+		t.Fatal("no PathArgs")
+	}
+	pap, ok := instanceType.MethodByName("PathArgsPost")
+	if !ok {
+		t.Fatal("no PathArgsPost")
+	}
+	tu, ok := instanceType.MethodByName("Tuple")
+	if !ok {
+		t.Fatal("no Tuple")
+	}
+	re, ok := instanceType.MethodByName("ReturnError")
+	if !ok {
+		t.Fatal("no ReturnError")
+	}
+	ve, ok := instanceType.MethodByName("ValueError")
+	if !ok {
+		t.Fatal("no ValueError")
+	}
+	vh, ok := instanceType.MethodByName("ValueHeader")
+	if !ok {
+		t.Fatal("no ValueHeader")
+	}
+	vhe, ok := instanceType.MethodByName("ValueHeaderError")
+	if !ok {
+		t.Fatal("no ValueHeaderError")
+	}
+	eh, ok := instanceType.MethodByName("ErrorHeader")
+	if !ok {
+		t.Fatal("no ErrorHeader")
+	}
+	ch, ok := instanceType.MethodByName("Channel")
+	if !ok {
+		t.Fatal("no Channel")
+	}
 	var tests = []Test{
 		{"/", "", `func:"NoInputNoOutput"`, true, nino.Index, "<nil>", "<nil>"},
+		{"/:id", "", `func:"NoOutput"`, true, no.Index, "string", "<nil>"},
+		{"/:id", "", `func:"NoOutput" args:"id"`, true, no.Index, "<nil>", "<nil>"},
+		{"/:id/:slug", "", `func:"NoOutput"`, true, no.Index, "string", "<nil>"},
+		{"/:id/:slug", "", `func:"PathArgs"`, true, pa.Index, "<nil>", "string"},
+		{"/:id", "", `func:"PathArgsPost"`, true, pap.Index, "string", "<nil>"},
+		{"/:id/:slug", "", `func:"PathArgsPost"`, true, pap.Index, "<nil>", "<nil>"},
+		{"/:id", "", `func:"PathArgs"`, true, pa.Index, "rest.Slug", "string"},
+		{"/:slug/:id", "", `func:"PathArgs" args:"id, slug"`, true, pa.Index, "<nil>", "string"},
+		{"/:id/:slug", "", `func:"PathArgs" args:"id"`, false, pa.Index, "", ""},
+		{"/:id/:slug", "", `func:"PathArgs" args:"id,id"`, false, pa.Index, "", ""},
+		{"/:id/:slug", "", `func:"PathArgs" args:"id,key"`, false, pa.Index, "", ""},
+		{"/:id", "", `func:"Channel" args:"id"`, false, ch.Index, "", ""},
 		{"/", "", `func:"NoInput"`, true, ni.Index, "<nil>", "string"},
 		{"/", "", `func:"NoOutput"`, true, no.Index, "string", "<nil>"},
 		{"/", "", `func:"Normal"`, true, n.Index, "string", "string"},
 		{"/", "Node", ``, true, hn.Index, "<nil>", "<nil>"},
 		{"/", "", `func:"ErrorInput"`, false, ei.Index, "", ""},
 		{"/", "", `func:"ErrorOutput"`, false, eo.Index, "", ""},
+		{"/", "", `func:"Tuple"`, true, tu.Index, "<nil>", "[]interface {}"},
+		{"/", "", `func:"ReturnError"`, true, re.Index, "<nil>", "<nil>"},
+		{"/", "", `func:"ValueError"`, true, ve.Index, "string", "string"},
+		{"/", "", `func:"ValueHeader"`, true, vh.Index, "<nil>", "string"},
+		{"/", "", `func:"ValueHeaderError"`, true, vhe.Index, "<nil>", "string"},
+		{"/", "", `func:"ErrorHeader"`, false, eh.Index, "", ""},
+		{"/", "", `func:"Channel"`, true, ch.Index, "<nil>", "<-chan int"},
+		{"/", "", `func:"Channel" stream:"application/x-ndjson"`, true, ch.Index, "<nil>", "<-chan int"},
+		{"/", "", `func:"Channel" stream:"ndjson"`, false, ch.Index, "", ""},
+		{"/", "", `func:"NoInput" stream:"application/x-ndjson"`, false, ni.Index, "", ""},
+		{"/", "", `func:"NoInput" method:"GET" cache:"30s"`, true, ni.Index, "<nil>", "string"},
+		{"/", "", `func:"NoInput" method:"POST" cache:"30s"`, false, ni.Index, "", ""},
+		{"/", "", `func:"NoInput" method:"GET" cache:"soon"`, false, ni.Index, "", ""},
+		{"/", "", `func:"Channel" method:"GET" cache:"30s"`, false, ch.Index, "", ""},
+		{"/", "", `func:"NoInput" timeout:"5s"`, true, ni.Index, "<nil>", "string"},
+		{"/", "", `func:"NoInput" timeout:"off"`, true, ni.Index, "<nil>", "string"},
+		{"/", "", `func:"NoInput" timeout:"soon"`, false, ni.Index, "", ""},
+		{"/", "", `func:"NoInput" timeout:"0s"`, false, ni.Index, "", ""},
+		{"/", "", `func:"Channel" timeout:"5s"`, false, ch.Index, "", ""},
 	}
 	for i, test := range tests {
 		node := new(Processor)
@@ -0,0 +1,115 @@
+package rest
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// errQueueClosed is returned by writing stream whose send queue is closed, like in a goroutine which
+// outlives handler.
+var errQueueClosed = errors.New("stream queue is closed")
+
+// streamQueue is a bounded send queue of stream. Frames are written to w in background.
+type streamQueue struct {
+	w        io.Writer
+	policy   string
+	frames   chan []byte
+	locker   sync.Mutex
+	done     bool
+	closed   chan struct{}
+	errLock  sync.Mutex
+	err      error
+	ndropped int64
+	nwritten int64
+}
+
+func newStreamQueue(w io.Writer, size int, policy string) *streamQueue {
+	ret := &streamQueue{
+		w:      w,
+		policy: policy,
+		frames: make(chan []byte, size),
+		closed: make(chan struct{}),
+	}
+	go ret.loop()
+	return ret
+}
+
+func (q *streamQueue) loop() {
+	defer close(q.closed)
+	for b := range q.frames {
+		if q.lastError() != nil {
+			continue
+		}
+		n, err := q.w.Write(b)
+		atomic.AddInt64(&q.nwritten, int64(n))
+		if err != nil {
+			q.errLock.Lock()
+			q.err = err
+			q.errLock.Unlock()
+		}
+	}
+}
+
+func (q *streamQueue) lastError() error {
+	q.errLock.Lock()
+	defer q.errLock.Unlock()
+	return q.err
+}
+
+// push puts frame b into queue, and returns the error of writing previous frames, or errQueueClosed if
+// queue is closed.
+func (q *streamQueue) push(b []byte) error {
+	if err := q.lastError(); err != nil {
+		return err
+	}
+	q.locker.Lock()
+	defer q.locker.Unlock()
+	if q.done {
+		return errQueueClosed
+	}
+	switch q.policy {
+	case "drop-newest":
+		select {
+		case q.frames <- b:
+		default:
+			atomic.AddInt64(&q.ndropped, 1)
+		}
+	case "drop-oldest":
+		for {
+			select {
+			case q.frames <- b:
+				return nil
+			default:
+			}
+			select {
+			case <-q.frames:
+				atomic.AddInt64(&q.ndropped, 1)
+			default:
+			}
+		}
+	default:
+		q.frames <- b
+	}
+	return nil
+}
+
+func (q *streamQueue) dropped() int64 {
+	return atomic.LoadInt64(&q.ndropped)
+}
+
+func (q *streamQueue) written() int64 {
+	return atomic.LoadInt64(&q.nwritten)
+}
+
+// close waits all frames in queue written. Frames pushed after it are rejected.
+func (q *streamQueue) close() {
+	q.locker.Lock()
+	if !q.done {
+		q.done = true
+		close(q.frames)
+	}
+	q.locker.Unlock()
+	<-q.closed
+}
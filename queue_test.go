@@ -0,0 +1,87 @@
+package rest
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+type gateWriter struct {
+	entered chan bool
+	gate    chan bool
+	buf     bytes.Buffer
+	err     error
+}
+
+func (w *gateWriter) Write(b []byte) (int, error) {
+	w.entered <- true
+	<-w.gate
+	if w.err != nil {
+		return 0, w.err
+	}
+	return w.buf.Write(b)
+}
+
+func TestStreamQueue(t *testing.T) {
+	type Test struct {
+		policy string
+
+		dropped int64
+		output  string
+	}
+	var tests = []Test{
+		{"drop-newest", 2, "123"},
+		{"drop-oldest", 2, "145"},
+	}
+	for i, test := range tests {
+		w := &gateWriter{
+			entered: make(chan bool, 10),
+			gate:    make(chan bool, 10),
+		}
+		q := newStreamQueue(w, 2, test.policy)
+		q.push([]byte("1"))
+		<-w.entered // "1" is being written, and blocked
+		for _, b := range []string{"2", "3", "4", "5"} {
+			err := q.push([]byte(b))
+			equal(t, err, nil, "test %d", i)
+		}
+		equal(t, q.dropped(), test.dropped, "test %d", i)
+		for j := 0; j < 10; j++ {
+			w.gate <- true
+		}
+		q.close()
+		equal(t, w.buf.String(), test.output, "test %d", i)
+		equal(t, q.written(), int64(len(test.output)), "test %d", i)
+	}
+}
+
+func TestStreamQueueError(t *testing.T) {
+	w := &gateWriter{
+		entered: make(chan bool, 10),
+		gate:    make(chan bool, 10),
+		err:     errors.New("closed"),
+	}
+	w.gate <- true
+	q := newStreamQueue(w, 1, "block")
+	equal(t, q.push([]byte("1")), nil)
+	<-w.entered
+	q.close()
+	equal(t, q.push([]byte("2")), w.err)
+}
+
+func TestStreamQueuePushAfterClose(t *testing.T) {
+	for i, policy := range []string{"block", "drop-newest", "drop-oldest"} {
+		w := &gateWriter{
+			entered: make(chan bool, 10),
+			gate:    make(chan bool, 10),
+		}
+		w.gate <- true
+		q := newStreamQueue(w, 1, policy)
+		equal(t, q.push([]byte("1")), nil, "test %d", i)
+		q.close()
+		equal(t, q.push([]byte("2")), errQueueClosed, "test %d", i)
+		q.close()
+		equal(t, w.buf.String(), "1", "test %d", i)
+		equal(t, q.dropped(), int64(0), "test %d", i)
+	}
+}
@@ -81,6 +81,11 @@ Define a service struct like this:
 The field tag of Service configure the parameters of processor, like method, path, or function which
 will process the request.
 
+Tags can also be written in combined form under "rest" key, to avoid conflicting with tags of other
+libraries. If a key exists in both forms, combined form wins:
+
+	GetHello rest.Processor `rest:"method=GET,path=/hello/:to,func=HandleHello"`
+
 The path of processor can capture arguments, which will pass to process function by order in path. Arguments
 type can be string or int, or any type which kind is string or int.
 
@@ -109,47 +114,295 @@ Or use gorilla mux and work with other http handlers:
 package rest
 
 import (
+	gocontext "context"
+	"errors"
 	"fmt"
 	"github.com/ant0ine/go-urlrouter"
+	"log"
 	"net/http"
 	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Rest handle the http request and call to correspond the handler(processor or streaming).
 type Rest struct {
+	// DefaultHeaders are set to every response before calling handler, like security headers.
+	// Handler can overwrite them.
+	DefaultHeaders http.Header
+	// MaxURLLength limits the length of request uri, including query. Longer request is rejected
+	// with 414 Request-URI Too Long before routing. 0 means unlimited.
+	MaxURLLength int
+	// MethodOverride enables X-HTTP-Method-Override header, or query parameter _method if there's no
+	// header, which overrides the method of POST request for clients behind proxies allowing only GET
+	// and POST. Override of other methods is ignored, so a safe method like GET can't be turned into an
+	// unsafe one. Enable it only if handlers of overridden
+	// methods don't rely on the method for security, like CSRF protection only checking POST.
+	MethodOverride bool
+	// RetryAfter is sent as Retry-After header with every 503 Service Unavailable response, unless
+	// handler sets one with Service.RetryAfter. 0 means no header.
+	RetryAfter time.Duration
+	// SniffContentType makes handler returning []byte or io.Reader write it to response as is, instead
+	// of marshalling it. If handler doesn't set Content-Type, it's detected from the first 512 bytes
+	// with http.DetectContentType.
+	SniffContentType bool
+	// Logger is the base of loggers returned by Service.Logger. nil means the standard logger.
+	Logger *log.Logger
+	// ResponseWrapper wraps the value returned by handler before marshalling, like an envelope
+	// {"data": v, "meta": {...}}. Errors and io.WriterTo values aren't wrapped. Frames of streaming
+	// with tag wrap:"on" are wrapped too. nil means no wrapping.
+	ResponseWrapper func(v interface{}, s Service) interface{}
+	// ResponseTransform replaces the value returned by handler before it's wrapped and marshalled,
+	// like redacting fields the caller isn't allowed to see, with the user stored in Service.Value.
+	// Like ResponseWrapper, errors and io.WriterTo values aren't transformed. Values of channel returned
+	// by processor, and frames of streaming with tag transform:"on", are transformed too. Transformed
+	// response depends on the caller, so processors with cache tag bypass the cache while it's set. nil
+	// means no transforming.
+	ResponseTransform func(v interface{}, s Service) interface{}
+	// ErrorMime is the mime of error responses, replied by Service.Error or returned by handler,
+	// regardless of the mime negotiated for success response, so clients can always parse errors.
+	// "" or a mime without registered marshaller means errors use the negotiated mime.
+	ErrorMime string
+	// ProblemJSON replies errors of Service.Error, or returned by handler, as Problem of RFC 7807 with
+	// content type application/problem+json, instead of marshalling them with ErrorMime or the
+	// negotiated mime. See Problem for how errors are converted.
+	ProblemJSON bool
+	// StrictRequestParsing rejects request with ambiguous body length with 400 Bad Request before
+	// routing, against request smuggling. Rejected anomalies are:
+	//  - more than one Content-Length value, in several headers or comma separated in one header,
+	//    even if they are the same;
+	//  - both Content-Length and Transfer-Encoding, whatever the encoding is.
+	// Under http.Server, net/http already rejects differing Content-Length values, merges same ones
+	// and drops Content-Length of chunked request before the handler, so it only rejects requests
+	// built in other ways, like passed by a proxy or a test, and doesn't replace a front proxy
+	// normalizing framing.
+	StrictRequestParsing bool
+	// IdempotencyStore makes POST and PATCH requests with Idempotency-Key header idempotent, saving
+	// their responses in it. See Idempotency. nil means Idempotency-Key is ignored.
+	IdempotencyStore IdempotencyStore
+	// IdempotencyScope returns the caller of request, like the authenticated user id, which scopes
+	// idempotency keys, so keys of different callers never share a response. nil means the scope is a
+	// hash of Authorization header.
+	IdempotencyScope func(r *http.Request) string
+	// CacheSize is the max number of responses cached by processors with cache tag. When it's full,
+	// expired responses are removed, then the one expiring first. 0 means 1024.
+	CacheSize int
+	// CleanPath matches request whose path has double slashes or dot segments, like
+	// "/prefix//hello/./rest", by its canonical form "/prefix/hello/rest". Trailing slash is kept.
+	CleanPath bool
+	// RedirectCleanPath replies request whose path isn't canonical with redirection to the canonical
+	// one, query kept, instead of serving it. It's 301 Moved Permanently for GET and HEAD, and 308
+	// Permanent Redirect for other methods, so method and body are kept.
+	RedirectCleanPath bool
+	// SelectMarshaller chooses the response mime of request by business logic, like API key or
+	// feature flag, instead of Accept header. If it returns ok and the mime has registered marshaller,
+	// the mime overrides the negotiated one, but still gives way to produces tag of route. Otherwise the
+	// negotiated mime is used. nil means always negotiating.
+	SelectMarshaller func(r *http.Request) (mime string, ok bool)
+	// BodyReadTimeout limits the time to read request body since request arrived, against slow clients
+	// trickling body to tie up handlers. Reading body after it fails with ErrBodyReadTimeout, and
+	// request gets 408 Request Timeout with header Connection: close. 0 means unlimited.
+	//
+	// It's a tradeoff: a mobile client on a poor network uploading a large body may be legitimately
+	// slow, so set it by the largest body accepted and the slowest client supported, or prefer
+	// MinBodyReadRate. The goroutine reading body is left blocked until the connection is closed, so
+	// also set http.Server.ReadTimeout to release it.
+	BodyReadTimeout time.Duration
+	// MinBodyReadRate is the minimum average rate in bytes per second of reading request body, with
+	// one second of grace, like BodyReadTimeout scaling with received bytes. A slower client gets 408
+	// Request Timeout as BodyReadTimeout. It's checked only while handler waits for body, so a handler
+	// reading slowly itself isn't rejected. 0 means unlimited.
+	MinBodyReadRate int
+	// MultipartMemory is the max bytes of multipart request body kept in memory when binding form
+	// fields and files. Beyond it, files are stored in temporary files, removed after handler returns.
+	// 0 means 32 MB.
+	MultipartMemory int64
+	// HandlerTimeout limits the time of every processor handler, as a safety net for a service with
+	// many handlers. When it's exceeded, request gets 503 Service Unavailable with ErrHandlerTimeout, and
+	// Service.Context() is cancelled so handler can stop working. Tag timeout of processor overrides
+	// it. Streaming routes and processors returning channel are exempt. 0 means unlimited.
+	//
+	// Response of handler is buffered to be discarded on timeout, so it isn't sent until handler returns.
+	// Request is served until handler returns, even after the timeout reply is sent, so handler should
+	// return soon after Service.Context() is done. Handler runs in another goroutine, so its panic is
+	// rethrown as HandlerPanic with the stack of handler.
+	HandlerTimeout time.Duration
+	// Tap is called after every request is served, including the ones rejected before routing or
+	// served by fallback, with the request, the status of response and the duration. It's meant for
+	// assertions in tests, see Rest.Test, rather than metrics, and it's called synchronously, so it
+	// slows every request down. Status is 200 if nothing is written. Keep it nil in production.
+	Tap func(req *http.Request, status int, dur time.Duration)
+	// DescribeOptions replies OPTIONS request of a path without its own OPTIONS route with header Allow
+	// listing methods of the path, and a json body describing the path parameters, and the request and
+	// response schemas of each method, inferred like OpenAPI. It helps client developers explore the
+	// api, but exposes the schemas to anyone, so it's off by default.
+	DescribeOptions bool
+	// FormatExtensions maps extensions of the last path segment, like ".json", to mimes, so clients can
+	// force response format by url, like "/hello/rest.json". Extension whose mime has a registered
+	// marshaller is stripped before routing, and its mime overrides the one negotiated by Accept header
+	// or chosen by SelectMarshaller, but still gives way to produces tag of route. If stripped path
+	// matches no route, the original path is routed, so a resource whose name ends with the extension
+	// still works. nil disables it.
+	FormatExtensions map[string]string
+	// PreRoute is called with every request first in ServeHTTP, before any check or routing, so it can
+	// rewrite the request, like stripping a tenant id prepended to path by gateway. Rewritten request
+	// is checked by MaxURLLength and CleanPath, routed, and seen by Tap. It can't reply, and like
+	// handlers, its panic isn't recovered by Rest but by http.Server, which closes the connection. nil
+	// means no rewriting.
+	PreRoute func(r *http.Request)
+	// BaseContext returns the base context of request, like one carrying deadline or values from
+	// upstream middleware. Request().Context() and Service.Context() are derived from it instead of the
+	// original request context. If it returns nil, the original one is used. nil means the original
+	// request context is always used. Base context not derived from the original one won't be done
+	// when client disconnects.
+	BaseContext func(r *http.Request) gocontext.Context
+	// OverlapHandler is called when two nodes with same method have paths which both can match a url,
+	// like "/hello/:to" and "/hello/rest", while building routes in New and Reload, or registering
+	// handler by HandleFunc. If it returns error, that fails with the error. Node of method "*"
+	// overlapping with node of a specific method is reported with the specific method, since the latter
+	// is matched first. Paths which match exactly the same urls always fail, unless one node has method
+	// "*". nil means overlapping is ignored.
+	OverlapHandler func(method, path1, path2 string) error
+
+	mu            sync.RWMutex
+	table         *table
+	enabled       func(field string) bool
+	fallback      http.Handler
+	errorStatuses []errorStatus
+	matchers      []matcher
+	cache         responseCache
+	readOnly      int32
+}
+
+// table is the routing state built from service instance. It's replaced as a whole by Reload, so a
+// request keeps using the table it started with.
+type table struct {
 	instance       reflect.Value
 	serviceIndex   int
 	router         *urlrouter.Router
-	prefix         string
+	routes         []*route
+	prefixes       []string
 	needCompress   bool
 	defaultMime    string
 	defaultCharset string
 	ctxField       reflect.Value
+	// hosts are host patterns of routes, in order of declaration.
+	hosts []string
+}
+
+type errorStatus struct {
+	err    error
+	status int
+}
+
+// Create Rest instance from service instance, configured by opts, like:
+//
+//	handler, err := rest.New(&RestExample{}, rest.WithMaxURLLength(2048), rest.WithErrorMime("application/json"))
+func New(s interface{}, opts ...Option) (*Rest, error) {
+	return NewFiltered(s, nil, opts...)
+}
+
+/*
+RoutesEnabler is implemented by service which toggles its nodes in one place, like features behind a
+license:
+
+	func (r MyService) EnabledRoutes() map[string]bool {
+		return map[string]bool{
+			"Export": r.config.License.Export,
+		}
+	}
+
+Keys are field names of nodes. Node absent in map, or mapped to true, is enabled. It's consulted when
+Rest is created or reloaded. See NewFiltered for how it works with tag enabled.
+*/
+type RoutesEnabler interface {
+	EnabledRoutes() map[string]bool
+}
+
+// NewFiltered creates Rest instance like New, but only registers nodes whose field name makes enabled
+// return true, so routes can be toggled by config at startup. Nil enabled registers all nodes. Node with
+// tag enabled:"false" is never registered.
+//
+// Service may also implement RoutesEnabler. A node is registered only if its tag, enabled and
+// EnabledRoutes all enable it, so any of them can disable it.
+//
+// Disabled nodes aren't initialized, so their handlers aren't checked, and they don't conflict or
+// overlap with other routes.
+func NewFiltered(s interface{}, enabled func(field string) bool, opts ...Option) (*Rest, error) {
+	ret := &Rest{enabled: enabled}
+	for _, opt := range opts {
+		if err := opt(ret); err != nil {
+			return nil, err
+		}
+	}
+	t, err := newTable(s, enabled, ret.OverlapHandler)
+	if err != nil {
+		return nil, err
+	}
+	ret.table = t
+	return ret, nil
+}
+
+// Reload rebuilds routes from service instance s, like New, and replaces current routes atomically.
+// Requests being served finish with old routes, and new requests use new ones. If building fails,
+// current routes are kept. Nodes are filtered by the function given to NewFiltered, if any. Routes
+// registered by HandleFunc or EnableRouteDebug and cached responses are dropped, and options of Rest
+// are kept.
+func (r *Rest) Reload(s interface{}) error {
+	t, err := newTable(s, r.enabled, r.OverlapHandler)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.table = t
+	r.mu.Unlock()
+	r.cache.invalidate("")
+	return nil
+}
+
+// load returns current routing table.
+func (r *Rest) load() *table {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.table
 }
 
-// Create Rest instance from service instance
-func New(s interface{}) (*Rest, error) {
+func newTable(s interface{}, enabled func(field string) bool, overlapHandler func(method, path1, path2 string) error) (*table, error) {
 	router := new(urlrouter.Router)
 
 	instance := reflect.ValueOf(s)
 	instance = reflect.Indirect(instance)
 	t := instance.Type()
-	serviceIndex, prefix, mime, charset := -1, "", "", ""
+	serviceIndex, mime, charset, host := -1, "", "", ""
+	var prefixes []string
 	needCompress := false
+	var routes []*route
+	var hosts []string
 	for i, n := 0, instance.NumField(); i < n; i++ {
 		field := instance.Field(i)
 		if field.Type().String() == "rest.Service" {
-			p, m, c, err := initService(field, t.Field(i).Tag)
+			tag := parseTag(t.Field(i).Tag)
+			p, m, c, err := initService(field, tag)
 			if err != nil {
 				return nil, err
 			}
-			serviceIndex, prefix, mime, charset = i, p, m, c
-			needCompress = t.Field(i).Tag.Get("compress") == "on"
+			serviceIndex, prefixes, mime, charset = i, p, m, c
+			needCompress = tag.Get("compress") == "on"
+			if host, err = parseHost(tag.Get("host")); err != nil {
+				return nil, fmt.Errorf("%s host is invalid: %s", t.Name(), err)
+			}
 		}
 	}
 	if serviceIndex < 0 {
 		return nil, fmt.Errorf("%s doesn't contain rest.Service field.", t.Name())
 	}
+	var enabledRoutes map[string]bool
+	if e, ok := hookInstance(instance).(RoutesEnabler); ok {
+		enabledRoutes = e.EnabledRoutes()
+	}
 	for i, n := 0, instance.NumField(); i < n; i++ {
 		node_ := instance.Field(i)
 		field := t.Field(i)
@@ -164,77 +417,546 @@ func New(s interface{}) (*Rest, error) {
 			continue
 		}
 
-		method := field.Tag.Get("method")
+		tag := parseTag(field.Tag)
+		if e, ok := enabledRoutes[field.Name]; ok && !e {
+			continue
+		}
+		if tag.Get("enabled") == "false" || (enabled != nil && !enabled(field.Name)) {
+			continue
+		}
+		method := tag.Get("method")
 		if method == "" {
 			return nil, fmt.Errorf("%s node's tag must contain method", field.Name)
 		}
-		path := field.Tag.Get("path")
+		path, constraints, err := splitConstraints(tag.Get("path"))
+		if err != nil {
+			return nil, fmt.Errorf("%s path %s is invalid: %s", field.Name, tag.Get("path"), err)
+		}
 
-		formatter := pathToFormatter(prefix, path)
-		handlers, paths, err := pNode.init(formatter, t, field.Name, field.Tag)
+		formatter := pathToFormatter(prefixes[0], path)
+		handlers, paths, err := pNode.init(formatter, t, field.Name, tag)
 		if err != nil {
 			return nil, err
 		}
-		for i := range handlers {
-			router.Routes = append(router.Routes, urlrouter.Route{
-				PathExp: fmt.Sprintf("/%s/%s", method, paths[i]),
-				Dest:    handlers[i],
-			})
+		for _, prefix := range prefixes {
+			for i := range handlers {
+				p := paths[i]
+				if prefix != prefixes[0] {
+					p = changePrefix(p, prefixes[0], prefix)
+				}
+				r, err := newRoute(method, p, field.Name, handlers[i], tag)
+				if err != nil {
+					return nil, err
+				}
+				r.constraints = constraints
+				if r.host == "" {
+					r.host = host
+				}
+				if err := checkRoute(routes, r, overlapHandler); err != nil {
+					return nil, err
+				}
+				routes = append(routes, r)
+				if r.host != "" && !inList(hosts, r.host) {
+					hosts = append(hosts, r.host)
+				}
+				router.Routes = append(router.Routes, urlrouter.Route{
+					PathExp: r.pathExp(),
+					Dest:    r,
+				})
+			}
 		}
 	}
 
+	router.Routes = withRootAliases(router.Routes, routes, prefixes)
 	err := router.Start()
 	if err != nil {
 		return nil, err
 	}
 
-	return &Rest{
+	return &table{
 		instance:       instance,
 		serviceIndex:   serviceIndex,
 		router:         router,
-		prefix:         prefix,
+		routes:         routes,
+		prefixes:       prefixes,
 		needCompress:   needCompress,
 		defaultMime:    mime,
 		defaultCharset: charset,
 		ctxField:       instance.Field(serviceIndex).FieldByName("context"),
+		hosts:          hosts,
 	}, nil
 }
 
-// Get the url prefix of service.
+/*
+HandleFunc registers function fn as a processor of method and path under service prefix. It should be
+called before serving.
+
+Function fn takes Service as first parameter, which is same as embedded one in service, and other
+parameters same as processor's handle function. It may return 0 or 1 value for response body, like below:
+
+ - func(s rest.Service)
+ - func(s rest.Service, post PostType) ResponseType
+ - func(s rest.Service, id int, post PostType) ResponseType // path is "/item/:id"
+*/
+func (r *Rest) HandleFunc(method, path string, fn interface{}) error {
+	prefixes := r.Prefixes()
+	clean, constraints, err := splitConstraints(path)
+	if err != nil {
+		return fmt.Errorf("%s path %s is invalid: %s", method, path, err)
+	}
+	formatter := pathToFormatter(prefixes[0], clean)
+	node, err := funcNode(fn, formatter, method+" "+path)
+	if err != nil {
+		return err
+	}
+	for _, prefix := range prefixes {
+		rt, err := newRoute(method, changePrefix(formatter, prefixes[0], prefix), node.name_, node, "")
+		if err != nil {
+			return err
+		}
+		rt.funcName = node.name_
+		rt.constraints = constraints
+		if err := r.addRoute(rt, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// funcNode creates processor node of function fn, whose path parameters are in formatter. desc
+// describes where fn is registered in error.
+func funcNode(fn interface{}, formatter pathFormatter, desc string) (*processorNode, error) {
+	f := reflect.ValueOf(fn)
+	if f.Kind() != reflect.Func {
+		return nil, fmt.Errorf("handler of %s should be a function", desc)
+	}
+	name := runtime.FuncForPC(f.Pointer()).Name()
+	ft := f.Type()
+	if ft.NumIn() < 1 || ft.In(0) != reflect.TypeOf(Service{}) {
+		return nil, fmt.Errorf("processer(%s) first input parameter should be rest.Service.", name)
+	}
+	node := &processorNode{
+		name_:    name,
+		fn:       f,
+		buffered: true,
+	}
+	if err := node.initArgs(ft, 1, formatter); err != nil {
+		return nil, err
+	}
+	if err := node.initReturns(ft); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// addRoute registers rt to router. Listed route is checked for conflicts, and is included in Routes().
+func (r *Rest) addRoute(rt *route, listed bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := *r.table
+	if listed {
+		if err := checkRoute(t.routes, rt, r.OverlapHandler); err != nil {
+			return err
+		}
+	}
+	var routerRoutes []urlrouter.Route
+	for _, r := range t.router.Routes {
+		// alias of prefix root route gives way to the route of its own.
+		if r.PathExp == rt.pathExp() && r.Dest.(*route).pathExp() != r.PathExp {
+			continue
+		}
+		routerRoutes = append(routerRoutes, r)
+	}
+	t.router = &urlrouter.Router{
+		Routes: withRootAliases(append(routerRoutes, urlrouter.Route{
+			PathExp: rt.pathExp(),
+			Dest:    rt,
+		}), []*route{rt}, t.prefixes),
+	}
+	if err := t.router.Start(); err != nil {
+		return err
+	}
+	if listed {
+		t.routes = append(append([]*route(nil), t.routes...), rt)
+	}
+	r.table = &t
+	return nil
+}
+
+// withRootAliases appends to router routes the aliases of routes at prefix root, so route of path
+// "/prefix" also matches "/prefix/", and vice versa. Alias isn't added if the other form has its own
+// route.
+func withRootAliases(routerRoutes []urlrouter.Route, routes []*route, prefixes []string) []urlrouter.Route {
+	exists := make(map[string]bool)
+	for _, r := range routerRoutes {
+		exists[r.PathExp] = true
+	}
+	for _, rt := range routes {
+		p := string(rt.path)
+		var alias string
+		switch {
+		case p != "/" && inList(prefixes, p):
+			alias = p + "/"
+		case len(p) > 1 && strings.HasSuffix(p, "/") && inList(prefixes, p[:len(p)-1]):
+			alias = p[:len(p)-1]
+		default:
+			continue
+		}
+		pathExp := fmt.Sprintf("/%s/%s", rt.routerMethod(), routerPath(alias))
+		if exists[pathExp] {
+			continue
+		}
+		exists[pathExp] = true
+		routerRoutes = append(routerRoutes, urlrouter.Route{
+			PathExp: pathExp,
+			Dest:    rt,
+		})
+	}
+	return routerRoutes
+}
+
+// Get the url prefix of service. If service has several prefixes, it's the primary one.
 func (r *Rest) Prefix() string {
-	return r.prefix
+	return r.load().prefixes[0]
+}
+
+// Prefixes returns all url prefixes of service, the primary one first.
+func (r *Rest) Prefixes() []string {
+	return append([]string(nil), r.load().prefixes...)
+}
+
+// RegisterErrorStatus maps err to http status. If a handler returns an error matching err with
+// errors.Is, response gets the status. Errors are matched in registered order. Error not matching
+// any registered one gets 500 Internal Server Error, except ErrBodyReadTimeout getting 408 Request
+// Timeout, and Problem with Status getting its status.
+func (r *Rest) RegisterErrorStatus(err error, status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errorStatuses = append(r.errorStatuses, errorStatus{err, status})
+}
+
+func (r *Rest) errorStatus(err error) int {
+	r.mu.RLock()
+	statuses := r.errorStatuses
+	r.mu.RUnlock()
+	for _, s := range statuses {
+		if errors.Is(err, s.err) {
+			return s.status
+		}
+	}
+	if errors.Is(err, ErrBodyReadTimeout) {
+		return http.StatusRequestTimeout
+	}
+	var p Problem
+	if errors.As(err, &p) && p.Status != 0 {
+		return p.Status
+	}
+	return http.StatusInternalServerError
+}
+
+// SetReadOnly switches read-only mode of r, which can be done while serving, like draining writes for
+// a maintenance window. In read-only mode, POST, PUT, PATCH and DELETE requests get 503 Service
+// Unavailable before routing, with Retry-After of Rest.RetryAfter, or 60 seconds if it's 0. Methods
+// are checked after overriding, see Rest.MethodOverride.
+func (r *Rest) SetReadOnly(readOnly bool) {
+	var v int32
+	if readOnly {
+		v = 1
+	}
+	atomic.StoreInt32(&r.readOnly, v)
+}
+
+// rejectWrite replies 503 Service Unavailable to req if it mutates in read-only mode, and returns
+// whether it's rejected.
+func (r *Rest) rejectWrite(w http.ResponseWriter, req *http.Request) bool {
+	if atomic.LoadInt32(&r.readOnly) == 0 {
+		return false
+	}
+	switch req.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+	default:
+		return false
+	}
+	retryAfter := r.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = time.Minute
+	}
+	w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+	http.Error(w, "service is read-only", http.StatusServiceUnavailable)
+	return true
+}
+
+// Fallback sets the handler of requests which don't match any route, like serving index.html of
+// a single page application or proxying to another server. The handler receives the original
+// request, before any method override. Without fallback, unmatched request gets 404 Not Found.
+func (r *Rest) Fallback(h http.Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fallback = h
+}
+
+// findRoute finds the route of request r and its vars. Match functions are tried before router, then
+// routes of host patterns matching request host in order of declaration, then routes of any host.
+// Routes of request method are tried before routes of method "*".
+func (re *Rest) findRoute(t *table, r *http.Request) (*route, map[string]string) {
+	if rt, vars := re.matchRoute(r); rt != nil {
+		return rt, vars
+	}
+	if len(t.hosts) > 0 {
+		host := normalizeHost(r.Host)
+		for _, pattern := range t.hosts {
+			if !matchHost(pattern, host) {
+				continue
+			}
+			if rt, vars := t.find(r, hostMethod(r.Method, pattern)); rt != nil {
+				return rt, vars
+			}
+			if rt, vars := t.find(r, hostMethod(anyMethod, pattern)); rt != nil {
+				return rt, vars
+			}
+		}
+	}
+	if rt, vars := t.find(r, r.Method); rt != nil {
+		return rt, vars
+	}
+	return t.find(r, anyMethod)
+}
+
+// findMethod finds the route of method and path of request r, trying routes of host patterns matching
+// request host before routes of any host, like findRoute.
+func (t *table) findMethod(r *http.Request, method string) (*route, map[string]string) {
+	if len(t.hosts) > 0 {
+		host := normalizeHost(r.Host)
+		for _, pattern := range t.hosts {
+			if !matchHost(pattern, host) {
+				continue
+			}
+			if rt, vars := t.find(r, hostMethod(method, pattern)); rt != nil {
+				return rt, vars
+			}
+		}
+	}
+	return t.find(r, method)
+}
+
+// hostRoutes returns groups of routes serving requests of host, in order of precedence: routes of each
+// host pattern matching host, in order of declaration, then routes of any host. Empty host only
+// matches routes of any host.
+func (t *table) hostRoutes(host string) [][]*route {
+	var ret [][]*route
+	if host != "" {
+		for _, pattern := range t.hosts {
+			if !matchHost(pattern, host) {
+				continue
+			}
+			var group []*route
+			for _, rt := range t.routes {
+				if rt.host == pattern {
+					group = append(group, rt)
+				}
+			}
+			ret = append(ret, group)
+		}
+	}
+	var group []*route
+	for _, rt := range t.routes {
+		if rt.host == "" {
+			group = append(group, rt)
+		}
+	}
+	return append(ret, group)
+}
+
+// find finds the route of method and path of request r in router.
+func (t *table) find(r *http.Request, method string) (*route, map[string]string) {
+	path := r.URL.Path
+	r.URL.Path = fmt.Sprintf("/%s/%s", method, path)
+	dest, vars := t.router.FindRouteFromURL(r.URL)
+	r.URL.Path = path
+	if dest == nil {
+		return nil, nil
+	}
+	rt := dest.Dest.(*route)
+	if !rt.allows(vars) {
+		return nil, nil
+	}
+	return rt, vars
 }
 
 // Serve the http request.
 func (re *Rest) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	path := r.URL.Path
-	if method := r.URL.Query().Get("_method"); method != "" {
-		r.Method = method
+	start := time.Now()
+	if re.Tap != nil {
+		tw := &tapResponseWriter{ResponseWriter: w}
+		w = tw
+		defer func() {
+			if tw.status == 0 {
+				tw.status = http.StatusOK
+			}
+			re.Tap(r, tw.status, time.Since(start))
+		}()
 	}
-	r.URL.Path = fmt.Sprintf("/%s/%s", r.Method, path)
-	dest, vars := re.router.FindRouteFromURL(r.URL)
-	if dest == nil {
+	if re.PreRoute != nil {
+		re.PreRoute(r)
+	}
+	for k, v := range re.DefaultHeaders {
+		w.Header()[k] = append([]string(nil), v...)
+	}
+	if re.MaxURLLength > 0 && len(r.URL.RequestURI()) > re.MaxURLLength {
+		w.WriteHeader(http.StatusRequestURITooLong)
+		return
+	}
+	if re.StrictRequestParsing {
+		if err := checkFraming(r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if re.CleanPath || re.RedirectCleanPath {
+		if p := cleanPath(r.URL.Path); p != r.URL.Path {
+			u := *r.URL
+			u.Path, u.RawPath = p, ""
+			if re.RedirectCleanPath {
+				code := http.StatusPermanentRedirect
+				if r.Method == http.MethodGet || r.Method == http.MethodHead {
+					code = http.StatusMovedPermanently
+				}
+				http.Redirect(w, r, u.RequestURI(), code)
+				return
+			}
+			r.URL = &u
+		}
+	}
+	t := re.load()
+	method := r.Method
+	if re.MethodOverride && method == http.MethodPost {
+		m := r.Header.Get("X-HTTP-Method-Override")
+		if m == "" {
+			m = r.URL.Query().Get("_method")
+		}
+		if m != "" {
+			r.Method = strings.ToUpper(m)
+		}
+	}
+	if re.rejectWrite(w, r) {
+		return
+	}
+	var route *route
+	var vars map[string]string
+	formatMime := ""
+	if re.FormatExtensions != nil {
+		if p, mime, ok := splitFormatExtension(r.URL.Path, re.FormatExtensions); ok {
+			u := *r.URL
+			u.Path, u.RawPath = p, ""
+			orig := r.URL
+			r.URL = &u
+			if route, vars = re.findRoute(t, r); route != nil {
+				formatMime = mime
+			} else {
+				r.URL = orig
+			}
+		}
+	}
+	if route == nil {
+		route, vars = re.findRoute(t, r)
+	}
+	if route == nil && re.DescribeOptions && r.Method == http.MethodOptions {
+		b, methods, err := describeOptions(t, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if b != nil {
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Write(b)
+			return
+		}
+	}
+	if route == nil {
+		re.mu.RLock()
+		fallback := re.fallback
+		re.mu.RUnlock()
+		if fallback != nil {
+			r.Method = method
+			fallback.ServeHTTP(w, r)
+			return
+		}
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
-	r.URL.Path = path
 
-	handler := dest.Dest.(handler)
-
-	if !re.needCompress {
+	// static files may be precompressed even if service doesn't compress.
+	gzipOK := acceptsGzip(r)
+	if !t.needCompress {
 		delete(r.Header, "Accept-Encoding")
 	}
 
-	ctx, err := newContext(w, r, vars, re.defaultMime, re.defaultCharset)
+	if re.BaseContext != nil {
+		if base := re.BaseContext(r); base != nil {
+			r = r.WithContext(base)
+		}
+	}
+	ctx, err := newContext(w, r, vars, t.defaultMime, t.defaultCharset)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	ctx.name = handler.name()
+	defer ctx.cancel()
+	defer ctx.finish()
+	ctx.count(start)
+	if (re.BodyReadTimeout > 0 || re.MinBodyReadRate > 0) && r.Body != nil && r.Body != http.NoBody {
+		ctx.request.Body = newSlowBodyReader(ctx.request.Body, w.Header(), start, re.BodyReadTimeout, re.MinBodyReadRate)
+	}
+	ctx.name = route.handler.name()
+	ctx.gzipOK = gzipOK
+	ctx.meta = route.meta
+	ctx.captures = route.captures
+	ctx.errorStatus = re.errorStatus
+	ctx.baseLogger = re.Logger
+	ctx.wrapper = re.ResponseWrapper
+	ctx.transform = re.ResponseTransform
+	ctx.retryAfter = re.RetryAfter
+	ctx.sniff = re.SniffContentType
+	ctx.errorMime = re.ErrorMime
+	ctx.problemJSON = re.ProblemJSON
+	ctx.cache = &re.cache
+	ctx.cacheSize = re.CacheSize
+	ctx.idempotency = re.IdempotencyStore
+	ctx.idemScope = re.IdempotencyScope
+	ctx.formMemory = re.MultipartMemory
+	ctx.timeout = re.HandlerTimeout
+	if re.SelectMarshaller != nil {
+		if mime, ok := re.SelectMarshaller(r); ok {
+			if _, ok := getMarshaller(mime); ok {
+				ctx.mime = mime
+			}
+		}
+	}
+	if formatMime != "" {
+		ctx.mime = formatMime
+	}
+
+	if !route.consume(r) {
+		http.Error(w, fmt.Sprintf("%s doesn't accept content type %s", route.path, r.Header.Get("Content-Type")), http.StatusUnsupportedMediaType)
+		return
+	}
+	if !route.accept(r) {
+		http.Error(w, fmt.Sprintf("%s only accepts content type %s", route.path, strings.Join(route.accepts, ", ")), http.StatusUnsupportedMediaType)
+		return
+	}
+	route.produce(ctx)
 
-	ctx.responseWriter.Header().Set("Content-Type", fmt.Sprintf("%s; charset=%s", ctx.mime, ctx.charset))
+	ctx.responseWriter.Header().Set("Content-Type", ctx.contentType())
 
-	re.ctxField.Set(reflect.ValueOf(ctx))
+	if t.ctxField.IsValid() {
+		setContext(t.ctxField, ctx)
+	}
 
-	handler.handle(re.instance, ctx)
+	hooks := hookInstance(t.instance)
+	if !beforeRequest(hooks, ctx) {
+		return
+	}
+	route.handler.handle(t.instance, ctx)
+	afterRequest(hooks, ctx)
 }
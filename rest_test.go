@@ -2,11 +2,18 @@ package rest
 
 import (
 	"bytes"
+	gocontext "context"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 type FakeNode struct {
@@ -65,6 +72,12 @@ type TestSamePath struct {
 	NoMethod2 FakeNode `method:"METHOD"`
 }
 
+type TestCombined struct {
+	Service `rest:"prefix=/prefix,mime=mime,charset=charset"`
+
+	NoMethod FakeNode `rest:"path=/combined,method=METHOD" method:"OTHER"`
+}
+
 type TestNoService struct{}
 
 func TestNewRest(t *testing.T) {
@@ -83,6 +96,7 @@ func TestNewRest(t *testing.T) {
 		{new(TestDefault), true, 0, "/prefix", "mime", "charset", "/prefix/default", `path:"/default" method:"METHOD" other:"other"`},
 		{new(TestFunc), true, 1, "/prefix", "mime", "charset", "/prefix/func", `path:"/func" method:"METHOD" func:"FuncHandler"`},
 		{new(TestNoPath), true, 0, "/prefix", "mime", "charset", "/prefix", `method:"METHOD"`},
+		{new(TestCombined), true, 0, "/prefix", "mime", "charset", "/prefix/combined", `rest:"path=/combined,method=METHOD" method:"OTHER"`},
 		{new(TestNoService), false, 0, "", "", "", "", ""},
 		{new(TestNoMethod), false, 0, "", "", "", "", ""},
 		{new(TestSamePath), false, 0, "", "", "", "", ""},
@@ -94,9 +108,9 @@ func TestNewRest(t *testing.T) {
 			continue
 		}
 		equal(t, r.Prefix(), test.prefix, "test %d", i)
-		equal(t, r.defaultMime, test.mime, "test %d", i)
-		equal(t, r.defaultCharset, test.charset, "test %d", i)
-		handler, ok := r.router.Routes[0].Dest.(*FakeHandler)
+		equal(t, r.table.defaultMime, test.mime, "test %d", i)
+		equal(t, r.table.defaultCharset, test.charset, "test %d", i)
+		handler, ok := r.table.router.Routes[0].Dest.(*route).handler.(*FakeHandler)
 		if !ok {
 			fmt.Errorf("handler not *FakeHandler")
 			continue
@@ -159,3 +173,1356 @@ func TestRestServeHTTP(t *testing.T) {
 		equal(t, equalMap(service.Vars(), test.vars), true, "test %d", i)
 	}
 }
+
+type TestCancel struct {
+	Service
+
+	Slow Processor `method:"GET" path:"/slow"`
+
+	canceled chan bool
+}
+
+func (r TestCancel) HandleSlow() string {
+	select {
+	case <-r.Context().Done():
+		r.canceled <- true
+	case <-time.After(time.Second):
+	}
+	return "late"
+}
+
+func TestRestCancel(t *testing.T) {
+	instance := &TestCancel{
+		canceled: make(chan bool, 1),
+	}
+	rest, err := New(instance)
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	req, err := http.NewRequest("GET", "http://domain/slow", nil)
+	if err != nil {
+		t.Fatalf("create request failed: %s", err)
+	}
+	ctx, cancel := gocontext.WithCancel(req.Context())
+	req = req.WithContext(ctx)
+	cancel() // client disconnects
+	w := httptest.NewRecorder()
+	w.Code = http.StatusOK
+	rest.ServeHTTP(w, req)
+	equal(t, len(instance.canceled), 1)
+	equal(t, w.Body.String(), "")
+}
+
+func TestRestHandleFunc(t *testing.T) {
+	type Test struct {
+		method string
+		url    string
+		body   string
+
+		code     int
+		response string
+	}
+	rest, err := New(new(TestPost))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	err = rest.HandleFunc("GET", "/func/:name", func(s Service) string {
+		return "hello " + s.Vars()["name"]
+	})
+	equal(t, err, nil)
+	err = rest.HandleFunc("POST", "/func", func(s Service, post string) string {
+		return post + " posted"
+	})
+	equal(t, err, nil)
+	equal(t, rest.HandleFunc("GET", "/func/:to", func(s Service) {}) != nil, true)
+	equal(t, rest.HandleFunc("GET", "/error", func(post string) {}) != nil, true)
+	equal(t, rest.HandleFunc("GET", "/error", "not func") != nil, true)
+
+	var tests = []Test{
+		{"GET", "http://domain/prefix/func/rest", "", http.StatusOK, "\"hello rest\"\n"},
+		{"POST", "http://domain/prefix/func", `"abc"`, http.StatusOK, "\"abc posted\"\n"},
+		{"POST", "http://domain/prefix/func", `abc`, http.StatusBadRequest, ""},
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest(test.method, test.url, bytes.NewBufferString(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		if test.code == http.StatusOK {
+			equal(t, w.Body.String(), test.response, "test %d", i)
+		}
+	}
+	equal(t, len(rest.Routes()), 4)
+}
+
+type TestHeaders struct {
+	Service
+
+	Default   Processor `method:"GET" path:"/default"`
+	Overwrite Processor `method:"GET" path:"/overwrite"`
+	Watch     Streaming `method:"GET" path:"/watch"`
+}
+
+func (r TestHeaders) HandleDefault() {}
+
+func (r TestHeaders) HandleWatch(s Stream) {
+	s.Write("hello")
+}
+
+func (r TestHeaders) HandleOverwrite() {
+	r.Header().Set("Server", "overwrite")
+}
+
+func TestRestDefaultHeaders(t *testing.T) {
+	type Test struct {
+		url string
+
+		code   int
+		server string
+	}
+	rest, err := New(new(TestHeaders))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	rest.DefaultHeaders = http.Header{
+		"Server":                 {"rest"},
+		"X-Content-Type-Options": {"nosniff"},
+	}
+	var tests = []Test{
+		{"http://domain/default", http.StatusOK, "rest"},
+		{"http://domain/overwrite", http.StatusOK, "overwrite"},
+		{"http://domain/nonexist", http.StatusNotFound, "rest"},
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Header().Get("Server"), test.server, "test %d", i)
+		equal(t, w.Header().Get("X-Content-Type-Options"), "nosniff", "test %d", i)
+	}
+	equal(t, rest.DefaultHeaders.Get("Server"), "rest")
+
+	server := httptest.NewServer(rest)
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, string(body), "\"hello\"\n")
+	equal(t, resp.Header.Get("Server"), "rest")
+	equal(t, resp.Header.Get("X-Content-Type-Options"), "nosniff")
+}
+
+func TestRestMaxURLLength(t *testing.T) {
+	type Test struct {
+		max int
+		url string
+
+		code int
+	}
+	var tests = []Test{
+		{0, "http://domain/prefix/node/" + strings.Repeat("a", 1000), http.StatusOK},
+		{30, "http://domain/prefix/node/123", http.StatusOK},
+		{30, "http://domain/prefix/node/123?a=" + strings.Repeat("a", 30), http.StatusRequestURITooLong},
+		{30, "http://domain/prefix/node/" + strings.Repeat("a", 30), http.StatusRequestURITooLong},
+	}
+	rest, err := New(new(TestPost))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	for i, test := range tests {
+		rest.MaxURLLength = test.max
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+	}
+}
+
+func TestRestStrictRequestParsing(t *testing.T) {
+	type Test struct {
+		strict bool
+
+		code int
+	}
+	var tests = []Test{
+		{false, http.StatusOK},
+		{true, http.StatusBadRequest},
+	}
+	rest, err := New(new(TestPost))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		rest.StrictRequestParsing = test.strict
+		req, err := http.NewRequest("POST", "http://domain/prefix/node", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header["Content-Length"] = []string{"0", "0"}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+	}
+}
+
+func TestRestFallback(t *testing.T) {
+	type Test struct {
+		method string
+		url    string
+
+		code int
+		body string
+	}
+	var tests = []Test{
+		{"GET", "http://domain/prefix/node/123", http.StatusOK, ""},
+		{"GET", "http://domain/index.html", http.StatusOK, "GET /index.html"},
+		{"POST", "http://domain/prefix/node/123?_method=PUT", http.StatusOK, "POST /prefix/node/123"},
+	}
+	rest, err := New(new(TestPost))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	rest.Fallback(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.Method, r.URL.Path)
+	}))
+	for i, test := range tests {
+		req, err := http.NewRequest(test.method, test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+}
+
+var (
+	errTestNotFound = errors.New("not found")
+	errTestConflict = errors.New("conflict")
+)
+
+type TestErrorStatus struct {
+	Service
+
+	Node Processor `method:"GET" path:"/node/:id" args:"id"`
+}
+
+func (r TestErrorStatus) HandleNode(id string) (string, error) {
+	switch id {
+	case "missing":
+		return "", fmt.Errorf("user %s: %w", id, errTestNotFound)
+	case "conflict":
+		return "", errTestConflict
+	case "other":
+		return "", errors.New("other")
+	case "gone":
+		return "", Problem{Type: "https://domain/errors/gone", Status: http.StatusGone, Detail: "node gone is removed"}
+	}
+	return id, nil
+}
+
+func TestRestRegisterErrorStatus(t *testing.T) {
+	type Test struct {
+		url string
+
+		code int
+		body string
+	}
+	var tests = []Test{
+		{"http://domain/node/123", http.StatusOK, "\"123\"\n"},
+		{"http://domain/node/missing", http.StatusNotFound, "{\"code\":-1,\"message\":\"user missing: not found\"}\n"},
+		{"http://domain/node/conflict", http.StatusConflict, "{\"code\":-1,\"message\":\"conflict\"}\n"},
+		{"http://domain/node/other", http.StatusInternalServerError, "{\"code\":-1,\"message\":\"other\"}\n"},
+	}
+	rest, err := New(new(TestErrorStatus))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	rest.RegisterErrorStatus(errTestNotFound, http.StatusNotFound)
+	rest.RegisterErrorStatus(errTestConflict, http.StatusConflict)
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+}
+
+func TestRestResponseWrapper(t *testing.T) {
+	type Test struct {
+		url string
+
+		code int
+		body string
+	}
+	var tests = []Test{
+		{"http://domain/node/123", http.StatusOK, "{\"data\":\"123\",\"meta\":{\"handler\":\"Node\"}}\n"},
+		{"http://domain/node/missing", http.StatusInternalServerError, "{\"code\":-1,\"message\":\"user missing: not found\"}\n"},
+	}
+	rest, err := New(new(TestErrorStatus))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	rest.ResponseWrapper = func(v interface{}, s Service) interface{} {
+		return map[string]interface{}{
+			"data": v,
+			"meta": map[string]string{"handler": s.name},
+		}
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+}
+
+func TestRestResponseTransform(t *testing.T) {
+	type Test struct {
+		url  string
+		role string
+
+		code int
+		body string
+	}
+	var tests = []Test{
+		{"http://domain/node/123", "admin", http.StatusOK, "{\"data\":\"123\"}\n"},
+		{"http://domain/node/123", "guest", http.StatusOK, "{\"data\":\"***\"}\n"},
+		{"http://domain/node/missing", "guest", http.StatusInternalServerError, "{\"code\":-1,\"message\":\"user missing: not found\"}\n"},
+	}
+	rest, err := New(new(TestErrorStatus))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	rest.ResponseTransform = func(v interface{}, s Service) interface{} {
+		if s.Request().Header.Get("X-Role") != "admin" {
+			return "***"
+		}
+		return v
+	}
+	rest.ResponseWrapper = func(v interface{}, s Service) interface{} {
+		return map[string]interface{}{"data": v}
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Role", test.role)
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+}
+
+func TestRestErrorMime(t *testing.T) {
+	type Test struct {
+		url       string
+		errorMime string
+
+		code        int
+		contentType string
+		body        string
+	}
+	var tests = []Test{
+		{"http://domain/node/123", "", http.StatusOK, "text/x-fake; charset=utf-8", "<123>"},
+		{"http://domain/node/123", "application/json", http.StatusOK, "text/x-fake; charset=utf-8", "<123>"},
+		{"http://domain/node/other", "", http.StatusInternalServerError, "text/x-fake; charset=utf-8", "<<-1 other>>"},
+		{"http://domain/node/other", "application/json", http.StatusInternalServerError, "application/json; charset=utf-8", "{\"code\":-1,\"message\":\"other\"}\n"},
+		{"http://domain/node/other", "text/x-unknown", http.StatusInternalServerError, "text/x-fake; charset=utf-8", "<<-1 other>>"},
+	}
+	RegisterMarshaller("text/x-fake", FakeMarshaller{})
+	defer delete(marshallers, "text/x-fake")
+	rest, err := New(new(TestErrorStatus))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	for i, test := range tests {
+		rest.ErrorMime = test.errorMime
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept", "text/x-fake")
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Header().Get("Content-Type"), test.contentType, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+}
+
+func TestRestProblemJSON(t *testing.T) {
+	type Test struct {
+		url    string
+		accept string
+
+		code        int
+		contentType string
+		body        string
+	}
+	var tests = []Test{
+		{"http://domain/node/123", "", http.StatusOK, "application/json; charset=utf-8", "\"123\"\n"},
+		{"http://domain/node/123", "text/x-fake", http.StatusOK, "text/x-fake; charset=utf-8", "<123>"},
+		{"http://domain/node/missing", "", http.StatusNotFound, "application/problem+json", "{\"type\":\"about:blank\",\"title\":\"Not Found\",\"status\":404,\"detail\":\"user missing: not found\",\"instance\":\"/node/missing\"}\n"},
+		{"http://domain/node/other", "text/x-fake", http.StatusInternalServerError, "application/problem+json", "{\"type\":\"about:blank\",\"title\":\"Internal Server Error\",\"status\":500,\"detail\":\"other\",\"instance\":\"/node/other\"}\n"},
+		{"http://domain/node/gone", "", http.StatusGone, "application/problem+json", "{\"type\":\"https://domain/errors/gone\",\"title\":\"Gone\",\"status\":410,\"detail\":\"node gone is removed\",\"instance\":\"/node/gone\"}\n"},
+	}
+	RegisterMarshaller("text/x-fake", FakeMarshaller{})
+	defer delete(marshallers, "text/x-fake")
+	rest, err := New(new(TestErrorStatus), WithProblemJSON())
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	rest.RegisterErrorStatus(errTestNotFound, http.StatusNotFound)
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept", test.accept)
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Header().Get("Content-Type"), test.contentType, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+}
+
+func TestRestSelectMarshaller(t *testing.T) {
+	type Test struct {
+		accept string
+		key    string
+
+		contentType string
+		body        string
+	}
+	var tests = []Test{
+		{"", "", "application/json; charset=utf-8", "\"123\"\n"},
+		{"", "fake", "text/x-fake; charset=utf-8", "<123>"},
+		{"text/x-fake", "", "text/x-fake; charset=utf-8", "<123>"},
+		{"text/x-fake", "json", "application/json; charset=utf-8", "\"123\"\n"},
+		{"", "unknown", "application/json; charset=utf-8", "\"123\"\n"},
+	}
+	RegisterMarshaller("text/x-fake", FakeMarshaller{})
+	defer delete(marshallers, "text/x-fake")
+	rest, err := New(new(TestErrorStatus))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	rest.SelectMarshaller = func(r *http.Request) (string, bool) {
+		switch r.Header.Get("X-Api-Key") {
+		case "fake":
+			return "text/x-fake", true
+		case "json":
+			return "application/json", true
+		case "unknown":
+			return "text/x-unknown", true
+		}
+		return "", false
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", "http://domain/node/123", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		if test.key != "" {
+			req.Header.Set("X-Api-Key", test.key)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, http.StatusOK, "test %d", i)
+		equal(t, w.Header().Get("Content-Type"), test.contentType, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+}
+
+func TestRestMethodOverride(t *testing.T) {
+	type Test struct {
+		enable   bool
+		method   string
+		url      string
+		override string
+
+		code int
+	}
+	var tests = []Test{
+		{false, "POST", "http://domain/prefix/node/123", "GET", http.StatusNotFound},
+		{true, "POST", "http://domain/prefix/node/123", "GET", http.StatusOK},
+		{true, "POST", "http://domain/prefix/node/123", "get", http.StatusOK},
+		{true, "POST", "http://domain/prefix/node", "", http.StatusOK},
+		{true, "GET", "http://domain/prefix/node", "POST", http.StatusNotFound},
+		{false, "POST", "http://domain/prefix/node/123?_method=GET", "", http.StatusNotFound},
+		{true, "POST", "http://domain/prefix/node/123?_method=get", "", http.StatusOK},
+		{true, "POST", "http://domain/prefix/node/123?_method=POST", "GET", http.StatusOK},
+		{true, "GET", "http://domain/prefix/node?_method=POST", "", http.StatusNotFound},
+	}
+	rest, err := New(new(TestPost))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	for i, test := range tests {
+		rest.MethodOverride = test.enable
+		req, err := http.NewRequest(test.method, test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.override != "" {
+			req.Header.Set("X-HTTP-Method-Override", test.override)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+	}
+}
+
+func TestRestReadOnly(t *testing.T) {
+	type Test struct {
+		readOnly   bool
+		retryAfter time.Duration
+		method     string
+		url        string
+
+		code   int
+		header string
+	}
+	var tests = []Test{
+		{false, 0, "POST", "http://domain/prefix/node", http.StatusOK, ""},
+		{true, 0, "POST", "http://domain/prefix/node", http.StatusServiceUnavailable, "60"},
+		{true, 2 * time.Second, "POST", "http://domain/prefix/node", http.StatusServiceUnavailable, "2"},
+		{true, 0, "GET", "http://domain/prefix/node/123", http.StatusOK, ""},
+		{true, 0, "DELETE", "http://domain/prefix/node/123", http.StatusServiceUnavailable, "60"},
+		{true, 0, "GET", "http://domain/prefix/node/123?_method=PUT", http.StatusOK, ""},
+		{false, 0, "DELETE", "http://domain/prefix/node/123", http.StatusNotFound, ""},
+	}
+	rest, err := New(new(TestPost))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	for i, test := range tests {
+		rest.SetReadOnly(test.readOnly)
+		rest.RetryAfter = test.retryAfter
+		req, err := http.NewRequest(test.method, test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Header().Get("Retry-After"), test.header, "test %d", i)
+	}
+}
+
+type TestHost struct {
+	Service `prefix:"/prefix"`
+
+	Admin Processor `method:"GET" path:"/node" host:"admin.*"`
+	API   Processor `method:"GET" path:"/node" host:"api.example.com"`
+	Any   Processor `method:"GET" path:"/node"`
+	Users Processor `method:"*" path:"/users" host:"admin.*"`
+}
+
+func (r TestHost) HandleAdmin() string {
+	return "admin"
+}
+
+func (r TestHost) HandleAPI() string {
+	return "api"
+}
+
+func (r TestHost) HandleAny() string {
+	return "any"
+}
+
+func (r TestHost) HandleUsers() string {
+	return "users"
+}
+
+type TestServiceHost struct {
+	Service `prefix:"/prefix" host:"admin.*"`
+
+	Node  Processor `method:"GET" path:"/node"`
+	Other Processor `method:"GET" path:"/other" host:"api.example.com"`
+}
+
+func (r TestServiceHost) HandleNode() string {
+	return "node"
+}
+
+func (r TestServiceHost) HandleOther() string {
+	return "other"
+}
+
+func TestRestHost(t *testing.T) {
+	type Test struct {
+		service interface{}
+		method  string
+		url     string
+
+		code int
+		body string
+	}
+	var tests = []Test{
+		{new(TestHost), "GET", "http://admin.example.com/prefix/node", http.StatusOK, "\"admin\"\n"},
+		{new(TestHost), "GET", "http://ADMIN.example.com:8080/prefix/node", http.StatusOK, "\"admin\"\n"},
+		{new(TestHost), "GET", "http://api.example.com/prefix/node", http.StatusOK, "\"api\"\n"},
+		{new(TestHost), "GET", "http://www.example.com/prefix/node", http.StatusOK, "\"any\"\n"},
+		{new(TestHost), "POST", "http://admin.example.com/prefix/users", http.StatusOK, "\"users\"\n"},
+		{new(TestHost), "GET", "http://api.example.com/prefix/users", http.StatusNotFound, ""},
+		{new(TestServiceHost), "GET", "http://admin.example.com/prefix/node", http.StatusOK, "\"node\"\n"},
+		{new(TestServiceHost), "GET", "http://api.example.com/prefix/node", http.StatusNotFound, ""},
+		{new(TestServiceHost), "GET", "http://api.example.com/prefix/other", http.StatusOK, "\"other\"\n"},
+		{new(TestServiceHost), "GET", "http://admin.example.com/prefix/other", http.StatusNotFound, ""},
+	}
+	for i, test := range tests {
+		rest, err := New(test.service)
+		if err != nil {
+			t.Fatalf("new rest service failed: %s", err)
+		}
+		req, err := http.NewRequest(test.method, test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		if test.code == http.StatusOK {
+			equal(t, w.Body.String(), test.body, "test %d", i)
+		}
+	}
+}
+
+type TestEnabled struct {
+	Service
+
+	Node     FakeNode `method:"GET" path:"/node"`
+	Debug    FakeNode `method:"GET" path:"/debug"`
+	Disabled FakeNode `method:"GET" path:"/node" enabled:"false"`
+}
+
+func TestNewFiltered(t *testing.T) {
+	type Test struct {
+		enabled func(string) bool
+
+		routes []string
+	}
+	var tests = []Test{
+		{nil, []string{"/node", "/debug"}},
+		{func(field string) bool { return field != "Debug" }, []string{"/node"}},
+		{func(field string) bool { return true }, []string{"/node", "/debug"}},
+	}
+	for i, test := range tests {
+		rest, err := NewFiltered(new(TestEnabled), test.enabled)
+		if err != nil {
+			t.Fatalf("test %d new rest service failed: %s", i, err)
+		}
+		var routes []string
+		for _, r := range rest.Routes() {
+			routes = append(routes, r.Path)
+		}
+		equal(t, routes, test.routes, "test %d", i)
+
+		if err := rest.Reload(new(TestEnabled)); err != nil {
+			t.Fatalf("test %d reload failed: %s", i, err)
+		}
+		routes = nil
+		for _, r := range rest.Routes() {
+			routes = append(routes, r.Path)
+		}
+		equal(t, routes, test.routes, "test %d", i)
+	}
+}
+
+type TestEnabledRoutes struct {
+	Service
+
+	Node     FakeNode `method:"GET" path:"/node"`
+	Debug    FakeNode `method:"GET" path:"/debug"`
+	Export   FakeNode `method:"GET" path:"/export"`
+	Disabled FakeNode `method:"GET" path:"/node" enabled:"false"`
+
+	enabled map[string]bool
+}
+
+func (r *TestEnabledRoutes) EnabledRoutes() map[string]bool {
+	return r.enabled
+}
+
+func TestRestEnabledRoutes(t *testing.T) {
+	type Test struct {
+		routes  map[string]bool
+		enabled func(string) bool
+
+		paths []string
+	}
+	var tests = []Test{
+		{nil, nil, []string{"/node", "/debug", "/export"}},
+		{map[string]bool{"Export": false}, nil, []string{"/node", "/debug"}},
+		{map[string]bool{"Export": true, "Debug": false}, nil, []string{"/node", "/export"}},
+		{map[string]bool{"Disabled": true}, nil, []string{"/node", "/debug", "/export"}},
+		{map[string]bool{"Export": true}, func(field string) bool { return field != "Export" }, []string{"/node", "/debug"}},
+		{map[string]bool{"Node": false}, func(field string) bool { return field != "Debug" }, []string{"/export"}},
+	}
+	for i, test := range tests {
+		rest, err := NewFiltered(&TestEnabledRoutes{enabled: test.routes}, test.enabled)
+		if err != nil {
+			t.Fatalf("test %d new rest service failed: %s", i, err)
+		}
+		var paths []string
+		for _, r := range rest.Routes() {
+			paths = append(paths, r.Path)
+		}
+		equal(t, paths, test.paths, "test %d", i)
+	}
+}
+
+type TestSniff struct {
+	Service
+
+	HTML  Processor `method:"GET" path:"/html"`
+	PNG   Processor `method:"GET" path:"/png"`
+	Typed Processor `method:"GET" path:"/typed"`
+}
+
+func (r TestSniff) HandleHTML() []byte {
+	return []byte("<html><body>hello</body></html>")
+}
+
+func (r TestSniff) HandlePNG() io.Reader {
+	return strings.NewReader("\x89PNG\x0D\x0A\x1A\x0A")
+}
+
+func (r TestSniff) HandleTyped() []byte {
+	r.Header().Set("Content-Type", "text/csv")
+	return []byte("a,b\n")
+}
+
+func TestRestSniffContentType(t *testing.T) {
+	type Test struct {
+		sniff bool
+		path  string
+
+		contentType string
+		body        string
+	}
+	var tests = []Test{
+		{false, "/html", "application/json; charset=utf-8", "\"PGh0bWw+PGJvZHk+aGVsbG88L2JvZHk+PC9odG1sPg==\"\n"},
+		{true, "/html", "text/html; charset=utf-8", "<html><body>hello</body></html>"},
+		{true, "/png", "image/png", "\x89PNG\x0D\x0A\x1A\x0A"},
+		{true, "/typed", "text/csv", "a,b\n"},
+	}
+	rest, err := New(new(TestSniff))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	for i, test := range tests {
+		rest.SniffContentType = test.sniff
+		req, err := http.NewRequest("GET", "http://domain"+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Header().Get("Content-Type"), test.contentType, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+}
+
+func TestRestReload(t *testing.T) {
+	type Test struct {
+		url string
+
+		code int
+	}
+	rest, err := New(new(TestPost))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	serve := func(tests []Test) {
+		for i, test := range tests {
+			req, err := http.NewRequest("GET", test.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			rest.ServeHTTP(w, req)
+			equal(t, w.Code, test.code, "test %d", i)
+		}
+	}
+	serve([]Test{
+		{"http://domain/prefix/node/123", http.StatusOK},
+		{"http://domain/default", http.StatusNotFound},
+	})
+
+	equal(t, rest.Reload(new(TestConflict)) != nil, true)
+	equal(t, rest.Prefix(), "/prefix")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			req, _ := http.NewRequest("GET", "http://domain/prefix/node/123", nil)
+			rest.ServeHTTP(httptest.NewRecorder(), req)
+		}
+	}()
+	err = rest.Reload(new(TestHeaders))
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, rest.Prefix(), "/")
+	serve([]Test{
+		{"http://domain/prefix/node/123", http.StatusNotFound},
+		{"http://domain/default", http.StatusOK},
+	})
+}
+
+type TestSplatInt struct {
+	Service
+
+	Files Processor `method:"GET" path:"/files/*id" args:"id"`
+}
+
+func (r TestSplatInt) HandleFiles(id int) int {
+	return id
+}
+
+func TestRestInvalidPathArg(t *testing.T) {
+	type Test struct {
+		url string
+
+		code int
+		body string
+	}
+	var tests = []Test{
+		{"http://domain/files/12", http.StatusOK, "12\n"},
+		{"http://domain/files/a/b", http.StatusBadRequest, "{\"code\":-1,\"message\":\"invalid parameter id: strconv.ParseInt: parsing \\\"a/b\\\": invalid syntax\"}\n"},
+		{"http://domain/files/99999999999999999999", http.StatusBadRequest, "{\"code\":-1,\"message\":\"invalid parameter id: strconv.ParseInt: parsing \\\"99999999999999999999\\\": value out of range\"}\n"},
+	}
+	rest, err := New(new(TestSplatInt))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+}
+
+type TestPrefixes struct {
+	Service `prefix:"/api,/v1"`
+
+	Node Processor `method:"GET" path:"/node/:id" args:"id"`
+}
+
+func (r TestPrefixes) HandleNode(id int) int {
+	return id
+}
+
+func TestRestPrefixes(t *testing.T) {
+	type Test struct {
+		url string
+
+		code int
+		body string
+	}
+	var tests = []Test{
+		{"http://domain/api/node/1", http.StatusOK, "1\n"},
+		{"http://domain/v1/node/2", http.StatusOK, "2\n"},
+		{"http://domain/node/3", http.StatusNotFound, ""},
+		{"http://domain/api/func", http.StatusOK, "\"func\"\n"},
+		{"http://domain/v1/func", http.StatusOK, "\"func\"\n"},
+	}
+	rest, err := New(new(TestPrefixes))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	equal(t, rest.Prefix(), "/api")
+	equal(t, rest.Prefixes(), []string{"/api", "/v1"})
+	err = rest.GET("/func", func(s Service) string {
+		return "func"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+	paths := make([]string, 0)
+	for _, info := range rest.Routes() {
+		paths = append(paths, info.Path)
+	}
+	equal(t, paths, []string{"/api/node/:id", "/v1/node/:id", "/api/func", "/v1/func"})
+}
+
+func TestRestReturnHeader(t *testing.T) {
+	type Test struct {
+		url string
+
+		code  int
+		page  []string
+		other string
+		link  string
+		body  string
+	}
+	var tests = []Test{
+		{"http://domain/list", http.StatusOK, []string{"2"}, "on", "</list?page=3>; rel=\"next\"", "\"list\"\n"},
+		{"http://domain/fail?ok=true", http.StatusOK, []string{"2"}, "", "", "\"fail\"\n"},
+		{"http://domain/fail", http.StatusInternalServerError, []string{"1"}, "", "", "{\"code\":-1,\"message\":\"fail\"}\n"},
+	}
+	rest := NewRouter("/")
+	err := rest.GET("/list", func(s Service) (string, http.Header) {
+		s.Header().Set("X-Page", "1")
+		s.Header().Set("X-Other", "on")
+		return "list", http.Header{
+			"X-Page": {"2"},
+			"Link":   {"</list?page=3>; rel=\"next\""},
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rest.GET("/fail", func(s Service) (string, http.Header, error) {
+		s.Header().Set("X-Page", "1")
+		if s.Request().URL.Query().Get("ok") == "" {
+			return "", http.Header{"X-Page": {"2"}}, errors.New("fail")
+		}
+		return "fail", http.Header{"X-Page": {"2"}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Header()["X-Page"], test.page, "test %d", i)
+		equal(t, w.Header().Get("X-Other"), test.other, "test %d", i)
+		equal(t, w.Header().Get("Link"), test.link, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+}
+
+func TestRestTuple(t *testing.T) {
+	type Test struct {
+		url string
+
+		code int
+		page string
+		body string
+	}
+	var tests = []Test{
+		{"http://domain/pair", http.StatusOK, "", "[1,\"one\"]\n"},
+		{"http://domain/triple?ok=true", http.StatusOK, "2", "[2,\"two\",true]\n"},
+		{"http://domain/triple", http.StatusInternalServerError, "", "{\"code\":-1,\"message\":\"fail\"}\n"},
+	}
+	rest := NewRouter("/")
+	err := rest.GET("/pair", func(s Service) (int, string) {
+		return 1, "one"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rest.GET("/triple", func(s Service) (int, string, bool, http.Header, error) {
+		if s.Request().URL.Query().Get("ok") == "" {
+			return 0, "", false, http.Header{"X-Page": {"2"}}, errors.New("fail")
+		}
+		return 2, "two", true, http.Header{"X-Page": {"2"}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Header().Get("X-Page"), test.page, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+
+	err = rest.GET("/error", func(s Service) (int, error, string) { return 0, nil, "" })
+	equal(t, strings.HasSuffix(fmt.Sprintf("%v", err), ") return values should be responses, http.Header and error, in order."), true)
+	err = rest.GET("/channel", func(s Service) (int, <-chan int) { return 0, nil })
+	equal(t, strings.HasSuffix(fmt.Sprintf("%v", err), ") channel can't be returned with other responses."), true)
+}
+
+type TestPrefixRoot struct {
+	Service `prefix:"/prefix,/v1"`
+
+	Root  Processor `method:"GET" path:"/"`
+	Empty Processor `method:"POST"`
+	Slash Processor `method:"POST" path:"/"`
+}
+
+func (r TestPrefixRoot) HandleRoot() string {
+	return "root"
+}
+
+func (r TestPrefixRoot) HandleEmpty() string {
+	return "empty"
+}
+
+func (r TestPrefixRoot) HandleSlash() string {
+	return "slash"
+}
+
+func TestRestPrefixRoot(t *testing.T) {
+	type Test struct {
+		method string
+		url    string
+
+		code int
+		body string
+	}
+	var tests = []Test{
+		{"GET", "http://domain/prefix", http.StatusOK, "\"root\"\n"},
+		{"GET", "http://domain/prefix/", http.StatusOK, "\"root\"\n"},
+		{"GET", "http://domain/v1", http.StatusOK, "\"root\"\n"},
+		{"GET", "http://domain/v1/", http.StatusOK, "\"root\"\n"},
+		{"GET", "http://domain/", http.StatusNotFound, ""},
+		{"POST", "http://domain/prefix", http.StatusOK, "\"empty\"\n"},
+		{"POST", "http://domain/prefix/", http.StatusOK, "\"slash\"\n"},
+		{"PUT", "http://domain/prefix", http.StatusOK, "\"func\"\n"},
+		{"PUT", "http://domain/prefix/", http.StatusOK, "\"func\"\n"},
+	}
+	rest, err := New(new(TestPrefixRoot))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	err = rest.PUT("", func(s Service) string {
+		return "func"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest(test.method, test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+
+	router := NewRouter("/prefix")
+	err = router.GET("/", func(s Service) string {
+		return "alias"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = router.GET("", func(s Service) string {
+		return "own"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, url := range []string{"http://domain/prefix", "http://domain/prefix/"} {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		equal(t, w.Body.String(), []string{"\"own\"\n", "\"alias\"\n"}[i], "test %d", i)
+	}
+}
+
+type TestBaseContext struct {
+	Service
+
+	Value Processor `method:"GET" path:"/value"`
+}
+
+type baseContextKey struct{}
+
+func (r TestBaseContext) HandleValue() string {
+	v, _ := r.Context().Value(baseContextKey{}).(string)
+	return v
+}
+
+func TestRestBaseContext(t *testing.T) {
+	type Test struct {
+		base func(r *http.Request) gocontext.Context
+
+		body string
+	}
+	var tests = []Test{
+		{nil, "\"\"\n"},
+		{func(r *http.Request) gocontext.Context {
+			return gocontext.WithValue(r.Context(), baseContextKey{}, "upstream")
+		}, "\"upstream\"\n"},
+		{func(r *http.Request) gocontext.Context { return nil }, "\"\"\n"},
+	}
+	rest, err := New(new(TestBaseContext))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	for i, test := range tests {
+		rest.BaseContext = test.base
+		req, err := http.NewRequest("GET", "http://domain/value", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, http.StatusOK, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+}
+
+type TestUnexported struct {
+	Service
+
+	Node Processor `method:"GET" path:"/node" func:"handleNode"`
+}
+
+func (r TestUnexported) handleNode() {}
+
+type TestPointerReceiver struct {
+	Service
+
+	Node Processor `method:"GET" path:"/node"`
+}
+
+func (r *TestPointerReceiver) HandleNode() {}
+
+func TestNewHandlerError(t *testing.T) {
+	_, err := New(new(TestUnexported))
+	equal(t, fmt.Sprintf("%v", err), "Node's handler handleNode is unexported, export it as HandleNode")
+	_, err = New(new(TestPointerReceiver))
+	equal(t, fmt.Sprintf("%v", err), "Node's handler HandleNode has pointer receiver, define it with value receiver")
+}
+
+type brokenWriterTo struct{}
+
+func (brokenWriterTo) WriteTo(w io.Writer) (int64, error) {
+	n, _ := io.WriteString(w, "partial")
+	return int64(n), errors.New("broken")
+}
+
+func TestRestRender(t *testing.T) {
+	type Test struct {
+		path string
+
+		code   int
+		body   string
+		logged string
+	}
+	var tests = []Test{
+		{"/ok", http.StatusOK, "rendered", ""},
+		{"/created", http.StatusCreated, "rendered", ""},
+		{"/before", http.StatusInternalServerError, "{\"code\":-1,\"message\":\"no data\"}\n", ""},
+		{"/after", http.StatusOK, "partial", "render response failed after body started: broken\n"},
+		{"/writer", http.StatusOK, "partial", "write response failed: broken\n"},
+	}
+	var logs bytes.Buffer
+	rest := NewRouter("/")
+	rest.Logger = log.New(&logs, "", 0)
+	routes := map[string]interface{}{
+		"/ok": func(s Service) func(io.Writer) error {
+			return func(w io.Writer) error {
+				_, err := io.WriteString(w, "rendered")
+				return err
+			}
+		},
+		"/created": func(s Service) Result {
+			return Result{Status: http.StatusCreated, Body: func(w io.Writer) error {
+				_, err := io.WriteString(w, "rendered")
+				return err
+			}}
+		},
+		"/before": func(s Service) func(io.Writer) error {
+			return func(w io.Writer) error {
+				return errors.New("no data")
+			}
+		},
+		"/after": func(s Service) func(io.Writer) error {
+			return func(w io.Writer) error {
+				io.WriteString(w, "partial")
+				return errors.New("broken")
+			}
+		},
+		"/writer": func(s Service) brokenWriterTo {
+			return brokenWriterTo{}
+		},
+	}
+	for path, fn := range routes {
+		if err := rest.GET(path, fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, test := range tests {
+		logs.Reset()
+		req, err := http.NewRequest("GET", "http://domain"+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+		equal(t, strings.HasSuffix(logs.String(), test.logged), true, "test %d", i)
+		equal(t, logs.Len() == 0, test.logged == "", "test %d", i)
+	}
+}
+
+type DeleteFilter struct {
+	Before int `json:"before"`
+}
+
+type TestDelete struct {
+	Service `prefix:"/prefix"`
+
+	Item  Processor `method:"DELETE" path:"/item/:id" args:"id"`
+	Items Processor `method:"DELETE" path:"/items"`
+	Posts Processor `method:"POST" path:"/items"`
+}
+
+func (r TestDelete) HandleItem(id int) {
+	r.NoContent()
+}
+
+func (r TestDelete) HandleItems(filter DeleteFilter) int {
+	return filter.Before
+}
+
+func (r TestDelete) HandlePosts(filter DeleteFilter) int {
+	return filter.Before
+}
+
+func TestRestDelete(t *testing.T) {
+	type Test struct {
+		method  string
+		url     string
+		body    string
+		chunked bool
+
+		code     int
+		response string
+	}
+	var tests = []Test{
+		{"DELETE", "http://domain/prefix/item/1", "", false, http.StatusNoContent, ""},
+		{"DELETE", "http://domain/prefix/items", `{"before":10}`, false, http.StatusOK, "10\n"},
+		{"DELETE", "http://domain/prefix/items", `{"before":10}`, true, http.StatusOK, "10\n"},
+		{"DELETE", "http://domain/prefix/items", "", false, http.StatusOK, "0\n"},
+		{"DELETE", "http://domain/prefix/items", "", true, http.StatusOK, "0\n"},
+		{"DELETE", "http://domain/prefix/items", "{", false, http.StatusBadRequest, "{\"code\":-1,\"message\":\"marshal request to DeleteFilter failed: unexpected EOF\"}\n"},
+		{"POST", "http://domain/prefix/items", "", false, http.StatusBadRequest, "{\"code\":-1,\"message\":\"marshal request to DeleteFilter failed: EOF\"}\n"},
+	}
+	rest, err := New(new(TestDelete))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest(test.method, test.url, strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.chunked {
+			req.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Body.String(), test.response, "test %d", i)
+	}
+}
+
+func TestRestPreRoute(t *testing.T) {
+	type Test struct {
+		url string
+
+		code int
+		body string
+		path string
+	}
+	var tests = []Test{
+		{"http://domain/t/acme/hello", http.StatusOK, "\"/hello acme\"\n", "/hello"},
+		{"http://domain/hello", http.StatusOK, "\"/hello \"\n", "/hello"},
+		{"http://domain/t/acme//hello", http.StatusOK, "\"/hello acme\"\n", "/hello"},
+		{"http://domain/t/acme/missing", http.StatusNotFound, "", "/missing"},
+	}
+	rest := NewRouter("/")
+	rest.CleanPath = true
+	var tapped string
+	rest.Tap = func(req *http.Request, status int, dur time.Duration) {
+		tapped = req.URL.Path
+	}
+	rest.PreRoute = func(r *http.Request) {
+		parts := strings.SplitN(r.URL.Path, "/", 4)
+		if len(parts) == 4 && parts[1] == "t" {
+			r.Header.Set("X-Tenant", parts[2])
+			r.URL.Path = "/" + parts[3]
+		}
+	}
+	err := rest.GET("/hello", func(s Service) string {
+		return s.Request().URL.Path + " " + s.Request().Header.Get("X-Tenant")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+		equal(t, tapped, test.path, "test %d", i)
+	}
+}
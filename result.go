@@ -0,0 +1,26 @@
+package rest
+
+import (
+	"net/http"
+)
+
+/*
+Result is the return value of processor which carries status and headers besides body, so handler can
+be a pure function:
+
+	func (r Service) HandleCreate(arg Arg) rest.Result {
+		return rest.Result{
+			Status:  http.StatusCreated,
+			Headers: http.Header{"Location": []string{"/item/1"}},
+			Body:    item,
+		}
+	}
+
+Headers overwrite the same headers set by handler. If Status is 0, it uses 200 OK. If Body is nil,
+response has no body.
+*/
+type Result struct {
+	Status  int
+	Headers http.Header
+	Body    interface{}
+}
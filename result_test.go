@@ -0,0 +1,62 @@
+package rest
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type FakeResult struct {
+	result Result
+}
+
+func (f FakeResult) Handle() Result {
+	return f.result
+}
+
+func TestProcessorResult(t *testing.T) {
+	type Test struct {
+		result   Result
+		buffered bool
+
+		code    int
+		headers http.Header
+		body    string
+	}
+	var tests = []Test{
+		{Result{}, true, http.StatusOK, http.Header{"Content-Type": {"application/json"}}, ""},
+		{Result{Status: http.StatusAccepted}, true, http.StatusAccepted, http.Header{"Content-Type": {"application/json"}}, ""},
+		{Result{Body: "ok"}, true, http.StatusOK, http.Header{"Content-Type": {"application/json"}, "Content-Length": {"5"}}, "\"ok\"\n"},
+		{Result{http.StatusCreated, http.Header{"Location": {"/item/1"}}, "ok"}, true, http.StatusCreated, http.Header{"Content-Type": {"application/json"}, "Content-Length": {"5"}, "Location": {"/item/1"}}, "\"ok\"\n"},
+		{Result{http.StatusCreated, http.Header{"Content-Type": {"text/plain"}}, "ok"}, false, http.StatusCreated, http.Header{"Content-Type": {"text/plain"}}, "\"ok\"\n"},
+		{Result{Body: bytes.NewBufferString("raw")}, true, http.StatusOK, http.Header{"Content-Type": {"application/json"}}, "raw"},
+		{Result{http.StatusCreated, http.Header{"Content-Type": {"text/plain"}}, bytes.NewBufferString("raw")}, true, http.StatusCreated, http.Header{"Content-Type": {"text/plain"}}, "raw"},
+	}
+	for i, test := range tests {
+		s := FakeResult{test.result}
+		instance := reflect.ValueOf(s)
+		f, _ := instance.Type().MethodByName("Handle")
+		node := processorNode{
+			findex:       f.Index,
+			responseType: reflect.TypeOf(Result{}),
+			buffered:     test.buffered,
+		}
+		req, err := http.NewRequest("GET", "http://fake.domain", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		w.Header().Set("Content-Type", "application/json")
+		ctx, err := newContext(w, req, nil, "application/json", "utf-8")
+		if err != nil {
+			t.Fatal(err)
+		}
+		node.handle(instance, ctx)
+		equal(t, w.Code, test.code, fmt.Sprintf("test %d", i))
+		equal(t, w.Header(), test.headers, fmt.Sprintf("test %d", i))
+		equal(t, w.Body.String(), test.body, fmt.Sprintf("test %d", i))
+	}
+}
@@ -0,0 +1,416 @@
+package rest
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RouteInfo describes a route of service. Kind is "processor", "streaming" or "static", and Streaming
+// describes the config of long-lived streaming route.
+type RouteInfo struct {
+	Method    string         `json:"method"`
+	Path      string         `json:"path"`
+	Func      string         `json:"func"`
+	Mime      string         `json:"mime"`
+	Kind      string         `json:"kind"`
+	Streaming *StreamingInfo `json:"streaming,omitempty"`
+}
+
+// StreamingInfo describes the config of a streaming route. Framing is "sse" or "raw".
+type StreamingInfo struct {
+	Framing string `json:"framing"`
+	Queue   int    `json:"queue,omitempty"`
+	Policy  string `json:"policy,omitempty"`
+}
+
+type route struct {
+	method   string
+	path     pathFormatter
+	name     string
+	funcName string
+	handler  handler
+	consumes []string
+	produces []string
+	accepts  []string
+	// host is the pattern of request host matched by route, or "" for any host.
+	host string
+	// constraints are the sets of values allowed for path parameters, keyed by parameter name.
+	constraints map[string]*regexp.Regexp
+	meta        map[string]string
+	// captures are names of path parameters in order of path, for Service.Captures.
+	captures []string
+}
+
+// anyMethod is the method of route matching all methods, declared as "*" or "ANY".
+const anyMethod = "ANY"
+
+func newRoute(method string, path pathFormatter, name string, h handler, tag reflect.StructTag) (*route, error) {
+	if method == "*" {
+		method = anyMethod
+	}
+	ret := &route{
+		method:   method,
+		path:     path,
+		name:     name,
+		funcName: tag.Get("func"),
+		handler:  h,
+		consumes: splitList(tag.Get("consumes")),
+		produces: splitList(tag.Get("produces")),
+		captures: path.captureNames(),
+	}
+	if ret.funcName == "" {
+		ret.funcName = "Handle" + name
+	}
+	seen := make(map[string]bool)
+	for _, param := range append(path.prefixParams(), path.params()...) {
+		if seen[param] {
+			return nil, fmt.Errorf("%s path %s has duplicate parameter %s", name, path, param)
+		}
+		seen[param] = true
+	}
+	for _, mime := range ret.produces {
+		if _, ok := getMarshaller(mime); !ok {
+			return nil, fmt.Errorf("%s produces %s which has no marshaller", name, mime)
+		}
+	}
+	meta, err := parseMeta(tag.Get("meta"))
+	if err != nil {
+		return nil, fmt.Errorf("%s meta is invalid: %s", name, err)
+	}
+	ret.meta = meta
+	accepts, err := parseAccept(tag.Get("accept"))
+	if err != nil {
+		return nil, fmt.Errorf("%s accept is invalid: %s", name, err)
+	}
+	ret.accepts = accepts
+	host, err := parseHost(tag.Get("host"))
+	if err != nil {
+		return nil, fmt.Errorf("%s host is invalid: %s", name, err)
+	}
+	ret.host = host
+	return ret, nil
+}
+
+// parseMeta parses meta tag like "scope=admin;audit=true" to map. Pair without "=" has empty value.
+func parseMeta(s string) (map[string]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	ret := make(map[string]string)
+	for _, pair := range strings.Split(s, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if key == "" {
+			return nil, fmt.Errorf("pair %q has empty key", pair)
+		}
+		if _, ok := ret[key]; ok {
+			return nil, fmt.Errorf("duplicate key %s", key)
+		}
+		value := ""
+		if len(kv) == 2 {
+			value = strings.TrimSpace(kv[1])
+		}
+		ret[key] = value
+	}
+	return ret, nil
+}
+
+// parseAccept parses accept tag like "image/png,image/jpeg" to the list of media types in lower case.
+// Each one should have type and subtype without wildcard or parameters.
+func parseAccept(s string) ([]string, error) {
+	var ret []string
+	for _, item := range splitList(s) {
+		t := strings.ToLower(item)
+		i := strings.Index(t, "/")
+		if i <= 0 || i == len(t)-1 || strings.ContainsAny(t, "*; ") || strings.Count(t, "/") != 1 {
+			return nil, fmt.Errorf("%q should be a media type like image/png", item)
+		}
+		ret = append(ret, t)
+	}
+	return ret, nil
+}
+
+// parseHost parses host tag like "admin.*" to a pattern in lower case, where "*" matches any characters,
+// so "admin.*" matches "admin.example.com".
+func parseHost(s string) (string, error) {
+	host := strings.ToLower(strings.TrimSpace(s))
+	for _, c := range host {
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '*') {
+			return "", fmt.Errorf("%q should be a host pattern like admin.*", s)
+		}
+	}
+	return host, nil
+}
+
+// normalizeHost returns host of request in lower case without port, to be matched by matchHost.
+func normalizeHost(host string) string {
+	host = strings.ToLower(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return host
+}
+
+// matchHost checks whether host, without port, matches pattern of parseHost.
+func matchHost(pattern, host string) bool {
+	ok, _ := path.Match(pattern, host)
+	return ok
+}
+
+// splitConstraints removes value sets following path parameters, like ":order{asc|desc}", from path,
+// and returns them keyed by parameter name, compiled to regexps matching exactly one of the values.
+// A segment of inline regexp in parentheses, like "([0-9]+)", becomes an anonymous parameter named by
+// its position among parameters of path, from 1, and its regexp is the constraint of that parameter.
+func splitConstraints(path string) (string, map[string]*regexp.Regexp, error) {
+	if !strings.ContainsAny(path, "{}(") {
+		return path, nil, nil
+	}
+	ret := make(map[string]*regexp.Regexp)
+	segments := strings.Split(path, "/")
+	params := 0
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*") {
+			params++
+		}
+		if strings.HasPrefix(s, "(") {
+			if !strings.HasSuffix(s, ")") {
+				return "", nil, fmt.Errorf("segment %s should be a regexp in parentheses, like ([0-9]+)", s)
+			}
+			re, err := regexp.Compile("^(?:" + s + ")$")
+			if err != nil {
+				return "", nil, fmt.Errorf("segment %s has invalid regexp: %s", s, err)
+			}
+			params++
+			name := strconv.Itoa(params)
+			ret[name] = re
+			segments[i] = ":" + name
+			continue
+		}
+		open := strings.Index(s, "{")
+		if open < 0 {
+			if strings.Contains(s, "}") {
+				return "", nil, fmt.Errorf("segment %s has unmatched }", s)
+			}
+			continue
+		}
+		if s[0] != ':' || open < 2 || !strings.HasSuffix(s, "}") {
+			return "", nil, fmt.Errorf("segment %s should be a parameter followed by values, like :order{asc|desc}", s)
+		}
+		values := strings.Split(s[open+1:len(s)-1], "|")
+		for j, v := range values {
+			if v == "" || strings.ContainsAny(v, "{}") {
+				return "", nil, fmt.Errorf("segment %s has empty or malformed value", s)
+			}
+			values[j] = regexp.QuoteMeta(v)
+		}
+		ret[s[1:open]] = regexp.MustCompile("^(?:" + strings.Join(values, "|") + ")$")
+		segments[i] = s[:open]
+	}
+	return strings.Join(segments, "/"), ret, nil
+}
+
+// splitFormatExtension returns path p without the extension of its last segment, and the mime of the
+// extension, if the extension is in exts and its mime has a registered marshaller.
+func splitFormatExtension(p string, exts map[string]string) (string, string, bool) {
+	last := p[strings.LastIndex(p, "/")+1:]
+	ext := path.Ext(last)
+	if ext == "" || ext == last {
+		return p, "", false
+	}
+	mime, ok := exts[ext]
+	if !ok {
+		return p, "", false
+	}
+	if _, ok := getMarshaller(mime); !ok {
+		return p, "", false
+	}
+	return strings.TrimSuffix(p, ext), mime, true
+}
+
+// allows checks whether path parameters vars are in the value sets of route.
+func (r *route) allows(vars map[string]string) bool {
+	for name, re := range r.constraints {
+		if !re.MatchString(vars[name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// consume checks whether request's content type is accepted by route. Request without content type is
+// always accepted.
+func (r *route) consume(req *http.Request) bool {
+	if len(r.consumes) == 0 {
+		return true
+	}
+	mime, _ := parseHeaderField(req, "Content-Type")
+	if mime == "" {
+		return true
+	}
+	return inList(r.consumes, mime)
+}
+
+// accept checks whether request's content type is in the accept list of route. Unlike consume, request
+// without content type isn't accepted if route has the list.
+func (r *route) accept(req *http.Request) bool {
+	if len(r.accepts) == 0 {
+		return true
+	}
+	mime, _ := parseHeaderField(req, "Content-Type")
+	return inList(r.accepts, strings.ToLower(mime))
+}
+
+// produce makes sure response mime of ctx is one of route produces, otherwise uses the first one.
+func (r *route) produce(ctx *context) {
+	if len(r.produces) == 0 || inList(r.produces, ctx.mime) {
+		return
+	}
+	ctx.mime = r.produces[0]
+}
+
+// cleanPath returns the canonical form of url path p, without double slashes and dot segments. Trailing
+// slash is kept.
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	if p[0] != '/' {
+		p = "/" + p
+	}
+	ret := path.Clean(p)
+	if p[len(p)-1] == '/' && ret != "/" {
+		ret += "/"
+	}
+	return ret
+}
+
+func (r *route) pathExp() string {
+	return fmt.Sprintf("/%s/%s", r.routerMethod(), routerPath(string(r.path)))
+}
+
+// routerMethod returns the first segment of route in router, which is method of route with its host.
+func (r *route) routerMethod() string {
+	return hostMethod(r.method, r.host)
+}
+
+// hostMethod returns method with host pattern, whose "*" is replaced since router takes it as splat.
+func hostMethod(method, host string) string {
+	if host == "" {
+		return method
+	}
+	return method + "@" + strings.Replace(host, "*", "~", -1)
+}
+
+// Routes returns all routes of service, in order of declaration.
+func (r *Rest) Routes() []RouteInfo {
+	t := r.load()
+	ret := make([]RouteInfo, len(t.routes))
+	for i, route := range t.routes {
+		mime := t.defaultMime
+		if len(route.produces) > 0 {
+			mime = route.produces[0]
+		}
+		ret[i] = RouteInfo{
+			Method: route.method,
+			Path:   string(route.path),
+			Func:   route.funcName,
+			Mime:   mime,
+		}
+		switch n := route.handler.(type) {
+		case *processorNode:
+			ret[i].Kind = "processor"
+			if n.channel {
+				ret[i].Streaming = &StreamingInfo{
+					Framing: "raw",
+				}
+				if n.framing == "sse" {
+					ret[i].Streaming.Framing = "sse"
+				}
+			}
+		case *staticNode:
+			ret[i].Kind = "static"
+		case *streamingNode:
+			ret[i].Kind = "streaming"
+			ret[i].Streaming = &StreamingInfo{
+				Framing: "raw",
+			}
+			if n.framing == "sse" {
+				ret[i].Streaming.Framing = "sse"
+			}
+			if n.queue > 0 {
+				ret[i].Streaming.Queue = n.queue
+				ret[i].Streaming.Policy = n.policy
+			}
+		}
+	}
+	return ret
+}
+
+// checkRoute checks r against existing routes. Overlapping routes are reported to overlapHandler if it
+// isn't nil, see Rest.OverlapHandler.
+func checkRoute(routes []*route, r *route, overlapHandler func(method, path1, path2 string) error) error {
+	for _, exist := range routes {
+		if exist.host != r.host {
+			continue
+		}
+		if exist.method != r.method {
+			if exist.method != anyMethod && r.method != anyMethod {
+				continue
+			}
+			method := exist.method
+			if method == anyMethod {
+				method = r.method
+			}
+			_, overlap := comparePath(exist.path, r.path)
+			if overlap && overlapHandler != nil {
+				if err := overlapHandler(method, string(exist.path), string(r.path)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		same, overlap := comparePath(exist.path, r.path)
+		if same {
+			return fmt.Errorf("%s %s of %s conflicts with %s of %s", r.method, r.path, r.name, exist.path, exist.name)
+		}
+		if overlap && overlapHandler != nil {
+			if err := overlapHandler(r.method, string(exist.path), string(r.path)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// comparePath checks whether path a and b match same urls, or overlap on some urls.
+func comparePath(a, b pathFormatter) (same bool, overlap bool) {
+	as, bs := strings.Split(string(a), "/"), strings.Split(string(b), "/")
+	same = true
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		aSplat, bSplat := strings.HasPrefix(as[i], "*"), strings.HasPrefix(bs[i], "*")
+		if aSplat || bSplat {
+			return aSplat && bSplat && len(as) == len(bs), true
+		}
+		aParam, bParam := strings.HasPrefix(as[i], ":") || isPrefixParam(as[i]), strings.HasPrefix(bs[i], ":") || isPrefixParam(bs[i])
+		switch {
+		case aParam && bParam:
+		case aParam || bParam:
+			same = false
+		case as[i] != bs[i]:
+			return false, false
+		}
+	}
+	if len(as) != len(bs) {
+		return false, false
+	}
+	return same, true
+}
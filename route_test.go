@@ -0,0 +1,591 @@
+package rest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestComparePath(t *testing.T) {
+	type Test struct {
+		a, b pathFormatter
+
+		same    bool
+		overlap bool
+	}
+	var tests = []Test{
+		{"/hello", "/hello", true, true},
+		{"/hello", "/world", false, false},
+		{"/hello/:to", "/hello/:name", true, true},
+		{"/hello/:to", "/hello/rest", false, true},
+		{"/hello/:to", "/hello/:to/streaming", false, false},
+		{"/:a/rest", "/hello/:b", false, true},
+		{"/:a/rest", "/hello/world", false, false},
+		{"/files/*path", "/files/a/b", false, true},
+		{"/files/*path", "/files/*name", true, true},
+		{"/files/*path", "/static/a", false, false},
+	}
+	for i, test := range tests {
+		same, overlap := comparePath(test.a, test.b)
+		equal(t, same, test.same, "test %d", i)
+		equal(t, overlap, test.overlap, "test %d", i)
+	}
+}
+
+type TestOverlap struct {
+	Service
+
+	Name  FakeNode `method:"GET" path:"/hello/:to"`
+	Rest  FakeNode `method:"GET" path:"/hello/rest"`
+	Other FakeNode `method:"POST" path:"/hello/:name"`
+}
+
+type TestConflict struct {
+	Service
+
+	Name FakeNode `method:"GET" path:"/hello/:to"`
+	To   FakeNode `method:"GET" path:"/hello/:name"`
+}
+
+func TestRestOverlap(t *testing.T) {
+	_, err := New(new(TestOverlap))
+	equal(t, err, nil)
+
+	var overlaps []string
+	record := WithOverlapHandler(func(method, path1, path2 string) error {
+		overlaps = append(overlaps, method+" "+path1+" "+path2)
+		return nil
+	})
+	rest, err := New(new(TestOverlap), record)
+	equal(t, err, nil)
+	equal(t, overlaps, []string{"GET /hello/:to /hello/rest"})
+
+	err = rest.GET("/hello/:name/more", func(s Service, name string) {})
+	equal(t, err, nil)
+	err = rest.GET("/hello/rest/more", func(s Service) {})
+	equal(t, err, nil)
+	equal(t, overlaps, []string{"GET /hello/:to /hello/rest", "GET /hello/:name/more /hello/rest/more"})
+
+	reject := WithOverlapHandler(func(method, path1, path2 string) error {
+		return fmt.Errorf("overlap")
+	})
+	_, err = New(new(TestOverlap), reject)
+	equal(t, fmt.Sprintf("%v", err), "overlap")
+	err = rest.Reload(new(TestOverlap))
+	equal(t, err, nil)
+	rest.OverlapHandler = func(method, path1, path2 string) error {
+		return fmt.Errorf("overlap")
+	}
+	err = rest.Reload(new(TestOverlap))
+	equal(t, fmt.Sprintf("%v", err), "overlap")
+
+	_, err = New(new(TestConflict))
+	equal(t, fmt.Sprintf("%v", err), "GET /hello/:name of To conflicts with /hello/:to of Name")
+}
+
+type TestAnyMethod struct {
+	Service
+
+	Proxy Processor `method:"*" path:"/proxy/*path"`
+	Get   Processor `method:"GET" path:"/proxy/status"`
+}
+
+func (r TestAnyMethod) HandleProxy() string {
+	return r.Request().Method + " " + r.Vars()["path"]
+}
+
+func (r TestAnyMethod) HandleGet() string {
+	return "status"
+}
+
+func TestRouteAnyMethod(t *testing.T) {
+	type Test struct {
+		method string
+		url    string
+
+		code int
+		body string
+	}
+	var tests = []Test{
+		{"GET", "http://domain/proxy/status", http.StatusOK, "\"status\"\n"},
+		{"POST", "http://domain/proxy/status", http.StatusOK, "\"POST status\"\n"},
+		{"GET", "http://domain/proxy/a/b", http.StatusOK, "\"GET a/b\"\n"},
+		{"PROPFIND", "http://domain/proxy/a", http.StatusOK, "\"PROPFIND a\"\n"},
+		{"GET", "http://domain/other", http.StatusNotFound, ""},
+	}
+	var overlaps []string
+	rest, err := New(new(TestAnyMethod), WithOverlapHandler(func(method, path1, path2 string) error {
+		overlaps = append(overlaps, method+" "+path1+" "+path2)
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	equal(t, overlaps, []string{"GET /proxy/*path /proxy/status"})
+	equal(t, rest.Routes()[0].Method, "ANY")
+	for i, test := range tests {
+		req, err := http.NewRequest(test.method, test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+}
+
+type TestConsumes struct {
+	Service
+
+	Node Processor `method:"POST" path:"/node" consumes:"application/json, text/plain" produces:"application/json"`
+}
+
+func (r TestConsumes) HandleNode() string {
+	return "ok"
+}
+
+type TestNoProducer struct {
+	Service
+
+	Node Processor `method:"POST" path:"/node" produces:"application/unknown"`
+}
+
+func (r TestNoProducer) HandleNode() {}
+
+func TestRouteConsumesProduces(t *testing.T) {
+	type Test struct {
+		contentType string
+		accept      string
+
+		code        int
+		contentMime string
+	}
+	var tests = []Test{
+		{"", "", http.StatusOK, "application/json; charset=utf-8"},
+		{"application/json", "", http.StatusOK, "application/json; charset=utf-8"},
+		{"text/plain; charset=utf-8", "", http.StatusOK, "application/json; charset=utf-8"},
+		{"application/xml", "", http.StatusUnsupportedMediaType, "text/plain; charset=utf-8"},
+	}
+	rest, err := New(new(TestConsumes))
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("POST", "http://domain/node", bytes.NewBufferString(`"body"`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.contentType != "" {
+			req.Header.Set("Content-Type", test.contentType)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Header().Get("Content-Type"), test.contentMime, "test %d", i)
+	}
+
+	_, err = New(new(TestNoProducer))
+	equal(t, fmt.Sprintf("%v", err), "Node produces application/unknown which has no marshaller")
+}
+
+type TestAccept struct {
+	Service
+
+	Upload Processor `method:"POST" path:"/upload" accept:"image/png, image/jpeg"`
+}
+
+func (r TestAccept) HandleUpload() int {
+	b, _ := ioutil.ReadAll(r.Request().Body)
+	return len(b)
+}
+
+type TestBadAccept struct {
+	Service
+
+	Upload Processor `method:"POST" path:"/upload" accept:"image/*"`
+}
+
+func (r TestBadAccept) HandleUpload() {}
+
+func TestRouteAccept(t *testing.T) {
+	type Test struct {
+		contentType string
+
+		code int
+		body string
+	}
+	var tests = []Test{
+		{"image/png", http.StatusOK, "4\n"},
+		{"IMAGE/JPEG", http.StatusOK, "4\n"},
+		{"image/gif", http.StatusUnsupportedMediaType, "/upload only accepts content type image/png, image/jpeg\n"},
+		{"application/json", http.StatusUnsupportedMediaType, "/upload only accepts content type image/png, image/jpeg\n"},
+		{"", http.StatusUnsupportedMediaType, "/upload only accepts content type image/png, image/jpeg\n"},
+	}
+	rest, err := New(new(TestAccept))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("POST", "http://domain/upload", bytes.NewBufferString("\x89PNG"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.contentType != "" {
+			req.Header.Set("Content-Type", test.contentType)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+
+	_, err = New(new(TestBadAccept))
+	equal(t, fmt.Sprintf("%v", err), `Upload accept is invalid: "image/*" should be a media type like image/png`)
+}
+
+func TestParseAccept(t *testing.T) {
+	type Test struct {
+		accept string
+
+		list []string
+		ok   bool
+	}
+	var tests = []Test{
+		{"", nil, true},
+		{"image/png", []string{"image/png"}, true},
+		{" Image/PNG, image/jpeg ,", []string{"image/png", "image/jpeg"}, true},
+		{"png", nil, false},
+		{"image/", nil, false},
+		{"/png", nil, false},
+		{"image/png; q=1", nil, false},
+		{"image/png/x", nil, false},
+	}
+	for i, test := range tests {
+		list, err := parseAccept(test.accept)
+		equal(t, err == nil, test.ok, "test %d", i)
+		equal(t, list, test.list, "test %d", i)
+	}
+}
+
+func TestParseHost(t *testing.T) {
+	type Test struct {
+		host string
+
+		pattern string
+		ok      bool
+	}
+	var tests = []Test{
+		{"", "", true},
+		{"admin.*", "admin.*", true},
+		{" API.Example.com ", "api.example.com", true},
+		{"admin.example.com:8080", "", false},
+		{"admin/*", "", false},
+		{"[a-z].example.com", "", false},
+	}
+	for i, test := range tests {
+		pattern, err := parseHost(test.host)
+		equal(t, err == nil, test.ok, "test %d", i)
+		equal(t, pattern, test.pattern, "test %d", i)
+	}
+}
+
+func TestMatchHost(t *testing.T) {
+	type Test struct {
+		pattern string
+		host    string
+
+		ok bool
+	}
+	var tests = []Test{
+		{"admin.*", "admin.example.com", true},
+		{"admin.*", "admin.", true},
+		{"admin.*", "api.example.com", false},
+		{"*.example.com", "api.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"api.example.com", "api.example.com", true},
+	}
+	for i, test := range tests {
+		equal(t, matchHost(test.pattern, test.host), test.ok, "test %d", i)
+	}
+}
+
+func TestRouteProduce(t *testing.T) {
+	type Test struct {
+		produces []string
+		mime     string
+
+		expect string
+	}
+	var tests = []Test{
+		{nil, "application/json", "application/json"},
+		{[]string{"application/json"}, "application/json", "application/json"},
+		{[]string{"application/xml", "application/json"}, "application/json", "application/json"},
+		{[]string{"application/xml", "application/json"}, "text/plain", "application/xml"},
+	}
+	for i, test := range tests {
+		r := &route{produces: test.produces}
+		ctx := &context{mime: test.mime}
+		r.produce(ctx)
+		equal(t, ctx.mime, test.expect, "test %d", i)
+	}
+}
+
+type TestDuplicateParam struct {
+	Service `prefix:"/prefix"`
+
+	Node FakeNode `method:"GET" path:"/user/:id/post/:id"`
+}
+
+func TestNewDuplicateParam(t *testing.T) {
+	_, err := New(new(TestDuplicateParam))
+	equal(t, fmt.Sprintf("%v", err), "Node path /prefix/user/:id/post/:id has duplicate parameter id")
+
+	rest, err := New(new(TestPost))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rest.HandleFunc("GET", "/a/:x/*x", func(s Service) {})
+	equal(t, err != nil, true)
+}
+
+func TestCleanPath(t *testing.T) {
+	type Test struct {
+		path string
+
+		clean string
+	}
+	var tests = []Test{
+		{"", "/"},
+		{"/", "/"},
+		{"//", "/"},
+		{"/prefix/hello", "/prefix/hello"},
+		{"/prefix//hello/./rest", "/prefix/hello/rest"},
+		{"/prefix/hello/../world/", "/prefix/world/"},
+		{"/prefix/.", "/prefix"},
+		{"/../prefix", "/prefix"},
+		{"prefix", "/prefix"},
+	}
+	for i, test := range tests {
+		equal(t, cleanPath(test.path), test.clean, "test %d", i)
+	}
+}
+
+func TestRestCleanPath(t *testing.T) {
+	type Test struct {
+		clean    bool
+		redirect bool
+		method   string
+		url      string
+
+		code     int
+		location string
+		body     string
+	}
+	var tests = []Test{
+		{false, false, "GET", "http://domain/prefix//hello/./rest", http.StatusNotFound, "", ""},
+		{true, false, "GET", "http://domain/prefix//hello/./rest", http.StatusOK, "", "\"rest\"\n"},
+		{true, false, "GET", "http://domain/prefix/hello/rest", http.StatusOK, "", "\"rest\"\n"},
+		{false, true, "GET", "http://domain/prefix//hello/./rest?a=1", http.StatusMovedPermanently, "/prefix/hello/rest?a=1", ""},
+		{false, true, "POST", "http://domain/prefix//hello/rest", http.StatusPermanentRedirect, "/prefix/hello/rest", ""},
+		{false, true, "GET", "http://domain/prefix/hello/rest", http.StatusOK, "", "\"rest\"\n"},
+		{false, true, "GET", "http://domain//", http.StatusMovedPermanently, "/", ""},
+	}
+	rest := NewRouter("/prefix")
+	err := rest.GET("/hello/:to", func(s Service) string {
+		return s.Vars()["to"]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		rest.CleanPath, rest.RedirectCleanPath = test.clean, test.redirect
+		req, err := http.NewRequest(test.method, test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Header().Get("Location"), test.location, "test %d", i)
+		if test.body != "" {
+			equal(t, w.Body.String(), test.body, "test %d", i)
+		}
+	}
+}
+
+type TestConstraint struct {
+	Service `prefix:"/prefix"`
+
+	Sort Processor `method:"GET" path:"/sort/:order{asc|desc}" args:"order"`
+	Code Processor `method:"GET" path:"/status/:code{200|404}" args:"code"`
+}
+
+func (r TestConstraint) HandleSort(order string) string {
+	return order
+}
+
+func (r TestConstraint) HandleCode(code int) int {
+	return code
+}
+
+type TestBadConstraint struct {
+	Service `prefix:"/prefix"`
+
+	Sort Processor `method:"GET" path:"/sort/:order{asc||desc}"`
+}
+
+func (r TestBadConstraint) HandleSort(order string) string {
+	return order
+}
+
+func TestSplitConstraints(t *testing.T) {
+	type Test struct {
+		path string
+
+		clean string
+		names []string
+		err   string
+	}
+	var tests = []Test{
+		{"/sort/:order", "/sort/:order", nil, ""},
+		{"/sort/:order{asc|desc}", "/sort/:order", []string{"order"}, ""},
+		{"/:a{x}/:b{y|z}", "/:a/:b", []string{"a", "b"}, ""},
+		{"/sort/:order{}", "", nil, "segment :order{} has empty or malformed value"},
+		{"/sort/:order{asc||desc}", "", nil, "segment :order{asc||desc} has empty or malformed value"},
+		{"/sort/:order{asc", "", nil, "segment :order{asc should be a parameter followed by values, like :order{asc|desc}"},
+		{"/sort/order{asc}", "", nil, "segment order{asc} should be a parameter followed by values, like :order{asc|desc}"},
+		{"/sort/*order{asc}", "", nil, "segment *order{asc} should be a parameter followed by values, like :order{asc|desc}"},
+		{"/sort/:order}", "", nil, "segment :order} has unmatched }"},
+		{"/user/:id/posts/([0-9]+)", "/user/:id/posts/:2", []string{"2"}, ""},
+		{"/([a-z]{2})/:id{x|y}/([0-9]+)", "/:1/:id/:3", []string{"1", "id", "3"}, ""},
+		{"/user/([0-9]+", "", nil, "segment ([0-9]+ should be a regexp in parentheses, like ([0-9]+)"},
+		{"/user/([0-9+)", "", nil, "segment ([0-9+) has invalid regexp: error parsing regexp: missing closing ]: `[0-9+))$`"},
+	}
+	for i, test := range tests {
+		clean, constraints, err := splitConstraints(test.path)
+		if test.err != "" {
+			equal(t, fmt.Sprintf("%v", err), test.err, "test %d", i)
+			continue
+		}
+		equal(t, err, nil, "test %d", i)
+		equal(t, clean, test.clean, "test %d", i)
+		equal(t, len(constraints), len(test.names), "test %d", i)
+		for _, name := range test.names {
+			equal(t, constraints[name] != nil, true, "test %d", i)
+		}
+	}
+}
+
+func TestRestConstraint(t *testing.T) {
+	type Test struct {
+		url string
+
+		code int
+		body string
+	}
+	var tests = []Test{
+		{"http://domain/prefix/sort/asc", http.StatusOK, "\"asc\"\n"},
+		{"http://domain/prefix/sort/desc", http.StatusOK, "\"desc\"\n"},
+		{"http://domain/prefix/sort/random", http.StatusNotFound, ""},
+		{"http://domain/prefix/sort/ascending", http.StatusNotFound, ""},
+		{"http://domain/prefix/status/404", http.StatusOK, "404\n"},
+		{"http://domain/prefix/status/500", http.StatusNotFound, ""},
+		{"http://domain/prefix/level/high", http.StatusOK, "\"high\"\n"},
+		{"http://domain/prefix/level/medium", http.StatusNotFound, ""},
+		{"http://domain/prefix/user/7/posts/42", http.StatusOK, "\"7 42\"\n"},
+		{"http://domain/prefix/user/7/posts/latest", http.StatusNotFound, ""},
+	}
+	rest, err := New(new(TestConstraint))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rest.GET("/level/:level{low|high}", func(s Service, level string) string { return level }); err != nil {
+		t.Fatal(err)
+	}
+	if err := rest.GET("/user/:id/posts/([0-9]+)", func(s Service, id, post string) string {
+		if post != s.Vars()["2"] {
+			return "vars mismatch"
+		}
+		return id + " " + post
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+
+	_, err = New(new(TestBadConstraint))
+	equal(t, fmt.Sprintf("%v", err), "Sort path /sort/:order{asc||desc} is invalid: segment :order{asc||desc} has empty or malformed value")
+	err = rest.GET("/bad/:x{a|}", func(s Service, x string) string { return x })
+	equal(t, fmt.Sprintf("%v", err), "GET path /bad/:x{a|} is invalid: segment :x{a|} has empty or malformed value")
+}
+
+func TestRestFormatExtensions(t *testing.T) {
+	type Test struct {
+		url    string
+		accept string
+
+		code        int
+		contentType string
+		body        string
+	}
+	var tests = []Test{
+		{"http://domain/hello/rest", "", http.StatusOK, "application/json; charset=utf-8", "\"rest\"\n"},
+		{"http://domain/hello/rest.fake", "", http.StatusOK, "text/x-fake; charset=utf-8", "<rest>"},
+		{"http://domain/hello/rest.json", "text/x-fake", http.StatusOK, "application/json; charset=utf-8", "\"rest\"\n"},
+		{"http://domain/files/a.txt", "", http.StatusOK, "application/json; charset=utf-8", "\"a.txt\"\n"},
+		{"http://domain/files/a.none", "", http.StatusOK, "application/json; charset=utf-8", "\"a.none\"\n"},
+		{"http://domain/files/a.fake", "", http.StatusOK, "text/x-fake; charset=utf-8", "<a>"},
+		{"http://domain/report.json", "", http.StatusOK, "application/json; charset=utf-8", "\"report\"\n"},
+		{"http://domain/report.fake", "", http.StatusNotFound, "", ""},
+		{"http://domain/.json", "", http.StatusNotFound, "", ""},
+	}
+	RegisterMarshaller("text/x-fake", FakeMarshaller{})
+	defer delete(marshallers, "text/x-fake")
+	rest := NewRouter("/")
+	err := WithFormatExtensions(map[string]string{
+		".json": "application/json",
+		".fake": "text/x-fake",
+		".none": "text/x-none",
+	})(rest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rest.GET("/hello/:to", func(s Service, to string) string { return to }); err != nil {
+		t.Fatal(err)
+	}
+	if err := rest.GET("/files/*name", func(s Service, name string) string { return name }); err != nil {
+		t.Fatal(err)
+	}
+	if err := rest.GET("/report.json", func(s Service) string { return "report" }); err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Header().Get("Content-Type"), test.contentType, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+	}
+
+	err = WithFormatExtensions(map[string]string{"json": "application/json"})(rest)
+	equal(t, fmt.Sprintf("%v", err), `invalid format extension: "json"`)
+}
@@ -0,0 +1,54 @@
+package rest
+
+import (
+	"github.com/ant0ine/go-urlrouter"
+	"reflect"
+	"strconv"
+)
+
+/*
+NewRouter creates Rest without service struct, to register handlers programmatically, like:
+
+	r := rest.NewRouter("/prefix")
+	err := r.GET("/hello/:to", func(s rest.Service) string {
+		return "hello " + s.Vars()["to"]
+	})
+
+Handlers follow the convention of Rest.HandleFunc. Rest created by New can register handlers in same way.
+*/
+func NewRouter(prefix string) *Rest {
+	prefixes, mime, charset, _ := initService(reflect.Value{}, reflect.StructTag("prefix:"+strconv.Quote(prefix)))
+	return &Rest{
+		table: &table{
+			router:         new(urlrouter.Router),
+			prefixes:       prefixes,
+			defaultMime:    mime,
+			defaultCharset: charset,
+		},
+	}
+}
+
+// GET registers fn to handle GET request of path. See Rest.HandleFunc.
+func (r *Rest) GET(path string, fn interface{}) error {
+	return r.HandleFunc("GET", path, fn)
+}
+
+// POST registers fn to handle POST request of path. See Rest.HandleFunc.
+func (r *Rest) POST(path string, fn interface{}) error {
+	return r.HandleFunc("POST", path, fn)
+}
+
+// PUT registers fn to handle PUT request of path. See Rest.HandleFunc.
+func (r *Rest) PUT(path string, fn interface{}) error {
+	return r.HandleFunc("PUT", path, fn)
+}
+
+// PATCH registers fn to handle PATCH request of path. See Rest.HandleFunc.
+func (r *Rest) PATCH(path string, fn interface{}) error {
+	return r.HandleFunc("PATCH", path, fn)
+}
+
+// DELETE registers fn to handle DELETE request of path. See Rest.HandleFunc.
+func (r *Rest) DELETE(path string, fn interface{}) error {
+	return r.HandleFunc("DELETE", path, fn)
+}
@@ -0,0 +1,80 @@
+package rest
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewRouter(t *testing.T) {
+	type Test struct {
+		method string
+		url    string
+		body   string
+
+		code     int
+		response string
+	}
+	r := NewRouter("prefix")
+	equal(t, r.Prefix(), "/prefix")
+	items := make(map[string]string)
+	for _, id := range []string{"1", "2"} {
+		id := id
+		equal(t, r.GET("/item/"+id, func(s Service) string {
+			return items[id]
+		}), nil)
+	}
+	equal(t, r.PUT("/item/:id", func(s Service, id string, v string) {
+		items[id] = v
+	}), nil)
+	equal(t, r.DELETE("/item/:id", func(s Service) {
+		delete(items, s.Vars()["id"])
+		s.WriteHeader(http.StatusNoContent)
+	}), nil)
+
+	var tests = []Test{
+		{"PUT", "http://domain/prefix/item/1", `"one"`, http.StatusOK, ""},
+		{"GET", "http://domain/prefix/item/1", ``, http.StatusOK, "\"one\"\n"},
+		{"GET", "http://domain/prefix/item/2", ``, http.StatusOK, "\"\"\n"},
+		{"DELETE", "http://domain/prefix/item/1", ``, http.StatusNoContent, ""},
+		{"GET", "http://domain/prefix/item/1", ``, http.StatusOK, "\"\"\n"},
+		{"GET", "http://domain/prefix/item/3", ``, http.StatusNotFound, ""},
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest(test.method, test.url, bytes.NewBufferString(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Body.String(), test.response, "test %d", i)
+	}
+}
+
+func TestRouterMixed(t *testing.T) {
+	r, err := New(&RestExample{
+		post:  make(map[string]string),
+		watch: make(map[string]chan string),
+	})
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	equal(t, r.GET("/hello", func(s Service) string {
+		return "hello"
+	}), nil)
+	err = r.POST("/hello", func(s Service) {})
+	equal(t, strings.HasSuffix(fmt.Sprintf("%v", err), "conflicts with /prefix/hello of CreateHello"), true)
+
+	req, err := http.NewRequest("GET", "http://domain/prefix/hello", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	equal(t, w.Code, http.StatusOK)
+	equal(t, w.Body.String(), "\"hello\"\n")
+}
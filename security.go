@@ -0,0 +1,168 @@
+package rest
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SecurityOptions configures headers set by SecurityHeaders. Empty value disables the header.
+type SecurityOptions struct {
+	// Strict-Transport-Security, only sent when request is over TLS.
+	HSTS string
+	// X-Frame-Options
+	FrameOptions string
+	// X-Content-Type-Options
+	ContentTypeOptions string
+	// Content-Security-Policy
+	ContentSecurityPolicy string
+}
+
+// DefaultSecurityOptions is a strict setting suitable for api service.
+var DefaultSecurityOptions = SecurityOptions{
+	HSTS:                  "max-age=31536000; includeSubDomains",
+	FrameOptions:          "DENY",
+	ContentTypeOptions:    "nosniff",
+	ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'",
+}
+
+// checkFraming returns error if the body length of request r is ambiguous, which may be used to smuggle
+// requests through a proxy interpreting it differently. See Rest.StrictRequestParsing.
+func checkFraming(r *http.Request) error {
+	var lengths []string
+	for _, v := range r.Header["Content-Length"] {
+		lengths = append(lengths, strings.Split(v, ",")...)
+	}
+	if len(lengths) > 1 {
+		return errors.New("request has duplicate Content-Length")
+	}
+	if len(lengths) > 0 && (len(r.TransferEncoding) > 0 || len(r.Header["Transfer-Encoding"]) > 0) {
+		return errors.New("request has both Content-Length and Transfer-Encoding")
+	}
+	return nil
+}
+
+/*
+SecurityHeaders returns a middleware which sets common security headers configured by opts, before
+calling the wrapped handler:
+
+	handler, err := rest.New(&RestExample{})
+	http.ListenAndServe("127.0.0.1:8080", rest.SecurityHeaders(rest.DefaultSecurityOptions)(handler))
+
+Handler can overwrite them.
+*/
+func SecurityHeaders(opts SecurityOptions) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := w.Header()
+			if opts.HSTS != "" && r.TLS != nil {
+				header.Set("Strict-Transport-Security", opts.HSTS)
+			}
+			if opts.FrameOptions != "" {
+				header.Set("X-Frame-Options", opts.FrameOptions)
+			}
+			if opts.ContentTypeOptions != "" {
+				header.Set("X-Content-Type-Options", opts.ContentTypeOptions)
+			}
+			if opts.ContentSecurityPolicy != "" {
+				header.Set("Content-Security-Policy", opts.ContentSecurityPolicy)
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ErrBodyReadTimeout is returned by reading request body slower than Rest.BodyReadTimeout or
+// Rest.MinBodyReadRate allows. Request failing with it gets 408 Request Timeout.
+var ErrBodyReadTimeout = errors.New("reading request body timed out")
+
+// bodyErrorStatus returns the status of request whose body failed to unmarshal with err.
+func bodyErrorStatus(err error) int {
+	if errors.Is(err, ErrBodyReadTimeout) {
+		return http.StatusRequestTimeout
+	}
+	return http.StatusBadRequest
+}
+
+// slowBodyReader fails reading request body which is too slow. See Rest.BodyReadTimeout and
+// Rest.MinBodyReadRate. Body is read in another goroutine, so handler isn't blocked by a client sending
+// nothing. After timeout, that goroutine is left blocked until the connection is closed, which is asked
+// by setting Connection: close to header of response.
+type slowBodyReader struct {
+	io.ReadCloser
+	header   http.Header
+	start    time.Time
+	timeout  time.Duration
+	rate     int
+	read     int64
+	buf      []byte
+	result   chan slowRead
+	pending  bool
+	timedOut bool
+}
+
+type slowRead struct {
+	n   int
+	err error
+}
+
+func newSlowBodyReader(body io.ReadCloser, header http.Header, start time.Time, timeout time.Duration, rate int) *slowBodyReader {
+	return &slowBodyReader{
+		ReadCloser: body,
+		header:     header,
+		start:      start,
+		timeout:    timeout,
+		rate:       rate,
+		result:     make(chan slowRead, 1),
+	}
+}
+
+// deadline returns the time by which next bytes of body should arrive.
+func (r *slowBodyReader) deadline() time.Time {
+	var ret time.Time
+	if r.timeout > 0 {
+		ret = r.start.Add(r.timeout)
+	}
+	if r.rate > 0 {
+		d := r.start.Add(time.Second + time.Duration(r.read)*time.Second/time.Duration(r.rate))
+		if ret.IsZero() || d.Before(ret) {
+			ret = d
+		}
+	}
+	return ret
+}
+
+func (r *slowBodyReader) Read(p []byte) (int, error) {
+	if r.timedOut {
+		return 0, ErrBodyReadTimeout
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if !r.pending {
+		if len(r.buf) < len(p) {
+			r.buf = make([]byte, len(p))
+		}
+		buf := r.buf[:len(p)]
+		r.pending = true
+		go func() {
+			n, err := r.ReadCloser.Read(buf)
+			r.result <- slowRead{n, err}
+		}()
+	}
+	timer := time.NewTimer(time.Until(r.deadline()))
+	defer timer.Stop()
+	select {
+	case res := <-r.result:
+		r.pending = false
+		n := copy(p, r.buf[:res.n])
+		r.read += int64(n)
+		return n, res.err
+	case <-timer.C:
+		r.timedOut = true
+		r.header.Set("Connection", "close")
+		return 0, ErrBodyReadTimeout
+	}
+}
@@ -0,0 +1,176 @@
+package rest
+
+import (
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	type Test struct {
+		opts SecurityOptions
+		tls  bool
+
+		headers http.Header
+	}
+	var tests = []Test{
+		{DefaultSecurityOptions, false, http.Header{
+			"X-Frame-Options":         {"DENY"},
+			"X-Content-Type-Options":  {"nosniff"},
+			"Content-Security-Policy": {"default-src 'none'; frame-ancestors 'none'"},
+		}},
+		{DefaultSecurityOptions, true, http.Header{
+			"Strict-Transport-Security": {"max-age=31536000; includeSubDomains"},
+			"X-Frame-Options":           {"DENY"},
+			"X-Content-Type-Options":    {"nosniff"},
+			"Content-Security-Policy":   {"default-src 'none'; frame-ancestors 'none'"},
+		}},
+		{SecurityOptions{HSTS: "max-age=60", ContentTypeOptions: "nosniff"}, true, http.Header{
+			"Strict-Transport-Security": {"max-age=60"},
+			"X-Content-Type-Options":    {"nosniff"},
+		}},
+		{SecurityOptions{}, true, http.Header{}},
+	}
+	for i, test := range tests {
+		h := SecurityHeaders(test.opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		req, err := http.NewRequest("GET", "http://domain/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.tls {
+			req.TLS = new(tls.ConnectionState)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		equal(t, w.Header(), test.headers, "test %d", i)
+	}
+}
+
+func TestCheckFraming(t *testing.T) {
+	type Test struct {
+		header           http.Header
+		transferEncoding []string
+
+		err string
+	}
+	var tests = []Test{
+		{http.Header{}, nil, ""},
+		{http.Header{"Content-Length": {"5"}}, nil, ""},
+		{http.Header{}, []string{"chunked"}, ""},
+		{http.Header{"Content-Length": {"5", "5"}}, nil, "request has duplicate Content-Length"},
+		{http.Header{"Content-Length": {"5, 6"}}, nil, "request has duplicate Content-Length"},
+		{http.Header{"Content-Length": {"5"}}, []string{"chunked"}, "request has both Content-Length and Transfer-Encoding"},
+		{http.Header{"Content-Length": {"5"}, "Transfer-Encoding": {"chunked"}}, nil, "request has both Content-Length and Transfer-Encoding"},
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("POST", "http://domain/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header = test.header
+		req.TransferEncoding = test.transferEncoding
+		err = checkFraming(req)
+		if test.err == "" {
+			equal(t, err, nil, "test %d", i)
+		} else if err == nil {
+			t.Errorf("test %d: expect error %s", i, test.err)
+		} else {
+			equal(t, err.Error(), test.err, "test %d", i)
+		}
+	}
+}
+
+func TestSlowBodyReader(t *testing.T) {
+	type Test struct {
+		timeout time.Duration
+		rate    int
+		chunks  []string
+		delay   time.Duration
+
+		body string
+		err  error
+	}
+	var tests = []Test{
+		{time.Second, 0, []string{"a", "b"}, 0, "ab", nil},
+		{time.Millisecond * 50, 0, []string{"a", "b"}, time.Millisecond * 200, "a", ErrBodyReadTimeout},
+		{0, 1000000, []string{"a", "b"}, time.Millisecond * 200, "ab", nil},
+		{0, 10, []string{"a", "b"}, time.Millisecond * 1300, "a", ErrBodyReadTimeout},
+		{time.Millisecond * 50, 1000000, []string{"a", "b"}, time.Millisecond * 200, "a", ErrBodyReadTimeout},
+	}
+	for i, test := range tests {
+		pr, pw := io.Pipe()
+		go func(test Test) {
+			for j, chunk := range test.chunks {
+				if j > 0 {
+					time.Sleep(test.delay)
+				}
+				pw.Write([]byte(chunk))
+			}
+			pw.Close()
+		}(test)
+		header := make(http.Header)
+		r := newSlowBodyReader(pr, header, time.Now(), test.timeout, test.rate)
+		body, err := ioutil.ReadAll(r)
+		equal(t, string(body), test.body, "test %d", i)
+		equal(t, err, test.err, "test %d", i)
+		if test.err != nil {
+			equal(t, header.Get("Connection"), "close", "test %d", i)
+		}
+		pr.Close()
+	}
+}
+
+func TestRestBodyReadTimeout(t *testing.T) {
+	rest := NewRouter("/")
+	rest.BodyReadTimeout = time.Millisecond * 100
+	if err := rest.POST("/echo", func(s Service, v string) string { return v }); err != nil {
+		t.Fatal(err)
+	}
+	if err := rest.POST("/raw", func(s Service) error {
+		_, err := ioutil.ReadAll(s.Request().Body)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(rest)
+	defer server.Close()
+
+	type Test struct {
+		path  string
+		delay time.Duration
+
+		code int
+	}
+	var tests = []Test{
+		{"/echo", 0, http.StatusOK},
+		{"/echo", time.Second, http.StatusRequestTimeout},
+		{"/raw", time.Second, http.StatusRequestTimeout},
+	}
+	for i, test := range tests {
+		pr, pw := io.Pipe()
+		go func(delay time.Duration) {
+			pw.Write([]byte(`"ab`))
+			time.Sleep(delay)
+			pw.Write([]byte(`c"`))
+			pw.Close()
+		}(test.delay)
+		req, err := http.NewRequest("POST", server.URL+test.path, pr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		equal(t, resp.StatusCode, test.code, "test %d", i)
+		if test.code == http.StatusRequestTimeout {
+			equal(t, time.Since(start) < test.delay, true, "test %d", i)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package rest
 
 import (
+	"fmt"
 	"reflect"
+	"strings"
 )
 
 /*
@@ -10,17 +12,28 @@ Define the service.
 Valid tag:
 
  - prefix: The prefix path of http request. All processor's path will prefix with prefix path.
+   Several prefixes can be separated by comma, like prefix:"/api,/v1", then all handlers match under
+   each of them. The first one is the primary prefix returned by Rest.Prefix. They also work in
+   combined rest tag, like rest:"prefix=/api,/v1,mime=application/json", as long as the next option
+   follows as key=. Prefix can have parameters, like prefix:"/t/:tenant/api" for multi-tenant routing,
+   whose values are in Vars but aren't captured by handler arguments, and can be bound by path tag of
+   request fields. Rest.Prefix returns them like "/t/{tenant}/api", which fits PathPrefix of gorilla
+   mux. Splat parameter isn't allowed in prefix.
  - mime: Define the default mime of all processor in this service.
  - compress: If value is "on", it will compress response using "Accept-Encoding" in request header.
+ - host: Pattern of request host matched by all nodes, like host:"admin.*", where "*" matches any
+   characters. Port of request host is ignored. Host tag of node overrides it. Request host is set by
+   client, so it mustn't be used for access control. See Processor.
 
 To be implement:
- - charset: Define the default charset of all processor in this service.
+ - charset: Define the default charset of all processor in this service. It isn't added to Content-Type of
+   binary mime, see BinaryMarshaller.
 */
 type Service struct {
 	*context
 }
 
-func initService(service reflect.Value, tag reflect.StructTag) (string, string, string, error) {
+func initService(service reflect.Value, tag reflect.StructTag) ([]string, string, string, error) {
 	mime := tag.Get("mime")
 	if mime == "" {
 		mime = "application/json"
@@ -31,13 +44,35 @@ func initService(service reflect.Value, tag reflect.StructTag) (string, string,
 		charset = "utf-8"
 	}
 
-	prefix := tag.Get("prefix")
-	if prefix == "" {
-		prefix = "/"
+	var prefixes []string
+	for _, prefix := range strings.Split(tag.Get("prefix"), ",") {
+		prefix = strings.TrimSpace(prefix)
+		if prefix == "" {
+			continue
+		}
+		if prefix[0] != '/' {
+			prefix = "/" + prefix
+		}
+		segments := strings.Split(prefix, "/")
+		for i, segment := range segments {
+			switch {
+			case strings.HasPrefix(segment, "*"):
+				return nil, "", "", fmt.Errorf("prefix %s can't have splat parameter %s", prefix, segment)
+			case strings.HasPrefix(segment, ":"):
+				if len(segment) == 1 {
+					return nil, "", "", fmt.Errorf("prefix %s has parameter without name", prefix)
+				}
+				segments[i] = "{" + segment[1:] + "}"
+			}
+		}
+		prefix = strings.Join(segments, "/")
+		if !inList(prefixes, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
 	}
-	if prefix[0] != '/' {
-		prefix = "/" + prefix
+	if len(prefixes) == 0 {
+		prefixes = []string{"/"}
 	}
 
-	return prefix, mime, charset, nil
+	return prefixes, mime, charset, nil
 }
@@ -2,7 +2,10 @@ package rest
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -10,30 +13,91 @@ func TestService(t *testing.T) {
 	type Test struct {
 		tag reflect.StructTag
 
-		ok      bool
-		prefix  string
-		mime    string
-		charset string
+		ok       bool
+		prefixes []string
+		mime     string
+		charset  string
 	}
 	var tests = []Test{
-		{``, true, "/", "application/json", "utf-8"},
-		{`prefix:"/prefix" realm:"abc,xyz" mime:"application/xml" charset:"gbk"`, true, "/prefix", "application/xml", "gbk"},
-		{`prefix:"/prefix" realm:"abc,xyz" charset:"gbk"`, true, "/prefix", "application/json", "gbk"},
-		{`prefix:"/prefix" realm:"abc,xyz" mime:"application/xml"`, true, "/prefix", "application/xml", "utf-8"},
-		{`realm:"abc,xyz" mime:"application/xml"`, true, "/", "application/xml", "utf-8"},
+		{``, true, []string{"/"}, "application/json", "utf-8"},
+		{`prefix:"/prefix" realm:"abc,xyz" mime:"application/xml" charset:"gbk"`, true, []string{"/prefix"}, "application/xml", "gbk"},
+		{`prefix:"/prefix" realm:"abc,xyz" charset:"gbk"`, true, []string{"/prefix"}, "application/json", "gbk"},
+		{`prefix:"/prefix" realm:"abc,xyz" mime:"application/xml"`, true, []string{"/prefix"}, "application/xml", "utf-8"},
+		{`realm:"abc,xyz" mime:"application/xml"`, true, []string{"/"}, "application/xml", "utf-8"},
+		{`prefix:"/api, v1,,/api"`, true, []string{"/api", "/v1"}, "application/json", "utf-8"},
+		{`prefix:","`, true, []string{"/"}, "application/json", "utf-8"},
+		{`prefix:"/t/:tenant/api,/{org}"`, true, []string{"/t/{tenant}/api", "/{org}"}, "application/json", "utf-8"},
+		{`prefix:"/t/*tenant"`, false, nil, "", ""},
+		{`prefix:"/t/:/api"`, false, nil, "", ""},
 	}
 
 	for i, test := range tests {
 		service := new(Service)
-		prefix, mime, charset, err := initService(reflect.ValueOf(service).Elem(), test.tag)
+		prefixes, mime, charset, err := initService(reflect.ValueOf(service).Elem(), test.tag)
 		equal(t, err == nil, test.ok, fmt.Sprintf("test %d", i))
-		if !test.ok {
-			t.Error(err)
+		if err != nil {
 			continue
 		}
 
-		equal(t, prefix, test.prefix, fmt.Sprintf("test %d", i))
+		equal(t, prefixes, test.prefixes, fmt.Sprintf("test %d", i))
 		equal(t, mime, test.mime, fmt.Sprintf("test %d", i))
 		equal(t, charset, test.charset, fmt.Sprintf("test %d", i))
 	}
 }
+
+type TestTenant struct {
+	Service `prefix:"/t/:tenant/api"`
+
+	Get  Processor `method:"GET" path:"/users/:id" args:"id"`
+	Find Processor `method:"POST" path:"/find"`
+}
+
+type TestTenantFind struct {
+	Tenant string `path:"tenant"`
+	Name   string `json:"name"`
+}
+
+func (s TestTenant) HandleGet(id string) string {
+	return s.Vars()["tenant"] + ":" + id
+}
+
+func (s TestTenant) HandleFind(arg TestTenantFind) string {
+	return arg.Tenant + ":" + arg.Name
+}
+
+func TestServicePrefixParam(t *testing.T) {
+	type Test struct {
+		method string
+		url    string
+		body   string
+
+		code     int
+		response string
+	}
+	var tests = []Test{
+		{"GET", "http://domain/t/acme/api/users/1", "", http.StatusOK, "\"acme:1\"\n"},
+		{"GET", "http://domain/t/other/api/users/2", "", http.StatusOK, "\"other:2\"\n"},
+		{"POST", "http://domain/t/acme/api/find", `{"name":"bob"}`, http.StatusOK, "\"acme:bob\"\n"},
+		{"GET", "http://domain/t/acme/users/1", "", http.StatusNotFound, ""},
+		{"GET", "http://domain/api/users/1", "", http.StatusNotFound, ""},
+	}
+	instance := new(TestTenant)
+	rest, err := New(instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, rest.Prefix(), "/t/{tenant}/api")
+	equal(t, instance.Get.PathMap(map[string]string{"tenant": "acme", "id": "1"}), "/t/acme/api/users/1")
+	for i, test := range tests {
+		req, err := http.NewRequest(test.method, test.url, strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		if test.code == http.StatusOK {
+			equal(t, w.Body.String(), test.response, "test %d", i)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package rest
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+)
+
+/*
+Static serves files in directory dir under urlPath of every prefix, like r.Static("/assets", "./public")
+serving file "./public/css/app.css" at "/prefix/assets/css/app.css". Directory isn't listed, and
+missing file gets 404 Not Found.
+
+If client accepts gzip, precompressed sibling file of the same name with ".gz" suffix, like
+"app.css.gz", is served as is with Content-Encoding gzip and the content type of original file, even if
+service doesn't compress response, see compress tag of Service. Without the sibling, file is compressed
+on the fly as other responses, or sent uncompressed if service doesn't compress response. Response has
+header Vary: Accept-Encoding either way.
+
+Range and conditional requests are supported by http.ServeContent. Range of precompressed file counts
+bytes of the compressed one.
+*/
+func (r *Rest) Static(urlPath, dir string) error {
+	prefixes := r.Prefixes()
+	formatter := pathToFormatter(prefixes[0], strings.TrimSuffix(urlPath, "/")+"/*file")
+	node := &staticNode{
+		name_: "Static " + urlPath,
+		root:  http.Dir(dir),
+	}
+	for _, prefix := range prefixes {
+		rt, err := newRoute("GET", changePrefix(formatter, prefixes[0], prefix), node.name_, node, "")
+		if err != nil {
+			return err
+		}
+		rt.funcName = node.name_
+		if err := r.addRoute(rt, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type staticNode struct {
+	name_ string
+	root  http.FileSystem
+}
+
+func (n *staticNode) name() string {
+	return n.name_
+}
+
+func (n *staticNode) handle(instance reflect.Value, ctx *context) {
+	name := path.Clean("/" + ctx.vars["file"])
+	f, info, err := n.open(name)
+	if err != nil {
+		http.NotFound(contentWriter{ctx}, ctx.request)
+		return
+	}
+	defer f.Close()
+
+	if ctx.Header().Get("Content-Type") == ctx.contentType() {
+		ctx.Header().Del("Content-Type")
+	}
+	// response varies with Accept-Encoding whether it's precompressed or not.
+	ctx.Header().Add("Vary", "Accept-Encoding")
+	if ctx.gzipOK {
+		if gz, gzInfo, err := n.open(name + ".gz"); err == nil {
+			defer gz.Close()
+			contentType := mime.TypeByExtension(path.Ext(name))
+			if contentType == "" {
+				contentType = "application/octet-stream"
+			}
+			ctx.compresser = nil
+			ctx.Header().Set("Content-Type", contentType)
+			ctx.Header().Set("Content-Encoding", "gzip")
+			http.ServeContent(contentWriter{ctx}, ctx.request, name, gzInfo.ModTime(), gz)
+			return
+		}
+	}
+
+	if c := compressResponse(ctx); c != nil {
+		defer c.Close()
+	}
+	ctx.contentName, ctx.contentModTime = name, info.ModTime()
+	serveContent(ctx, f)
+}
+
+// open opens regular file of name in root.
+func (n *staticNode) open(name string) (http.File, os.FileInfo, error) {
+	f, err := n.root.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		f.Close()
+		return nil, nil, errors.New(name + " isn't a regular file")
+	}
+	return f, info, nil
+}
+
+// acceptsGzip returns whether Accept-Encoding of r accepts gzip.
+func acceptsGzip(r *http.Request) bool {
+	return inList(acceptedValues(r.Header.Get("Accept-Encoding")), "gzip")
+}
@@ -0,0 +1,126 @@
+package rest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type TestStatic struct {
+	Service `prefix:"/prefix" compress:"on"`
+}
+
+func TestRestStatic(t *testing.T) {
+	type Test struct {
+		url      string
+		encoding string
+
+		code            int
+		contentType     string
+		contentEncoding string
+		body            string
+	}
+	dir, err := ioutil.TempDir("", "static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte("body{}"))
+	w.Close()
+	files := map[string][]byte{
+		"app.css":       []byte("body{}"),
+		"app.css.gz":    gz.Bytes(),
+		"plain.txt":     []byte("plain"),
+		"sub/index.txt": []byte("index"),
+	}
+	for name, content := range files {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var tests = []Test{
+		{"http://domain/prefix/assets/app.css", "gzip", http.StatusOK, "text/css; charset=utf-8", "gzip", gz.String()},
+		{"http://domain/prefix/assets/app.css", "deflate, gzip", http.StatusOK, "text/css; charset=utf-8", "gzip", gz.String()},
+		{"http://domain/prefix/assets/app.css", "", http.StatusOK, "text/css; charset=utf-8", "", "body{}"},
+		{"http://domain/prefix/assets/app.css", "gzip;q=0", http.StatusOK, "text/css; charset=utf-8", "", "body{}"},
+		{"http://domain/prefix/assets/plain.txt", "gzip", http.StatusOK, "text/plain; charset=utf-8", "gzip", "plain"},
+		{"http://domain/prefix/assets/plain.txt", "", http.StatusOK, "text/plain; charset=utf-8", "", "plain"},
+		{"http://domain/prefix/assets/sub/index.txt", "", http.StatusOK, "text/plain; charset=utf-8", "", "index"},
+		{"http://domain/prefix/assets/sub", "", http.StatusNotFound, "text/plain; charset=utf-8", "", "404 page not found\n"},
+		{"http://domain/prefix/assets/missing.txt", "", http.StatusNotFound, "text/plain; charset=utf-8", "", "404 page not found\n"},
+	}
+	rest, err := New(new(TestStatic))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rest.Static("/assets/", dir); err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.encoding != "" {
+			req.Header.Set("Accept-Encoding", test.encoding)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Header().Get("Content-Type"), test.contentType, "test %d", i)
+		equal(t, w.Header().Get("Content-Encoding"), test.contentEncoding, "test %d", i)
+		if test.code == http.StatusOK {
+			equal(t, w.Header()["Vary"], []string{"Accept-Encoding"}, "test %d", i)
+		}
+		body := w.Body.String()
+		if test.contentEncoding == "gzip" && test.body != gz.String() {
+			r, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := ioutil.ReadAll(r)
+			body = string(b)
+		}
+		equal(t, body, test.body, "test %d", i)
+	}
+
+	// router without compression serves precompressed file, but doesn't compress others.
+	router := NewRouter("/")
+	if err := router.Static("/assets", dir); err != nil {
+		t.Fatal(err)
+	}
+	tests = []Test{
+		{"http://domain/assets/app.css", "gzip", http.StatusOK, "text/css; charset=utf-8", "gzip", gz.String()},
+		{"http://domain/assets/app.css", "", http.StatusOK, "text/css; charset=utf-8", "", "body{}"},
+		{"http://domain/assets/plain.txt", "gzip", http.StatusOK, "text/plain; charset=utf-8", "", "plain"},
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.encoding != "" {
+			req.Header.Set("Accept-Encoding", test.encoding)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		equal(t, resp.Code, test.code, "test %d", i)
+		equal(t, resp.Header().Get("Content-Type"), test.contentType, "test %d", i)
+		equal(t, resp.Header().Get("Content-Encoding"), test.contentEncoding, "test %d", i)
+		equal(t, resp.Header()["Vary"], []string{"Accept-Encoding"}, "test %d", i)
+		equal(t, resp.Body.String(), test.body, "test %d", i)
+	}
+	equal(t, router.Routes()[0].Kind, "static")
+}
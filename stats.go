@@ -0,0 +1,184 @@
+package rest
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// RequestStats is the statistics of a request, got by Service.Stats. It's useful in AfterRequest hook
+// for metrics or billing.
+type RequestStats struct {
+	// BytesRead is the number of bytes read from request body.
+	BytesRead int64
+	// BytesWritten is the number of bytes written to response body, after compression. Header isn't
+	// counted. For streaming, it's counted until the connection is closed.
+	BytesWritten int64
+	// Duration is the time elapsed since request arrived.
+	Duration time.Duration
+	// ErrorCategory tells where the error of request comes from, so metrics can separate malformed
+	// requests from errors of business logic. It's "" if request has no error.
+	ErrorCategory ErrorCategory
+}
+
+// ErrorCategory is the source of error replied to request, see RequestStats.
+type ErrorCategory string
+
+const (
+	// CategoryDecode is error of reading request, like invalid path parameter or malformed body.
+	CategoryDecode ErrorCategory = "decode"
+	// CategoryEncode is error of marshalling response.
+	CategoryEncode ErrorCategory = "encode"
+	// CategoryHandler is error returned or replied by handler or hooks, or 4xx and 5xx status written
+	// by them.
+	CategoryHandler ErrorCategory = "handler"
+	// CategoryConflict is error of request conflicting with another one, like a request with the same
+	// idempotency key in progress, which client can retry later.
+	CategoryConflict ErrorCategory = "conflict"
+	// CategoryServer is error of serving request besides handler, like handler timeout, or webserver
+	// not supporting flushing.
+	CategoryServer ErrorCategory = "server"
+)
+
+// Stats returns the statistics of request so far. Called in AfterRequest, it covers the whole request.
+func (c *context) Stats() RequestStats {
+	return RequestStats{
+		BytesRead:     c.bytesRead,
+		BytesWritten:  atomic.LoadInt64(&c.bytesWritten),
+		Duration:      time.Since(c.start),
+		ErrorCategory: c.errorCategory(),
+	}
+}
+
+// errorCategory returns the category of error of request, which is CategoryHandler if it's not set
+// where error is replied.
+func (c *context) errorCategory() ErrorCategory {
+	if c.category == "" && c.result() != nil {
+		return CategoryHandler
+	}
+	return c.category
+}
+
+// count starts counting bytes of request body and response body of c, and the duration since start.
+func (c *context) count(start time.Time) {
+	c.start = start
+	if c.request.Body != nil {
+		c.request.Body = &countReader{c.request.Body, &c.bytesRead}
+	}
+	c.responseWriter = &countResponseWriter{c.responseWriter, c}
+}
+
+// countReader counts bytes read from ReadCloser to n.
+type countReader struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (r *countReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	*r.n += int64(n)
+	return n, err
+}
+
+// countWriter counts bytes written to Writer to n atomically, since stream queue writes in background.
+type countWriter struct {
+	io.Writer
+	n *int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	atomic.AddInt64(w.n, int64(n))
+	return n, err
+}
+
+// countResponseWriter counts bytes written to ResponseWriter, and records the status written, to ctx.
+// If status isn't written before body, it writes the one set by Service.SetStatus. It keeps flushing and
+// hijacking of ResponseWriter working.
+type countResponseWriter struct {
+	http.ResponseWriter
+	ctx *context
+}
+
+func (w *countResponseWriter) WriteHeader(code int) {
+	if w.ctx.written == 0 && code >= 200 {
+		w.ctx.written = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *countResponseWriter) Write(p []byte) (int, error) {
+	if w.ctx.written == 0 {
+		if code := w.ctx.pendingStatus; code != 0 {
+			w.WriteHeader(code)
+		} else {
+			w.ctx.written = http.StatusOK
+		}
+	}
+	n, err := w.ResponseWriter.Write(p)
+	atomic.AddInt64(&w.ctx.bytesWritten, int64(n))
+	return n, err
+}
+
+func (w *countResponseWriter) Flush() {
+	if f := findFlusher(w.ResponseWriter); f != nil {
+		f.Flush()
+	}
+}
+
+func (w *countResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj := findHijacker(w.ResponseWriter)
+	if hj == nil {
+		return nil, nil, errors.New("webserver doesn't support hijacking")
+	}
+	return hj.Hijack()
+}
+
+// Unwrap returns the wrapped ResponseWriter, for http.ResponseController.
+func (w *countResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// tapResponseWriter records the status written to ResponseWriter for Rest.Tap. It keeps flushing and
+// hijacking of ResponseWriter working.
+type tapResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *tapResponseWriter) WriteHeader(code int) {
+	if w.status == 0 && code >= 200 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *tapResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *tapResponseWriter) Flush() {
+	if f := findFlusher(w.ResponseWriter); f != nil {
+		f.Flush()
+	}
+}
+
+func (w *tapResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj := findHijacker(w.ResponseWriter)
+	if hj == nil {
+		return nil, nil, errors.New("webserver doesn't support hijacking")
+	}
+	return hj.Hijack()
+}
+
+// Unwrap returns the wrapped ResponseWriter, for http.ResponseController.
+func (w *tapResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,168 @@
+package rest
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type TestStats struct {
+	Service
+
+	Echo   Processor `method:"POST" path:"/echo"`
+	Watch  Streaming `method:"GET" path:"/watch"`
+	Queued Streaming `method:"GET" path:"/queued" queue:"10"`
+
+	stats chan RequestStats
+}
+
+func (r TestStats) HandleEcho(s string) string {
+	return s
+}
+
+func (r TestStats) HandleWatch(s Stream) {
+	s.Write("hello")
+	s.Write("world")
+}
+
+func (r TestStats) HandleQueued(s Stream) {
+	s.Write("hello")
+	r.Stats()
+	s.Write("world")
+	r.Stats()
+}
+
+func (r TestStats) AfterRequest(s Service, err error) {
+	r.stats <- s.Stats()
+}
+
+func TestServiceStats(t *testing.T) {
+	instance := &TestStats{
+		stats: make(chan RequestStats, 1),
+	}
+	rest, err := New(instance)
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+
+	req, err := http.NewRequest("POST", "http://domain/echo", bytes.NewBufferString("\"hello\""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	rest.ServeHTTP(w, req)
+	equal(t, w.Body.String(), "\"hello\"\n")
+	stats := <-instance.stats
+	equal(t, stats.BytesRead, int64(7))
+	equal(t, stats.BytesWritten, int64(8))
+	equal(t, stats.Duration > 0, true)
+
+	server := httptest.NewServer(rest)
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, string(body), "\"hello\"\n\"world\"\n")
+	stats = <-instance.stats
+	equal(t, stats.BytesRead, int64(0))
+	equal(t, stats.BytesWritten, int64(16))
+
+	resp, err = http.Get(server.URL + "/queued")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, string(body), "\"hello\"\n\"world\"\n")
+	stats = <-instance.stats
+	equal(t, stats.BytesWritten, int64(16))
+}
+
+type TestErrorCategory struct {
+	Service
+
+	Echo   Processor `method:"POST" path:"/echo"`
+	Item   Processor `method:"GET" path:"/item/:id" args:"id"`
+	Fail   Processor `method:"GET" path:"/fail"`
+	Status Processor `method:"GET" path:"/status"`
+	Encode Processor `method:"GET" path:"/encode"`
+
+	stats chan RequestStats
+}
+
+type unmarshalable struct {
+	C chan int
+}
+
+func (r TestErrorCategory) HandleEcho(s string) string {
+	return s
+}
+
+func (r TestErrorCategory) HandleItem(id int) int {
+	return id
+}
+
+func (r TestErrorCategory) HandleFail() error {
+	return errors.New("invalid item")
+}
+
+func (r TestErrorCategory) HandleStatus() {
+	r.WriteHeader(http.StatusNotFound)
+}
+
+func (r TestErrorCategory) HandleEncode() unmarshalable {
+	return unmarshalable{}
+}
+
+func (r TestErrorCategory) AfterRequest(s Service, err error) {
+	r.stats <- s.Stats()
+}
+
+func TestServiceStatsErrorCategory(t *testing.T) {
+	type Test struct {
+		method string
+		url    string
+		body   string
+
+		code     int
+		category ErrorCategory
+	}
+	var tests = []Test{
+		{"POST", "http://domain/echo", "\"hello\"", http.StatusOK, ""},
+		{"POST", "http://domain/echo", "{", http.StatusBadRequest, CategoryDecode},
+		{"GET", "http://domain/item/abc", "", http.StatusBadRequest, CategoryDecode},
+		{"GET", "http://domain/fail", "", http.StatusInternalServerError, CategoryHandler},
+		{"GET", "http://domain/status", "", http.StatusNotFound, CategoryHandler},
+		{"GET", "http://domain/encode", "", http.StatusInternalServerError, CategoryEncode},
+	}
+	instance := &TestErrorCategory{
+		stats: make(chan RequestStats, 1),
+	}
+	rest, err := New(instance)
+	if err != nil {
+		t.Fatalf("new rest service failed: %s", err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest(test.method, test.url, bytes.NewBufferString(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		stats := <-instance.stats
+		equal(t, stats.ErrorCategory, test.category, "test %d", i)
+	}
+}
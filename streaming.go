@@ -1,10 +1,15 @@
 package rest
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,40 +17,254 @@ import (
 Stream  wrap the connection when using streaming.
 */
 type Stream struct {
-	ctx        *context
-	conn       net.Conn
-	end        string
-	marshaller Marshaller
+	ctx       *context
+	conn      net.Conn
+	end       string
+	framing   string
+	queue     *streamQueue
+	buffer    *streamBuffer
+	wrap      bool
+	transform bool
+	nextID    func() string
+	separator *string
+	written   *int64
 }
 
-func newStream(ctx *context, conn net.Conn, end string) (*Stream, error) {
-	marshaller, ok := getMarshaller(ctx.mime)
-	if !ok {
+// streamBuffer is shared by copies of Stream, so buffered frames can be flushed after handler returns.
+type streamBuffer struct {
+	bytes.Buffer
+	size int
+}
+
+type streamEnvelope struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+func newStream(ctx *context, conn net.Conn, end, framing string) (*Stream, error) {
+	if _, ok := getMarshaller(ctx.mime); !ok {
 		return nil, errors.New("can't find marshaller for" + ctx.mime)
 	}
 	return &Stream{
-		ctx:        ctx,
-		conn:       conn,
-		end:        end,
-		marshaller: marshaller,
+		ctx:     ctx,
+		conn:    conn,
+		end:     end,
+		framing: framing,
+		buffer:  new(streamBuffer),
+		written: new(int64),
 	}, nil
 }
 
-// Write data i as a frame to the connection.
+// marshal marshals i to w with the marshaller of mime negotiated with client.
+func (s *Stream) marshal(w io.Writer, i interface{}) error {
+	marshaller, ok := getMarshaller(s.ctx.mime)
+	if !ok {
+		return errors.New("can't find marshaller for" + s.ctx.mime)
+	}
+	return marshaller.Marshal(w, s.ctx.name, i)
+}
+
+// Write data i as a frame to the connection. Data is marshalled with the mime negotiated by Accept
+// header of request.
 func (s *Stream) Write(i interface{}) error {
-	err := s.marshaller.Marshal(s.ctx.responseWriter, s.ctx.name, i)
+	i = s.wrapFrame(i)
+	if s.framing == "sse" {
+		return s.writeEvent("", i)
+	}
+	return s.writeFrame(i)
+}
+
+// wrapFrame transforms i with Rest.ResponseTransform if streaming has tag transform:"on", then wraps
+// it with Rest.ResponseWrapper if streaming has tag wrap:"on".
+func (s *Stream) wrapFrame(i interface{}) interface{} {
+	if s.transform && s.ctx.transform != nil {
+		i = s.ctx.transform(i, Service{s.ctx})
+	}
+	if s.wrap && s.ctx.wrapper != nil {
+		i = s.ctx.wrapper(i, Service{s.ctx})
+	}
+	return i
+}
+
+func (s *Stream) writeFrame(i interface{}) error {
+	buf := bytes.NewBuffer(nil)
+	err := s.marshal(buf, i)
 	if err != nil {
 		return err
 	}
-	if len(s.end) > 0 {
-		_, err = s.ctx.responseWriter.Write([]byte(s.end))
-		if err != nil {
-			return err
-		}
+	if s.separator == nil {
+		buf.WriteString(s.end)
+		return s.send(buf.Bytes())
 	}
+	b := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	return s.send(append(b, *s.separator...))
+}
+
+// SetSeparator sets the terminator of each frame written by Write or WriteTyped, like "\x00" or "\x1e",
+// instead of the newline added by marshaller and end tag. Empty sep is invalid, use RemoveSeparator
+// to send frames without terminator. It's ignored with "sse" framing.
+func (s *Stream) SetSeparator(sep string) error {
+	if sep == "" {
+		return errors.New("empty separator, use RemoveSeparator to send frames without separator")
+	}
+	s.separator = &sep
 	return nil
 }
 
+// RemoveSeparator makes frames sent without terminator, removing the newline added by marshaller and
+// end tag. It's ignored with "sse" framing.
+func (s *Stream) RemoveSeparator() {
+	sep := ""
+	s.separator = &sep
+}
+
+// WriteTyped writes data i as a frame with eventType, so consumers can discriminate different types
+// in one stream. With "sse" framing, eventType is sent as event field, with CR and LF removed so it
+// can't inject other fields or events. Otherwise the frame is an envelope like
+// {"type": eventType, "data": i}.
+func (s *Stream) WriteTyped(eventType string, i interface{}) error {
+	i = s.wrapFrame(i)
+	if s.framing == "sse" {
+		return s.writeEvent(eventType, i)
+	}
+	return s.writeFrame(streamEnvelope{eventType, i})
+}
+
+/*
+WriteError writes err as an error frame, so consumers can detect failure in the middle of stream. Status
+of response is sent before the first frame and can't be changed by then, so errors after streaming
+begins can only be reported in frames.
+
+The frame is like WriteTyped with event type "error", and data is the same as error response of
+Service.Error: err itself if it has exported fields, otherwise an error built by the marshaller from
+err.Error(), like {"code": -1, "message": "..."} of json. With "sse" framing it's:
+
+	event: error
+	data: {"code":-1,"message":"..."}
+
+Otherwise it's an envelope:
+
+	{"type":"error","data":{"code":-1,"message":"..."}}
+
+Error frame isn't transformed or wrapped.
+*/
+func (s *Stream) WriteError(err error) error {
+	marshaller, ok := getMarshaller(s.ctx.mime)
+	if !ok {
+		return errors.New("can't find marshaller for" + s.ctx.mime)
+	}
+	var data interface{} = err
+	if !hasExportField(err) {
+		data = marshaller.Error(-1, err.Error())
+	}
+	if s.framing == "sse" {
+		return s.writeEvent("error", data)
+	}
+	return s.writeFrame(streamEnvelope{"error", data})
+}
+
+func (s *Stream) writeEvent(event string, i interface{}) error {
+	buf := bytes.NewBuffer(nil)
+	if event != "" {
+		buf.WriteString("event: " + lineBreaks.Replace(event) + "\n")
+	}
+	if s.nextID != nil {
+		buf.WriteString("id: " + lineBreaks.Replace(s.nextID()) + "\n")
+	}
+	data := bytes.NewBuffer(nil)
+	err := s.marshal(data, i)
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(strings.TrimRight(data.String(), "\n"), "\n") {
+		buf.WriteString("data: " + line + "\n")
+	}
+	buf.WriteString("\n")
+	return s.send(buf.Bytes())
+}
+
+/*
+SetIDGenerator makes each event sent with "sse" framing have id field generated by next, so client
+reconnecting sends the id of last received event in Last-Event-ID header, which is got by
+Service.LastEventID. Handler can resume from there, like:
+
+	func (r MyService) HandleWatch(s rest.Stream) {
+		seq, _ := strconv.Atoi(r.LastEventID())
+		s.SetIDGenerator(func() string {
+			seq++
+			return strconv.Itoa(seq)
+		})
+		for _, post := range r.postsAfter(seq) {
+			s.Write(post)
+		}
+		...
+	}
+
+Line breaks in id are removed. Without "sse" framing, it does nothing.
+*/
+func (s *Stream) SetIDGenerator(next func() string) {
+	s.nextID = next
+}
+
+var lineBreaks = strings.NewReplacer("\r", "", "\n", "")
+
+// SetBufferSize sets the size of write buffer. Frames are coalesced in buffer until it reaches n bytes
+// or Flush is called, then sent as one chunk. Buffered frames are flushed when handler returns.
+// n <= 0 disables buffering, which is the default.
+func (s *Stream) SetBufferSize(n int) {
+	s.buffer.size = n
+}
+
+// Flush sends buffered frames to the connection.
+func (s *Stream) Flush() error {
+	if s.buffer.Len() == 0 {
+		return nil
+	}
+	b := append([]byte(nil), s.buffer.Bytes()...)
+	s.buffer.Reset()
+	return s.write(b)
+}
+
+// send writes frame b to the connection, or buffers it if stream has buffer size.
+func (s *Stream) send(b []byte) error {
+	if s.buffer.size <= 0 && s.buffer.Len() == 0 {
+		return s.write(b)
+	}
+	s.buffer.Write(b)
+	if s.buffer.Len() < s.buffer.size {
+		return nil
+	}
+	return s.Flush()
+}
+
+// write writes b to the connection, or puts it to the send queue if stream has one.
+func (s *Stream) write(b []byte) error {
+	if s.queue != nil {
+		return s.queue.push(b)
+	}
+	n, err := s.ctx.responseWriter.Write(b)
+	atomic.AddInt64(s.written, int64(n))
+	return err
+}
+
+// BytesWritten returns the number of bytes written to the connection by the stream so far, which is
+// safe to call from other goroutines. Frames still in buffer or send queue, or dropped, aren't counted.
+// It counts bytes before compression, without headers. See Service.Stats for bytes on the wire.
+func (s *Stream) BytesWritten() int64 {
+	if s.queue != nil {
+		return s.queue.written()
+	}
+	return atomic.LoadInt64(s.written)
+}
+
+// Dropped returns the number of frames dropped by send queue because the consumer is too slow.
+func (s *Stream) Dropped() int64 {
+	if s.queue == nil {
+		return 0
+	}
+	return s.queue.dropped()
+}
+
 // Check connection is still alive.
 func (s *Stream) Ping() error {
 	s.conn.SetReadDeadline(time.Now().Add(time.Second / 10))
@@ -72,15 +291,55 @@ The streaming's handle function may take 1 or 2 input parameters and no return:
  - func Handler(s rest.Stream) or
  - func Handler(s rest.Stream, post PostType)
 
-First parameter Stream is use for sending data when connecting.
+Like processor, if path has parameters and the leading input parameters before Stream, as many as path
+parameters, are all of kind string or int, they capture path parameters by order, and PostType may bind
+its fields from path, query and header. Service.Vars() still works. Tag args names the path parameter
+each leading parameter captures instead. See Processor:
+
+ - func Handler(to string, s rest.Stream) // path is "/hello/:to/streaming"
+ - func Handler(s rest.Stream, arg WatchArg) // WatchArg has field with tag path:"to"
+
+Path parameter or bound value which can't convert gets 400 Bad Request.
+
+First parameter Stream is use for sending data when connecting. The response is sent with
+Transfer-Encoding chunked, and each write of Stream is a chunk. Use Stream.SetBufferSize to coalesce
+small frames into larger chunks. The connection is hijacked, so ResponseWriter must implement
+http.Hijacker, found through middleware wrappers with method Unwrap() http.ResponseWriter, otherwise
+request gets 500 Internal Server Error.
 
 Valid tag:
 
- - method: Define the method of http request.
- - path: Define the path of http request.
+ - method: Define the method of http request. "*" or "ANY" matches request of any method which isn't
+   matched by routes of its own method.
+ - path: Define the path of http request. Empty path or "/" is the root of service prefix, which
+   matches both "/prefix" and "/prefix/" unless the other one has its own route.
+   A parameter may be followed by the set of values it accepts, like "/sort/:order{asc|desc}", then
+   request with other values doesn't match the node and gets 404 Not Found.
+   A segment may be a regexp in parentheses, like "/user/:id/posts/([0-9]+)", which matches the whole
+   segment. It's an anonymous parameter named by its position among parameters of path, from 1, so
+   Service.Vars of above has keys "id" and "2", and handler parameters capture them in path order.
+ - enabled: If value is "false", the node isn't registered. See NewFiltered.
+ - host: Pattern of request host, like host:"admin.*" where "*" matches any characters, so nodes of
+   the same method and path can serve different hosts. Nodes with host are tried before the ones without
+   it, and patterns are tried in order of declaration. Empty means any host, or the host of service.
+   Request host is set by client, so don't use host to restrict access, like hiding admin nodes; check
+   credentials in handler or middleware.
+ - meta: Semicolon separated key=value pairs, like "scope=admin;audit=true", for hooks to read by
+   Service.RouteMeta, like the scope required by the route.
  - func: Define the get-identity function, which signature like func() string.
+ - args: Comma separated path parameters captured by leading input parameters, in order. See Processor.
  - mime: Define the default mime of request's and response's body. It overwrite the service one.
+ - consumes: Comma separated list of request content types accepted. Other types get 415 Unsupported Media Type.
+ - produces: Comma separated list of response mimes. If negotiated mime isn't in list, the first one is used.
  - end: Define the end of one data when streaming working.
+ - queue: Define the size of send queue. If set, frames are sent in background, so a slow consumer doesn't
+   block the handler. Write only returns error of previous frames.
+ - policy: Define what to do when send queue is full. "block" waits for space, "drop-newest" drops the frame
+   being written, and "drop-oldest" drops the oldest frame in queue. Default is "block".
+ - framing: If value is "sse", data is sent as Server-Sent Events with content type text/event-stream, and
+   end is ignored. Otherwise data is sent as marshalled, following by end.
+ - wrap: If value is "on", each frame is wrapped by Rest.ResponseWrapper before marshalling.
+ - transform: If value is "on", each frame is transformed by Rest.ResponseTransform before wrapping.
 */
 type Streaming struct {
 	pathFormatter
@@ -91,9 +350,9 @@ func (p *Streaming) init(formatter pathFormatter, instance reflect.Type, name st
 	if fname == "" {
 		fname = "Handle" + name
 	}
-	f, ok := instance.MethodByName(fname)
-	if !ok {
-		return nil, nil, fmt.Errorf("can't find handler: %s", fname)
+	f, err := findHandler(instance, name, fname)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	ft := f.Type
@@ -101,21 +360,68 @@ func (p *Streaming) init(formatter pathFormatter, instance reflect.Type, name st
 		findex: f.Index,
 		name_:  name,
 	}
-	if ft.NumIn() > 3 || ft.NumIn() < 2 {
+	args := tag.Get("args")
+	names, err := argNames(formatter, args)
+	if err != nil {
+		return nil, nil, fmt.Errorf("streaming(%s) %s", name, err)
+	}
+	if len(names) > 0 && ft.NumIn() > len(names)+1 && ft.In(len(names)+1).String() == "rest.Stream" {
+		var types []reflect.Type
+		for i := range names {
+			if t := ft.In(1 + i); isPathKind(t.Kind()) {
+				types = append(types, t)
+			}
+		}
+		if len(types) == len(names) {
+			ret.pathNames, ret.pathTypes = names, types
+		}
+	}
+	if args != "" && len(ret.pathTypes) == 0 {
+		return nil, nil, fmt.Errorf("streaming(%s) leading %d input parameters should be of kind string or int to capture args %s", name, len(names), args)
+	}
+	offset := 1 + len(ret.pathTypes)
+	if ft.NumIn() > offset+2 || ft.NumIn() < offset+1 {
+		if len(ret.pathTypes) > 0 {
+			return nil, nil, fmt.Errorf("streaming(%s) input parameters should be 1 or 2 besides path parameters.", ft.Name())
+		}
 		return nil, nil, fmt.Errorf("streaming(%s) input parameters should be 1 or 2.", ft.Name())
 	}
-	if ft.In(1).String() != "rest.Stream" {
+	if ft.In(offset).String() != "rest.Stream" {
 		return nil, nil, fmt.Errorf("streaming(%s) first input parameters should be rest.Stream", ft.Name())
 	}
-	if ft.NumIn() == 3 {
-		ret.requestType = ft.In(2)
+	if ft.NumIn() == offset+2 {
+		ret.requestType = ft.In(offset + 1)
+		bindings, err := newBindings(ret.requestType, append(formatter.prefixParams(), names...), name)
+		if err != nil {
+			return nil, nil, err
+		}
+		ret.bindings = bindings
 	}
 
 	if ft.NumOut() > 0 {
 		return nil, nil, fmt.Errorf("streaming(%s) return should no return.", ft.Name())
 	}
 
+	if queue := tag.Get("queue"); queue != "" {
+		size, err := strconv.Atoi(queue)
+		if err != nil || size <= 0 {
+			return nil, nil, fmt.Errorf("streaming(%s) queue should be a positive integer: %s", name, queue)
+		}
+		ret.queue = size
+	}
+	ret.policy = tag.Get("policy")
+	switch ret.policy {
+	case "":
+		ret.policy = "block"
+	case "block", "drop-newest", "drop-oldest":
+	default:
+		return nil, nil, fmt.Errorf("streaming(%s) invalid queue policy: %s", name, ret.policy)
+	}
+
+	ret.wrap = tag.Get("wrap") == "on"
+	ret.transform = tag.Get("transform") == "on"
 	ret.end = tag.Get("end")
+	ret.framing = tag.Get("framing")
 	p.pathFormatter = formatter
 
 	return []handler{ret}, []pathFormatter{formatter}, nil
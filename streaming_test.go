@@ -1,8 +1,14 @@
 package rest
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -33,6 +39,17 @@ func (f FakeStreaming) ErrorMore(s Stream, input string, other int) {}
 
 func (f FakeStreaming) ErrorReturn(s Stream) string { return "" }
 
+func (f FakeStreaming) PathArgs(id UserID, s Stream, input string) {}
+
+type WatchArg struct {
+	To    string `path:"to"`
+	Since int    `query:"since"`
+}
+
+func (f FakeStreaming) Bound(s Stream, arg WatchArg) {}
+
+func (f FakeStreaming) ErrorBound(s Stream, arg WatchArg) {}
+
 func TestStreamingInit(t *testing.T) {
 	type Test struct {
 		path pathFormatter
@@ -75,6 +92,14 @@ func TestStreamingInit(t *testing.T) {
 	if !ok {
 		t.Fatal("no ErrorReturn")
 	}
+	pa, ok := instanceType.MethodByName("PathArgs")
+	if !ok {
+		t.Fatal("no PathArgs")
+	}
+	b, ok := instanceType.MethodByName("Bound")
+	if !ok {
+		t.Fatal("no Bound")
+	}
 	var tests = []Test{
 		{"/", "", `end:"\n" func:"NoInput"`, true, ni.Index, "<nil>", "\n"},
 		{"/", "", `func:"Input"`, true, i.Index, "string", ""},
@@ -83,6 +108,14 @@ func TestStreamingInit(t *testing.T) {
 		{"/", "", `func:"ErrorStream"`, false, es.Index, "", ""},
 		{"/", "", `func:"ErrorMore"`, false, em.Index, "", ""},
 		{"/", "", `func:"ErrorReturn"`, false, er.Index, "", ""},
+		{"/:id", "", `func:"PathArgs"`, true, pa.Index, "string", ""},
+		{"/", "", `func:"PathArgs"`, false, pa.Index, "", ""},
+		{"/:to", "", `func:"Bound"`, true, b.Index, "rest.WatchArg", ""},
+		{"/", "", `func:"ErrorBound"`, false, b.Index, "", ""},
+		{"/:to", "", `func:"NoInput"`, true, ni.Index, "<nil>", ""},
+		{"/", "", `func:"NoInput" queue:"10" policy:"drop-oldest"`, true, ni.Index, "<nil>", ""},
+		{"/", "", `func:"NoInput" queue:"abc"`, false, ni.Index, "", ""},
+		{"/", "", `func:"NoInput" queue:"10" policy:"unknown"`, false, ni.Index, "", ""},
 	}
 	for i, test := range tests {
 		streaming := new(Streaming)
@@ -105,3 +138,328 @@ func TestStreamingInit(t *testing.T) {
 		equal(t, sn.end, test.end, fmt.Sprintf("test %d", i))
 	}
 }
+
+func TestStreamWriteTyped(t *testing.T) {
+	type Test struct {
+		framing string
+		end     string
+		event   string
+		data    interface{}
+
+		output string
+	}
+	var tests = []Test{
+		{"", "\n", "", "hello", "\"hello\"\n\n"},
+		{"", "\n", "post", "hello", "{\"type\":\"post\",\"data\":\"hello\"}\n\n"},
+		{"sse", "\n", "", "hello", "data: \"hello\"\n\n"},
+		{"sse", "", "post", map[string]int{"a": 1}, "event: post\ndata: {\"a\":1}\n\n"},
+		{"sse", "", "post\r\ndata: forged\n\nevent: x", "hello", "event: postdata: forgedevent: x\ndata: \"hello\"\n\n"},
+	}
+	for i, test := range tests {
+		w := httptest.NewRecorder()
+		ctx, err := newContext(w, new(http.Request), nil, "application/json", "utf-8")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := newStream(ctx, nil, test.end, test.framing)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.event == "" {
+			err = s.Write(test.data)
+		} else {
+			err = s.WriteTyped(test.event, test.data)
+		}
+		equal(t, err, nil, "test %d", i)
+		equal(t, w.Body.String(), test.output, "test %d", i)
+	}
+}
+
+func TestStreamWriteError(t *testing.T) {
+	type Test struct {
+		framing string
+		err     error
+
+		output string
+	}
+	var tests = []Test{
+		{"", errors.New("db down"), "{\"type\":\"error\",\"data\":{\"code\":-1,\"message\":\"db down\"}}\n\n"},
+		{"", jsonError{Code: 3, Message: "quota"}, "{\"type\":\"error\",\"data\":{\"code\":3,\"message\":\"quota\"}}\n\n"},
+		{"sse", errors.New("db down"), "event: error\ndata: {\"code\":-1,\"message\":\"db down\"}\n\n"},
+	}
+	for i, test := range tests {
+		w := httptest.NewRecorder()
+		ctx, err := newContext(w, new(http.Request), nil, "application/json", "utf-8")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx.wrapper = func(v interface{}, s Service) interface{} { return "wrapped" }
+		s, err := newStream(ctx, nil, "\n", test.framing)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.wrap = true
+		equal(t, s.WriteError(test.err), nil, "test %d", i)
+		equal(t, w.Body.String(), test.output, "test %d", i)
+	}
+}
+
+func TestStreamSetIDGenerator(t *testing.T) {
+	type Test struct {
+		framing string
+		event   string
+
+		output string
+	}
+	var tests = []Test{
+		{"sse", "", "id: 1\ndata: \"a\"\n\nid: 2\ndata: \"b\"\n\n"},
+		{"sse", "post", "event: post\nid: 1\ndata: \"a\"\n\nevent: post\nid: 2\ndata: \"b\"\n\n"},
+		{"", "", "\"a\"\n\"b\"\n"},
+	}
+	for i, test := range tests {
+		w := httptest.NewRecorder()
+		ctx, err := newContext(w, new(http.Request), nil, "application/json", "utf-8")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := newStream(ctx, nil, "", test.framing)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seq := 0
+		s.SetIDGenerator(func() string {
+			seq++
+			return fmt.Sprintf("%d\n", seq)
+		})
+		for _, data := range []string{"a", "b"} {
+			if test.event == "" {
+				err = s.Write(data)
+			} else {
+				err = s.WriteTyped(test.event, data)
+			}
+			equal(t, err, nil, "test %d", i)
+		}
+		equal(t, w.Body.String(), test.output, "test %d", i)
+	}
+}
+
+func TestStreamSetSeparator(t *testing.T) {
+	type Test struct {
+		end       string
+		separator string
+		remove    bool
+
+		err    bool
+		output string
+	}
+	var tests = []Test{
+		{"", "", false, false, "\"a\"\n\"b\"\n"},
+		{"\r", "", false, false, "\"a\"\n\r\"b\"\n\r"},
+		{"\r", "\x00", false, false, "\"a\"\x00\"b\"\x00"},
+		{"", "\x1e\n", false, false, "\"a\"\x1e\n\"b\"\x1e\n"},
+		{"\r", "", true, false, "\"a\"\"b\""},
+		{"", "", false, true, "\"a\"\n\"b\"\n"},
+	}
+	for i, test := range tests {
+		w := httptest.NewRecorder()
+		ctx, err := newContext(w, new(http.Request), nil, "application/json", "utf-8")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := newStream(ctx, nil, test.end, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.remove {
+			s.RemoveSeparator()
+		} else if test.separator != "" || test.err {
+			equal(t, s.SetSeparator(test.separator) != nil, test.err, "test %d", i)
+		}
+		equal(t, s.Write("a"), nil, "test %d", i)
+		equal(t, s.Write("b"), nil, "test %d", i)
+		equal(t, w.Body.String(), test.output, "test %d", i)
+	}
+}
+
+func TestStreamBuffer(t *testing.T) {
+	type Test struct {
+		size  int
+		data  interface{}
+		flush bool
+
+		output string
+	}
+	var tests = []Test{
+		{10, 1, false, ""},
+		{10, 22, false, ""},
+		{10, 4444, false, "1\n22\n4444\n"},
+		{10, 5, false, "1\n22\n4444\n"},
+		{10, nil, true, "1\n22\n4444\n5\n"},
+		{0, 6, false, "1\n22\n4444\n5\n6\n"},
+	}
+	w := httptest.NewRecorder()
+	ctx, err := newContext(w, new(http.Request), nil, "application/json", "utf-8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newStream(ctx, nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		s.SetBufferSize(test.size)
+		if test.flush {
+			err = s.Flush()
+		} else {
+			err = s.Write(test.data)
+		}
+		equal(t, err, nil, "test %d", i)
+		equal(t, w.Body.String(), test.output, "test %d", i)
+		equal(t, s.BytesWritten(), int64(len(test.output)), "test %d", i)
+	}
+}
+
+type FakeMarshaller struct{}
+
+func (m FakeMarshaller) Marshal(w io.Writer, name string, v interface{}) error {
+	_, err := fmt.Fprintf(w, "<%v>", v)
+	return err
+}
+
+func (m FakeMarshaller) Unmarshal(r io.Reader, v interface{}) error {
+	return nil
+}
+
+func (m FakeMarshaller) Error(code int, message string) error {
+	return fmt.Errorf("<%d %s>", code, message)
+}
+
+func TestStreamNegotiate(t *testing.T) {
+	type Test struct {
+		accept string
+
+		output string
+	}
+	var tests = []Test{
+		{"", "\"hello\"\n"},
+		{"application/json", "\"hello\"\n"},
+		{"text/x-fake", "<hello>"},
+		{"text/x-fake;q=0.5, application/json;q=0.9", "\"hello\"\n"},
+		{"application/json;q=0.1, text/x-fake", "<hello>"},
+	}
+	RegisterMarshaller("text/x-fake", FakeMarshaller{})
+	defer delete(marshallers, "text/x-fake")
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", "http://fake.domain", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		w := httptest.NewRecorder()
+		ctx, err := newContext(w, req, nil, "application/json", "utf-8")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := newStream(ctx, nil, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		equal(t, s.Write("hello"), nil, "test %d", i)
+		equal(t, w.Body.String(), test.output, "test %d", i)
+	}
+}
+
+func TestStreamWrap(t *testing.T) {
+	type Test struct {
+		wrap      bool
+		transform bool
+		framing   string
+		event     string
+
+		output string
+	}
+	var tests = []Test{
+		{false, false, "", "", "\"hello\"\n"},
+		{true, false, "", "", "{\"data\":\"hello\"}\n"},
+		{true, false, "", "post", "{\"type\":\"post\",\"data\":{\"data\":\"hello\"}}\n"},
+		{true, false, "sse", "post", "event: post\ndata: {\"data\":\"hello\"}\n\n"},
+		{false, true, "", "", "\"HELLO\"\n"},
+		{true, true, "", "", "{\"data\":\"HELLO\"}\n"},
+	}
+	for i, test := range tests {
+		w := httptest.NewRecorder()
+		ctx, err := newContext(w, new(http.Request), nil, "application/json", "utf-8")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx.wrapper = func(v interface{}, s Service) interface{} {
+			return map[string]interface{}{"data": v}
+		}
+		ctx.transform = func(v interface{}, s Service) interface{} {
+			return strings.ToUpper(v.(string))
+		}
+		s, err := newStream(ctx, nil, "", test.framing)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.wrap = test.wrap
+		s.transform = test.transform
+		if test.event == "" {
+			err = s.Write("hello")
+		} else {
+			err = s.WriteTyped(test.event, "hello")
+		}
+		equal(t, err, nil, "test %d", i)
+		equal(t, w.Body.String(), test.output, "test %d", i)
+	}
+}
+
+type TestStreamingPath struct {
+	Service
+
+	Watch Streaming `method:"GET" path:"/watch/:id"`
+	Bound Streaming `method:"GET" path:"/bound/:to"`
+}
+
+func (r TestStreamingPath) HandleWatch(id int, s Stream) {
+	s.Write(id)
+}
+
+func (r TestStreamingPath) HandleBound(s Stream, arg WatchArg) {
+	s.Write(arg)
+}
+
+func TestStreamingArgs(t *testing.T) {
+	type Test struct {
+		url string
+
+		code int
+		body string
+	}
+	var tests = []Test{
+		{"/watch/12", http.StatusOK, "12\n"},
+		{"/watch/abc", http.StatusBadRequest, "{\"code\":-1,\"message\":\"invalid parameter id: strconv.ParseInt: parsing \\\"abc\\\": invalid syntax\"}\n"},
+		{"/bound/rest?since=3", http.StatusOK, "{\"To\":\"rest\",\"Since\":3}\n"},
+	}
+	rest, err := New(new(TestStreamingPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(rest)
+	defer server.Close()
+	for i, test := range tests {
+		resp, err := http.Get(server.URL + test.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		equal(t, resp.StatusCode, test.code, "test %d", i)
+		equal(t, string(body), test.body, "test %d", i)
+	}
+}
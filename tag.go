@@ -0,0 +1,60 @@
+package rest
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// parseTag expands combined form tag `rest:"k1=v1,k2=v2"` to separate tags in front of tag, so
+// combined form wins when calling Get. A comma not followed by "key=" belongs to previous value, so a
+// value containing comma can be written directly.
+func parseTag(tag reflect.StructTag) reflect.StructTag {
+	combined := tag.Get("rest")
+	if combined == "" {
+		return tag
+	}
+	var keys []string
+	values := make(map[string]string)
+	last := ""
+	for _, part := range strings.Split(combined, ",") {
+		i := strings.Index(part, "=")
+		if i <= 0 || strings.ContainsAny(part[:i], " /:") {
+			if last != "" {
+				values[last] += "," + part
+			}
+			continue
+		}
+		last = strings.Trim(part[:i], " ")
+		if _, ok := values[last]; !ok {
+			keys = append(keys, last)
+		}
+		values[last] = part[i+1:]
+	}
+	ret := ""
+	for _, k := range keys {
+		ret += k + ":" + strconv.Quote(values[k]) + " "
+	}
+	return reflect.StructTag(ret + string(tag))
+}
+
+// splitList splits comma separated list, and trims space of each item.
+func splitList(s string) []string {
+	var ret []string
+	for _, item := range strings.Split(s, ",") {
+		item = strings.Trim(item, " ")
+		if item != "" {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
+func inList(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,28 @@
+package rest
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTag(t *testing.T) {
+	type Test struct {
+		tag  reflect.StructTag
+		key  string
+		want string
+	}
+	var tests = []Test{
+		{`method:"GET"`, "method", "GET"},
+		{`rest:"method=GET,path=/hello"`, "method", "GET"},
+		{`rest:"method=GET,path=/hello"`, "path", "/hello"},
+		{`rest:"method=GET" path:"/hello"`, "path", "/hello"},
+		{`rest:"method=GET" method:"POST"`, "method", "GET"},
+		{`rest:"prefix=/api,/v1,mime=application/json"`, "prefix", "/api,/v1"},
+		{`rest:"prefix=/api,/v1,mime=application/json"`, "mime", "application/json"},
+		{`rest:"path=/hello" method:"GET" json:"method"`, "json", "method"},
+	}
+	for i, test := range tests {
+		tag := parseTag(test.tag)
+		equal(t, tag.Get(test.key), test.want, "test %d", i)
+	}
+}
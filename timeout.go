@@ -0,0 +1,203 @@
+package rest
+
+import (
+	"bytes"
+	gocontext "context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrHandlerTimeout is the error of request whose handler runs longer than Rest.HandlerTimeout or the
+// timeout tag of processor.
+var ErrHandlerTimeout = errors.New("handler timeout")
+
+// HandlerPanic is the panic rethrown when handler panics under Rest.HandlerTimeout or the timeout tag
+// of processor. Handler runs in another goroutine then, so Stack keeps the stack where it panicked
+// with Value. http.ErrAbortHandler is rethrown as is.
+type HandlerPanic struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (p *HandlerPanic) Error() string {
+	return fmt.Sprintf("%v\n\n%s", p.Value, p.Stack)
+}
+
+// Unwrap returns Value if it's an error.
+func (p *HandlerPanic) Unwrap() error {
+	err, _ := p.Value.(error)
+	return err
+}
+
+// timeoutWriter buffers response of handler, so it can be discarded if handler times out.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	timedOut bool
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut || w.status != 0 || code < 200 {
+		return
+	}
+	w.status = code
+}
+
+func (w *timeoutWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, ErrHandlerTimeout
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(p)
+}
+
+// timeout marks w timed out, so response written by handler after it is discarded.
+func (w *timeoutWriter) timeout() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.timedOut = true
+}
+
+// handlerTimeout returns the timeout of handler n for request of ctx, or 0 if it's unlimited.
+func (n *processorNode) handlerTimeout(ctx *context) time.Duration {
+	if n.channel || n.timeout < 0 {
+		return 0
+	}
+	if n.timeout > 0 {
+		return n.timeout
+	}
+	return ctx.timeout
+}
+
+// handleTimeout serves request in another goroutine, with response buffered and Service.Context()
+// cancelled after d. If it times out, 503 Service Unavailable is replied with ErrHandlerTimeout, then it
+// waits for handler returning and discards its response. Until handler returns, ctx is only read for
+// settings of the timeout reply, and ctx fields are updated after it. Panic of handler is rethrown as
+// HandlerPanic.
+func (n *processorNode) handleTimeout(instance reflect.Value, ctx *context, d time.Duration) {
+	parent := ctx.ctx
+	c, cancel := gocontext.WithTimeout(parent, d)
+	defer cancel()
+
+	// buffer beneath countResponseWriter, so status and bytes are still counted by handler.
+	target := &ctx.responseWriter
+	if cw, ok := ctx.responseWriter.(*countResponseWriter); ok {
+		target = &cw.ResponseWriter
+	}
+	resp := *target
+	w := &timeoutWriter{header: resp.Header().Clone()}
+	*target = w
+	ctx.ctx = c
+
+	done := make(chan *HandlerPanic, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- &HandlerPanic{Value: p, Stack: debug.Stack()}
+				return
+			}
+			done <- nil
+		}()
+		n.serve(instance, ctx)
+	}()
+
+	var p *HandlerPanic
+	written := 0
+	returned := false
+	select {
+	case p = <-done:
+		returned = true
+	case <-c.Done():
+	}
+	// handler seeing cancelled context skips its response, so timeout is replied even if it has returned,
+	// but client which has gone needs no reply.
+	timedOut := c.Err() == gocontext.DeadlineExceeded && parent.Err() == nil
+	if timedOut {
+		w.timeout()
+		written = writeTimeout(ctx, resp)
+	}
+	if !returned {
+		p = <-done
+	}
+	*target = resp
+	ctx.ctx = parent
+	if p != nil {
+		if p.Value == http.ErrAbortHandler {
+			panic(http.ErrAbortHandler)
+		}
+		panic(p)
+	}
+
+	if timedOut {
+		ctx.bytesWritten = int64(written)
+		ctx.status, ctx.written = http.StatusServiceUnavailable, http.StatusServiceUnavailable
+		ctx.isError = true
+		ctx.err = ErrHandlerTimeout
+		ctx.category = CategoryServer
+		return
+	}
+	header := resp.Header()
+	for k := range header {
+		delete(header, k)
+	}
+	for k, v := range w.header {
+		header[k] = v
+	}
+	if w.status != 0 {
+		resp.WriteHeader(w.status)
+	}
+	if w.body.Len() > 0 {
+		resp.Write(w.body.Bytes())
+	}
+}
+
+// writeTimeout replies ErrHandlerTimeout to resp, like Service.Error, and returns the length of body.
+// It's called while handler is running, so it only reads fields of ctx which handler doesn't change.
+func writeTimeout(ctx *context, resp http.ResponseWriter) int {
+	var body bytes.Buffer
+	mime, marshaller, ok := ctx.errorMarshaller()
+	if ctx.problemJSON {
+		body.Write(ctx.marshalProblem(http.StatusServiceUnavailable, ErrHandlerTimeout))
+	} else if ok {
+		e := marshaller.Error(-1, ErrHandlerTimeout.Error())
+		if hasExportField(e) {
+			marshaller.Marshal(&body, ctx.name, e)
+		} else {
+			marshaller.Marshal(&body, ctx.name, e.Error())
+		}
+	}
+	header := resp.Header()
+	if ctx.problemJSON {
+		header.Set("Content-Type", ProblemMime)
+	} else {
+		header.Set("Content-Type", mimeContentType(mime, ctx.charset))
+	}
+	header.Set("Content-Length", strconv.Itoa(body.Len()))
+	if ctx.retryAfter > 0 {
+		header.Set("Retry-After", retryAfterSeconds(ctx.retryAfter))
+	}
+	resp.WriteHeader(http.StatusServiceUnavailable)
+	n, _ := resp.Write(body.Bytes())
+	if f := findFlusher(resp); f != nil {
+		f.Flush()
+	}
+	return n
+}
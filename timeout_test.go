@@ -0,0 +1,135 @@
+package rest
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type TestTimeout struct {
+	Service
+
+	Fast    Processor `method:"GET" path:"/fast"`
+	Created Processor `method:"GET" path:"/created"`
+	Slow    Processor `method:"GET" path:"/slow"`
+	Quick   Processor `method:"GET" path:"/quick" timeout:"1ms"`
+	Off     Processor `method:"GET" path:"/off" timeout:"off"`
+	Render  Processor `method:"GET" path:"/render"`
+	Panic   Processor `method:"GET" path:"/panic"`
+
+	stopped chan bool
+}
+
+func (r TestTimeout) HandleFast() string {
+	r.Header().Set("X-Fast", "on")
+	return "fast"
+}
+
+func (r TestTimeout) HandleCreated() string {
+	r.SetStatus(http.StatusCreated)
+	return "created"
+}
+
+func (r TestTimeout) HandleSlow() string {
+	r.Header().Set("X-Slow", "on")
+	<-r.Context().Done()
+	r.stopped <- true
+	return "slow"
+}
+
+func (r TestTimeout) HandleQuick() string {
+	<-r.Context().Done()
+	r.stopped <- true
+	return "quick"
+}
+
+func (r TestTimeout) HandleOff() string {
+	time.Sleep(50 * time.Millisecond)
+	return "off"
+}
+
+func (r TestTimeout) HandleRender() func(io.Writer) error {
+	return func(w io.Writer) error {
+		for i := 0; i < 40; i++ {
+			w.Write([]byte("x"))
+			time.Sleep(time.Millisecond)
+		}
+		return nil
+	}
+}
+
+var errTimeoutPanic = errors.New("timeout panic")
+
+func (r TestTimeout) HandlePanic() string {
+	panic(errTimeoutPanic)
+}
+
+func TestRestHandlerTimeout(t *testing.T) {
+	type Test struct {
+		url string
+
+		code    int
+		header  string
+		body    string
+		stopped bool
+	}
+	var tests = []Test{
+		{"http://domain/fast", http.StatusOK, "X-Fast", "\"fast\"\n", false},
+		{"http://domain/created", http.StatusCreated, "", "\"created\"\n", false},
+		{"http://domain/slow", http.StatusServiceUnavailable, "Retry-After", "{\"code\":-1,\"message\":\"handler timeout\"}\n", true},
+		{"http://domain/quick", http.StatusServiceUnavailable, "Retry-After", "{\"code\":-1,\"message\":\"handler timeout\"}\n", true},
+		{"http://domain/off", http.StatusOK, "", "\"off\"\n", false},
+		{"http://domain/render", http.StatusServiceUnavailable, "Retry-After", "{\"code\":-1,\"message\":\"handler timeout\"}\n", false},
+	}
+	s := &TestTimeout{stopped: make(chan bool, 1)}
+	var tapped int
+	rest, err := New(s, WithHandlerTimeout(20*time.Millisecond), WithRetryAfter(time.Second),
+		WithTap(func(req *http.Request, status int, dur time.Duration) { tapped = status }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		rest.ServeHTTP(w, req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, tapped, test.code, "test %d", i)
+		if test.header != "" {
+			equal(t, w.Header().Get(test.header) != "", true, "test %d", i)
+		}
+		equal(t, w.Header().Get("X-Slow"), "", "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+		select {
+		case <-s.stopped:
+			equal(t, test.stopped, true, "test %d", i)
+		default:
+			equal(t, test.stopped, false, "test %d", i)
+		}
+	}
+}
+
+func TestRestHandlerTimeoutPanic(t *testing.T) {
+	rest, err := New(&TestTimeout{}, WithHandlerTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("GET", "http://domain/panic", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		p, ok := recover().(*HandlerPanic)
+		equal(t, ok, true)
+		equal(t, p.Value, errTimeoutPanic)
+		equal(t, errors.Is(p, errTimeoutPanic), true)
+		equal(t, strings.Contains(string(p.Stack), "HandlePanic"), true)
+	}()
+	rest.ServeHTTP(httptest.NewRecorder(), req)
+}
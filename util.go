@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"unsafe"
 )
 
 // Test a service with special vars and request. If tested handler doesn't access vars or request, set them to nil.
@@ -22,7 +23,7 @@ func SetTest(i interface{}, vars map[string]string, r *http.Request) (*httptest.
 	if !service.IsValid() {
 		return nil, fmt.Errorf("%s doesn't contain rest.Service field.", instance.Type().Name())
 	}
-	_, mime, charset, err := initService(service, instance.Type().Field(index).Tag)
+	_, mime, charset, err := initService(service, parseTag(instance.Type().Field(index).Tag))
 	if err != nil {
 		return nil, err
 	}
@@ -32,7 +33,20 @@ func SetTest(i interface{}, vars map[string]string, r *http.Request) (*httptest.
 		r = new(http.Request)
 	}
 	ctx, err := newContext(w, r, vars, mime, charset)
-	ctxField := service.FieldByName("context")
-	ctxField.Set(reflect.ValueOf(ctx))
+	setContext(service.FieldByName("context"), ctx)
 	return w, nil
 }
+
+// Test serves request r with the whole service, routing and hooks included, and returns the recorded
+// response, so integration tests don't need a real server. Rest.Tap, if set, observes it too.
+func (re *Rest) Test(r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	re.ServeHTTP(w, r)
+	return w
+}
+
+// setContext sets ctx to the unexported embedded context field of Service.
+func setContext(field reflect.Value, ctx *context) {
+	field = reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem()
+	field.Set(reflect.ValueOf(ctx))
+}
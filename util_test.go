@@ -2,7 +2,9 @@ package rest
 
 import (
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 )
 
 type RestUtil struct {
@@ -44,3 +46,53 @@ func TestSetTest(t *testing.T) {
 		equal(t, util.responseWriter, resp, "test %d", i)
 	}
 }
+
+func TestRestTest(t *testing.T) {
+	type Test struct {
+		method string
+		url    string
+
+		code int
+		body string
+	}
+	var tests = []Test{
+		{"GET", "http://domain/hello", http.StatusOK, "\"hello\"\n"},
+		{"POST", "http://domain/hello", http.StatusCreated, ""},
+		{"GET", "http://domain/missing", http.StatusNotFound, ""},
+		{"GET", "http://domain/hello?q=" + strings.Repeat("a", 100), http.StatusRequestURITooLong, ""},
+		{"GET", "http://domain/empty", http.StatusOK, ""},
+	}
+	type tap struct {
+		path   string
+		status int
+	}
+	var taps []tap
+	rest := NewRouter("/")
+	rest.MaxURLLength = 50
+	rest.Tap = func(req *http.Request, status int, dur time.Duration) {
+		if dur <= 0 {
+			t.Errorf("tap of %s got duration %s", req.URL.Path, dur)
+		}
+		taps = append(taps, tap{req.URL.Path, status})
+	}
+	if err := rest.GET("/hello", func(s Service) string { return "hello" }); err != nil {
+		t.Fatal(err)
+	}
+	if err := rest.POST("/hello", func(s Service) { s.WriteHeader(http.StatusCreated) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := rest.GET("/empty", func(s Service) {}); err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest(test.method, test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := rest.Test(req)
+		equal(t, w.Code, test.code, "test %d", i)
+		equal(t, w.Body.String(), test.body, "test %d", i)
+		equal(t, len(taps), i+1, "test %d", i)
+		equal(t, taps[i], tap{req.URL.Path, test.code}, "test %d", i)
+	}
+}